@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 )
 
 // ReadCsvByName accepts the file path and returns the pointer of Checkpoint list
@@ -23,12 +24,28 @@ func ReadCsvByName(fileLoc string) (cpListPtr *[]Checkpoint, errCode int, err er
 
 // ReadCsvByPtr accepts the file pointer and returns the pointer of Checkpoint list
 func ReadCsvByPtr(csvFile *os.File) (cpListPtr *[]Checkpoint, errCode int, err error) {
+	recordListPtr, errCode, err := ReadCsvRecords(csvFile)
+	if recordListPtr == nil {
+		return nil, errCode, err
+	}
+
+	cpList := make([]Checkpoint, 0, len(*recordListPtr))
+	for _, rec := range *recordListPtr {
+		cpList = append(cpList, rec.Checkpoint)
+	}
+	return &cpList, errCode, err
+}
+
+// ReadCsvRecords accepts the file pointer and returns the pointer of Record list,
+// keeping the extra columns after weight by the header
+func ReadCsvRecords(csvFile *os.File) (recordListPtr *[]Record, errCode int, err error) {
 
 	csvFile.Seek(0, 0)
 	csvReader := csv.NewReader(csvFile)
 	defer csvFile.Close()
 
-	if _, err := csvReader.Read(); err != nil { // Skip the file header
+	header, err := csvReader.Read() // the columns after weight are extra attributes named by it
+	if err != nil {
 		log.Println(err)
 	}
 	rows, err := csvReader.ReadAll() // rows: [][]string
@@ -38,35 +55,33 @@ func ReadCsvByPtr(csvFile *os.File) (cpListPtr *[]Checkpoint, errCode int, err e
 	}
 
 	// Logic: Read all the valid lines and omit invalid ones.
-	// Line structure: name, base, rx, ry, isPortal
-	cpList := make([]Checkpoint, 0, len(rows))
-	omitCounter := 0
-	parseF64 := func(raw string) (ans float64, err error) {
-		ans, err = strconv.ParseFloat(raw, 64)
-		if err != nil {
-			log.Println(err)
-			omitCounter++
-			return 0, err
-		}
-		return ans, nil
-	}
+	// Line structure: name, base, rx, ry, isPortal, weight, [extra attributes...]
+	recordList := make([]Record, 0, len(rows))
+	omitted := []LineError{}
 
-	for _, row := range rows {
+	for i, row := range rows {
 		var tempCP Checkpoint
 		var tempF64 float64
 		var tempBool bool
+		line := i + 2 // after the header
+		omit := func(err error) {
+			log.Println(err)
+			omitted = append(omitted, LineError{Line: line, Err: err})
+		}
 
 		tempCP.Name = row[0]
 		tempCP.Base = row[1]
-		tempF64, err = parseF64(row[2]) // rx
+		tempF64, err = strconv.ParseFloat(row[2], 64) // rx
 		if err != nil {
+			omit(err)
 			continue
 		} else {
 			tempCP.Rx = tempF64
 		}
 
-		tempF64, err = parseF64(row[3]) // ry
+		tempF64, err = strconv.ParseFloat(row[3], 64) // ry
 		if err != nil {
+			omit(err)
 			continue
 		} else {
 			tempCP.Ry = tempF64
@@ -74,8 +89,7 @@ func ReadCsvByPtr(csvFile *os.File) (cpListPtr *[]Checkpoint, errCode int, err e
 
 		tempBool, err = strconv.ParseBool(row[4])
 		if err != nil {
-			log.Println(err.Error())
-			omitCounter++
+			omit(err)
 			continue
 		} else {
 			tempCP.IsPortal = tempBool
@@ -86,12 +100,12 @@ func ReadCsvByPtr(csvFile *os.File) (cpListPtr *[]Checkpoint, errCode int, err e
 				// is an Asset, assign default weight
 				tempCP.Weight = 1
 			} else {
-				tempF64, err = parseF64(row[5]) // weight
+				tempF64, err = strconv.ParseFloat(row[5], 64) // weight
 				if err != nil {
+					omit(err)
 					continue
 				} else if tempF64 < 0 {
-					err = errors.New("sampling weight cannot be negative")
-					omitCounter++
+					omit(errors.New("sampling weight cannot be negative"))
 					continue
 				} else {
 					tempCP.Weight = tempF64
@@ -99,11 +113,40 @@ func ReadCsvByPtr(csvFile *os.File) (cpListPtr *[]Checkpoint, errCode int, err e
 			}
 		}
 
-		cpList = append(cpList, tempCP)
+		tempRecord := Record{Checkpoint: tempCP, Line: line}
+		for i := 6; i < len(row) && i < len(header); i++ {
+			if key, value := strings.TrimSpace(header[i]), strings.TrimSpace(row[i]); key != "" && value != "" {
+				if tempRecord.Attrs == nil {
+					tempRecord.Attrs = make(map[string]string)
+				}
+				tempRecord.Attrs[key] = value
+			}
+		}
+
+		recordList = append(recordList, tempRecord)
+	}
+
+	if len(omitted) == 0 {
+		return &recordList, http.StatusCreated, nil
 	}
+	return &recordList, http.StatusPartialContent, ParseError{Lines: omitted}
+}
+
+// LineError is a line of the csv file omitted, and why
+type LineError struct {
+	Line int
+	Err  error
+}
+
+// ParseError lists the lines of the csv file that cannot be parsed
+type ParseError struct {
+	Lines []LineError
+}
 
-	if omitCounter == 0 {
-		return &cpList, http.StatusCreated, nil
+func (e ParseError) Error() string {
+	numbers := make([]string, 0, len(e.Lines))
+	for _, l := range e.Lines {
+		numbers = append(numbers, strconv.Itoa(l.Line))
 	}
-	return &cpList, http.StatusPartialContent, errors.New(string(omitCounter) + " lines cannot be parsed")
+	return strconv.Itoa(len(e.Lines)) + " lines cannot be parsed: line " + strings.Join(numbers, ", ")
 }
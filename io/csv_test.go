@@ -1,6 +1,7 @@
 package io
 
 import (
+	"io/ioutil"
 	"net/http"
 	"os"
 	"reflect"
@@ -24,12 +25,12 @@ func TestReadCsvByName(t *testing.T) {
 			os.Getenv("GOPATH"), "src", "github.com", "miosolo", "readygo", "test", "test_location.csv",
 		}, string(os.PathSeparator))}, // in test/test.location.csv
 		wantCpListPtr: &[]Checkpoint{
-			Checkpoint{"A", "base", 0.4, 0.2, false, 2},
-			Checkpoint{"B", "base", 3.5, 2, false, 1},
-			Checkpoint{"C", "base", 2.6, 5.9, false, 1},
-			Checkpoint{"D", "base", 3, 2.1, true, 0},
-			Checkpoint{"E", "D", 2, 1.5, false, 1},
-			Checkpoint{"F", "D", 1.7, 1, false, 1},
+			Checkpoint{Name: "A", Base: "base", Rx: 0.4, Ry: 0.2, IsPortal: false, Weight: 2},
+			Checkpoint{Name: "B", Base: "base", Rx: 3.5, Ry: 2, IsPortal: false, Weight: 1},
+			Checkpoint{Name: "C", Base: "base", Rx: 2.6, Ry: 5.9, IsPortal: false, Weight: 1},
+			Checkpoint{Name: "D", Base: "base", Rx: 3, Ry: 2.1, IsPortal: true, Weight: 0},
+			Checkpoint{Name: "E", Base: "D", Rx: 2, Ry: 1.5, IsPortal: false, Weight: 1},
+			Checkpoint{Name: "F", Base: "D", Rx: 1.7, Ry: 1, IsPortal: false, Weight: 1},
 		},
 		wantErrCode: http.StatusCreated,
 		wantErr:     false,
@@ -53,3 +54,34 @@ func TestReadCsvByName(t *testing.T) {
 		})
 	}
 }
+
+func TestReadCsvRecords(t *testing.T) {
+	csvFile, err := ioutil.TempFile("", "records-*.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(csvFile.Name())
+	csvFile.WriteString("name,base,rx,ry,isPortal,weight,category,serial,Purchase Date\n" +
+		"A,base,1,2,false,,laptop,SN-01,2019-07-01\n" +
+		"D,base,3,2.1,true,,,,\n" +
+		"E,D,x,1.5,false,1,chair,,\n")
+
+	gotListPtr, gotErrCode, err := ReadCsvRecords(csvFile)
+	want := []Record{{
+		Checkpoint: Checkpoint{Name: "A", Base: "base", Rx: 1, Ry: 2, Weight: 1},
+		Attrs:      map[string]string{"category": "laptop", "serial": "SN-01", "Purchase Date": "2019-07-01"},
+		Line:       2,
+	}, {
+		Checkpoint: Checkpoint{Name: "D", Base: "base", Rx: 3, Ry: 2.1, IsPortal: true},
+		Line:       3,
+	}}
+	if err == nil || gotErrCode != http.StatusPartialContent {
+		t.Errorf("ReadCsvRecords() = %v, %v, want %v for the omitted line", gotErrCode, err, http.StatusPartialContent)
+	}
+	if parseErr, ok := err.(ParseError); !ok || len(parseErr.Lines) != 1 || parseErr.Lines[0].Line != 4 {
+		t.Errorf("ReadCsvRecords() error = %#v, want line 4 omitted", err)
+	}
+	if gotListPtr == nil || !reflect.DeepEqual(*gotListPtr, want) {
+		t.Errorf("ReadCsvRecords() gotListPtr = %v, want %v", gotListPtr, want)
+	}
+}
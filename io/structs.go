@@ -11,10 +11,33 @@ type Checkpoint struct {
 	Ry       float64 // relative y
 	IsPortal bool    // indicates if it is a sub-space to another Space, like a door
 	Weight   float64 // global weight in sampling, default 1
+	ETA      float64 // estimated seconds from the start of the route to arrive at it
+	Dwell    float64 // estimated seconds to stay and check it
+}
+
+//Record is a line of the csv file: the Checkpoint, and the extra columns named by the header
+type Record struct {
+	Checkpoint
+	Attrs map[string]string // like category, serial
+	Line  int               // the line number in the file, the header is line 1
+}
+
+//Point is a position in the coordinates of a Space
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+//Outline is the boundary of a Space, in the same coordinates as the route
+type Outline struct {
+	Name   string  // the Space's name
+	Points []Point // vertices of the polygon in order
 }
 
 //Route is the type for routing used by net package and route package
 type Route struct {
 	Sequence []Checkpoint
 	Distance float64
+	Duration float64   // estimated seconds to walk through and check all, 0 for not estimated
+	Outlines []Outline // the outlines of the Spaces in the route's tree, if they have
 }
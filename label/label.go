@@ -0,0 +1,156 @@
+package label
+
+import (
+	"errors"
+	"image/color"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font/basicfont"
+)
+
+// the sheet is A4 at 300 dpi, with 3 x 8 labels of 70 x 37 mm
+const (
+	SHEET_WIDTH      = 2480
+	SHEET_HEIGHT     = 3508
+	SHEET_COLUMNS    = 3
+	SHEET_ROWS       = 8
+	LABELS_PER_SHEET = SHEET_COLUMNS * SHEET_ROWS
+	LABEL_WIDTH      = 826
+	LABEL_HEIGHT     = 437
+)
+
+// QUIET_ZONE is the light modules around the QR code
+const QUIET_ZONE = 4
+
+// Label is what is printed on an Asset
+type Label struct {
+	Code     string // encoded in the QR code
+	Title    string // like the asset's name
+	Subtitle string // like the base space
+	Footnote string // like the verification token
+}
+
+// loadFont sets the font face of the size, or the basic one
+func loadFont(dc *gg.Context, points float64) {
+	fontPath := strings.Join([]string{os.Getenv("GOPATH"), "src", "github.com",
+		"miosolo", "readygo", "route", "ARIALBI.TTF"}, string(os.PathSeparator))
+	if err := dc.LoadFontFace(fontPath, points); err != nil {
+		log.Println(err)
+		dc.SetFontFace(basicfont.Face7x13)
+	}
+}
+
+// fitText shortens the text with "..." to fit the width
+func fitText(dc *gg.Context, text string, width float64) string {
+	if w, _ := dc.MeasureString(text); w <= width {
+		return text
+	}
+	runes := []rune(text)
+	for n := len(runes) - 1; n > 0; n-- {
+		short := strings.TrimRight(string(runes[:n]), " ") + "..."
+		if w, _ := dc.MeasureString(short); w <= width {
+			return short
+		}
+	}
+	return "..."
+}
+
+// drawQR draws the QR code as large as fits the square of the side, in whole pixels per module
+func drawQR(dc *gg.Context, q *QR, x float64, y float64, side float64) {
+	scale := math.Floor(side / float64(q.Size+2*QUIET_ZONE))
+	if scale < 1 {
+		scale = 1
+	}
+	offset := (side - scale*float64(q.Size)) / 2 // centers it within the quiet zone
+	for my := 0; my < q.Size; my++ {
+		for mx := 0; mx < q.Size; mx++ {
+			if q.Dark(mx, my) {
+				dc.DrawRectangle(math.Round(x+offset)+float64(mx)*scale, math.Round(y+offset)+float64(my)*scale, scale, scale)
+			}
+		}
+	}
+	dc.Fill()
+}
+
+// drawLabel draws the label in the box at (x, y): the QR code on the left, the text on the right
+func drawLabel(dc *gg.Context, l Label, x float64, y float64, w float64, h float64) error {
+	q, err := Encode([]byte(l.Code))
+	if err != nil {
+		return err
+	}
+
+	dc.SetColor(color.White)
+	dc.DrawRectangle(x, y, w, h)
+	dc.Fill()
+	dc.SetColor(color.Black)
+	drawQR(dc, q, x, y, h)
+
+	textX, textW := x+h, w-h-h*0.08
+	loadFont(dc, h*0.11)
+	dc.DrawString(fitText(dc, l.Title, textW), textX, y+h*0.38)
+	loadFont(dc, h*0.08)
+	dc.DrawString(fitText(dc, l.Subtitle, textW), textX, y+h*0.56)
+	dc.SetColor(color.Gray{Y: 0x60})
+	dc.DrawString(fitText(dc, l.Footnote, textW), textX, y+h*0.72)
+	return nil
+}
+
+// savePNG saves the picture to the archive folder, named by the kind and the time
+func savePNG(dc *gg.Context, kind string) (filePath string, errCode int, err error) {
+	folderPath := strings.Join([]string{os.Getenv("GOPATH"), "src", "github.com",
+		"miosolo", "readygo", "archive"}, string(os.PathSeparator))
+	os.Mkdir(folderPath, os.ModePerm) // ensure the folder exists
+	folderPath = strings.Join([]string{folderPath, "label"}, string(os.PathSeparator))
+	os.Mkdir(folderPath, os.ModePerm) // ensure the folder exists
+	now := time.Now()
+	filePath = strings.Join([]string{folderPath, (kind + "-" + now.Format("02-Jan-2006-15-04-05") + "-" +
+		strconv.Itoa(now.Nanosecond()) + ".png")}, string(os.PathSeparator))
+
+	if err = dc.SavePNG(filePath); err != nil {
+		log.Println(err)
+		return "", http.StatusInternalServerError, err
+	}
+	return filePath, http.StatusOK, nil
+}
+
+// DrawLabel exports the label of a single Asset
+func DrawLabel(l Label) (filePath string, errCode int, err error) {
+	dc := gg.NewContext(LABEL_WIDTH, LABEL_HEIGHT)
+	if err = drawLabel(dc, l, 0, 0, LABEL_WIDTH, LABEL_HEIGHT); err != nil {
+		return "", http.StatusNotAcceptable, err
+	}
+	return savePNG(dc, "label")
+}
+
+// DrawSheet exports a printable sheet of at most LABELS_PER_SHEET labels, row by row
+func DrawSheet(list []Label) (filePath string, errCode int, err error) {
+	if len(list) > LABELS_PER_SHEET {
+		return "", http.StatusNotAcceptable, errors.New("too many labels for a sheet")
+	}
+
+	dc := gg.NewContext(SHEET_WIDTH, SHEET_HEIGHT)
+	dc.SetColor(color.White)
+	dc.Clear()
+
+	marginX := float64(SHEET_WIDTH-SHEET_COLUMNS*LABEL_WIDTH) / 2
+	marginY := float64(SHEET_HEIGHT-SHEET_ROWS*LABEL_HEIGHT) / 2
+	for i, l := range list {
+		x := marginX + float64(i%SHEET_COLUMNS*LABEL_WIDTH)
+		y := marginY + float64(i/SHEET_COLUMNS*LABEL_HEIGHT)
+		if err = drawLabel(dc, l, x, y, LABEL_WIDTH, LABEL_HEIGHT); err != nil {
+			return "", http.StatusNotAcceptable, errors.New(l.Code + ": " + err.Error())
+		}
+		dc.SetColor(color.Gray{Y: 0xC0}) // the cutting guide
+		dc.SetLineWidth(1)
+		dc.DrawRectangle(x, y, LABEL_WIDTH, LABEL_HEIGHT)
+		dc.Stroke()
+	}
+	return savePNG(dc, "sheet")
+}
@@ -0,0 +1,70 @@
+package label
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font/basicfont"
+)
+
+func TestDrawSheet(t *testing.T) {
+	tests := []struct {
+		name        string
+		count       int
+		code        string
+		wantErrCode int
+		wantErr     bool
+	}{
+		{"a label", 1, "A@base#ABCD2345", 200, false},
+		{"full sheet", LABELS_PER_SHEET, "Projector 3@Meeting Room#ABCD2345", 200, false},
+		{"too many", LABELS_PER_SHEET + 1, "A@base#ABCD2345", 406, true},
+		{"too long to encode", 1, strings.Repeat("x", 300), 406, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := make([]Label, tt.count)
+			for i := range list {
+				list[i] = Label{Code: tt.code, Title: tt.code, Subtitle: "@ base", Footnote: "ABCD2345"}
+			}
+			filePath, gotErrCode, err := DrawSheet(list)
+			if (err != nil) != tt.wantErr || gotErrCode != tt.wantErrCode {
+				t.Errorf("DrawSheet() = %v, %v, want %v", gotErrCode, err, tt.wantErrCode)
+			}
+			if err == nil {
+				os.Remove(filePath)
+			}
+		})
+	}
+}
+
+func TestDrawLabel(t *testing.T) {
+	filePath, errCode, err := DrawLabel(Label{Code: "A@base#ABCD2345", Title: "A", Subtitle: "@ base", Footnote: "ABCD2345"})
+	if err != nil || errCode != 200 {
+		t.Errorf("DrawLabel() = %v, %v", errCode, err)
+	}
+	if _, err := os.Stat(filePath); err != nil {
+		t.Errorf("DrawLabel() file %v: %v", filePath, err)
+	}
+	os.Remove(filePath)
+}
+
+func Test_fitText(t *testing.T) {
+	dc := gg.NewContext(100, 100)
+	dc.SetFontFace(basicfont.Face7x13)
+	tests := []struct {
+		text  string
+		width float64
+		want  string
+	}{
+		{"short", 100, "short"},
+		{"a very long asset name", 70, "a very..."},
+		{"long", 1, "..."},
+	}
+	for _, tt := range tests {
+		if got := fitText(dc, tt.text, tt.width); got != tt.want {
+			t.Errorf("fitText(%v, %v) = %v, want %v", tt.text, tt.width, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,420 @@
+package label
+
+import (
+	"errors"
+)
+
+// the blocks of a QR code version at error correction level M
+type qrVersion struct {
+	ecPerBlock int   // error correction codewords per block
+	blocks     []int // data codewords of every block
+	alignment  []int // centers of the alignment patterns
+}
+
+// versions 1-10 at level M, enough for name@base and a token
+var qrVersions = []qrVersion{
+	{}, // no version 0
+	{10, []int{16}, nil},
+	{16, []int{28}, []int{6, 18}},
+	{26, []int{44}, []int{6, 22}},
+	{18, []int{32, 32}, []int{6, 26}},
+	{24, []int{43, 43}, []int{6, 30}},
+	{16, []int{27, 27, 27, 27}, []int{6, 34}},
+	{18, []int{31, 31, 31, 31}, []int{6, 22, 38}},
+	{22, []int{38, 38, 39, 39}, []int{6, 24, 42}},
+	{22, []int{36, 36, 36, 37, 37}, []int{6, 26, 46}},
+	{26, []int{43, 43, 43, 43, 44}, []int{6, 28, 50}},
+}
+
+// QR is an encoded QR code symbol
+type QR struct {
+	Size    int      // modules on a side
+	modules [][]bool // [y][x], true for dark
+	isFunc  [][]bool // finder, timing, alignment, format and version modules
+}
+
+// Dark tells whether the module at (x, y) is dark
+func (q *QR) Dark(x int, y int) bool {
+	return q.modules[y][x]
+}
+
+// gfMul multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1
+func gfMul(x byte, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+// rsDivisor is the Reed-Solomon generator polynomial of the degree, without the leading 1
+func rsDivisor(degree int) []byte {
+	divisor := make([]byte, degree)
+	divisor[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range divisor {
+			divisor[j] = gfMul(divisor[j], root)
+			if j+1 < len(divisor) {
+				divisor[j] ^= divisor[j+1]
+			}
+		}
+		root = gfMul(root, 0x02)
+	}
+	return divisor
+}
+
+// rsRemainder computes the error correction codewords of the data
+func rsRemainder(data []byte, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		result = append(result[1:], 0)
+		for i := range result {
+			result[i] ^= gfMul(divisor[i], factor)
+		}
+	}
+	return result
+}
+
+// Encode encodes the data in byte mode at error correction level M,
+// into the smallest version fitting it
+func Encode(data []byte) (*QR, error) {
+	version := 0
+	for v := 1; v < len(qrVersions); v++ {
+		capacity := 0
+		for _, n := range qrVersions[v].blocks {
+			capacity += n
+		}
+		countBits := 8
+		if v >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) <= capacity*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, errors.New("the data is too long for a QR code label")
+	}
+
+	q := &QR{Size: 17 + 4*version}
+	q.modules = make([][]bool, q.Size)
+	q.isFunc = make([][]bool, q.Size)
+	for i := range q.modules {
+		q.modules[i] = make([]bool, q.Size)
+		q.isFunc[i] = make([]bool, q.Size)
+	}
+
+	q.drawFunctionPatterns(version)
+	q.drawCodewords(interleave(version, data))
+
+	// choose the mask of the least penalty
+	bestMask, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormatBits(mask)
+		if penalty := q.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			bestMask, bestPenalty = mask, penalty
+		}
+		q.applyMask(mask) // XOR again to undo
+	}
+	q.applyMask(bestMask)
+	q.drawFormatBits(bestMask)
+	return q, nil
+}
+
+// interleave builds the bit stream of the data, splits it into blocks and
+// interleaves them with their error correction codewords
+func interleave(version int, data []byte) []byte {
+	ver := qrVersions[version]
+	capacity := 0
+	for _, n := range ver.blocks {
+		capacity += n
+	}
+
+	// mode, count, data, terminator and padding
+	bits := make([]bool, 0, capacity*8)
+	appendBits := func(value int, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, (value>>uint(i))&1 != 0)
+		}
+	}
+	appendBits(0x4, 4) // byte mode
+	if version >= 10 {
+		appendBits(len(data), 16)
+	} else {
+		appendBits(len(data), 8)
+	}
+	for _, b := range data {
+		appendBits(int(b), 8)
+	}
+	for i := 0; i < 4 && len(bits) < capacity*8; i++ {
+		bits = append(bits, false)
+	}
+	for len(bits)%8 != 0 {
+		bits = append(bits, false)
+	}
+	for pad := 0xEC; len(bits) < capacity*8; pad ^= 0xEC ^ 0x11 {
+		appendBits(pad, 8)
+	}
+
+	codewords := make([]byte, capacity)
+	for i, bit := range bits {
+		if bit {
+			codewords[i>>3] |= 1 << uint(7-i&7)
+		}
+	}
+
+	// blocks
+	divisor := rsDivisor(ver.ecPerBlock)
+	dataBlocks, ecBlocks := make([][]byte, len(ver.blocks)), make([][]byte, len(ver.blocks))
+	k, maxLen := 0, 0
+	for i, n := range ver.blocks {
+		dataBlocks[i] = codewords[k : k+n]
+		ecBlocks[i] = rsRemainder(dataBlocks[i], divisor)
+		k += n
+		if n > maxLen {
+			maxLen = n
+		}
+	}
+
+	result := make([]byte, 0, capacity+ver.ecPerBlock*len(ver.blocks))
+	for i := 0; i < maxLen; i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < ver.ecPerBlock; i++ {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+// setFunc sets a function module
+func (q *QR) setFunc(x int, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.isFunc[y][x] = true
+}
+
+// drawFunctionPatterns draws the finders, timing and alignment patterns, and the version,
+// reserving the format areas
+func (q *QR) drawFunctionPatterns(version int) {
+	for i := 0; i < q.Size; i++ {
+		q.setFunc(6, i, i%2 == 0)
+		q.setFunc(i, 6, i%2 == 0)
+	}
+
+	for _, c := range [][2]int{{3, 3}, {q.Size - 4, 3}, {3, q.Size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x >= 0 && x < q.Size && y >= 0 && y < q.Size {
+					dist := maxInt(absInt(dx), absInt(dy))
+					q.setFunc(x, y, dist != 2 && dist != 4)
+				}
+			}
+		}
+	}
+
+	align := qrVersions[version].alignment
+	for i, cy := range align {
+		for j, cx := range align {
+			if (i == 0 && j == 0) || (i == 0 && j == len(align)-1) || (i == len(align)-1 && j == 0) {
+				continue // on the finders
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.setFunc(cx+dx, cy+dy, maxInt(absInt(dx), absInt(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	q.drawFormatBits(0) // reserved, drawn again after masking
+
+	if version >= 7 {
+		rem := version
+		for i := 0; i < 12; i++ {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+		}
+		bits := version<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := (bits>>uint(i))&1 != 0
+			a, b := q.Size-11+i%3, i/3
+			q.setFunc(a, b, dark)
+			q.setFunc(b, a, dark)
+		}
+	}
+}
+
+// drawFormatBits draws the level M and the mask, in both copies
+func (q *QR) drawFormatBits(mask int) {
+	data := 0<<3 | mask // level M is 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>uint(i))&1 != 0 }
+
+	for i := 0; i <= 5; i++ {
+		q.setFunc(8, i, bit(i))
+	}
+	q.setFunc(8, 7, bit(6))
+	q.setFunc(8, 8, bit(7))
+	q.setFunc(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.setFunc(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		q.setFunc(q.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.setFunc(8, q.Size-15+i, bit(i))
+	}
+	q.setFunc(8, q.Size-8, true) // the dark module
+}
+
+// drawCodewords places the codewords in the zigzag order, from the bottom right
+func (q *QR) drawCodewords(codewords []byte) {
+	i := 0
+	for right := q.Size - 1; right >= 1; right -= 2 {
+		if right == 6 { // skip the vertical timing pattern
+			right = 5
+		}
+		for vert := 0; vert < q.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 { // upward
+					y = q.Size - 1 - vert
+				}
+				if !q.isFunc[y][x] && i < len(codewords)*8 {
+					q.modules[y][x] = (codewords[i>>3]>>uint(7-i&7))&1 != 0
+					i++
+				}
+				// the remainder bits are left light
+			}
+		}
+	}
+}
+
+// applyMask flips the data modules by the mask pattern
+func (q *QR) applyMask(mask int) {
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			var flip bool
+			switch mask {
+			case 0:
+				flip = (x+y)%2 == 0
+			case 1:
+				flip = y%2 == 0
+			case 2:
+				flip = x%3 == 0
+			case 3:
+				flip = (x+y)%3 == 0
+			case 4:
+				flip = (x/3+y/2)%2 == 0
+			case 5:
+				flip = x*y%2+x*y%3 == 0
+			case 6:
+				flip = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				flip = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if flip && !q.isFunc[y][x] {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the symbol by the 4 rules, lower for easier scanning
+func (q *QR) penalty() (score int) {
+	finderLike := [][]bool{
+		{true, false, true, true, true, false, true, false, false, false, false},
+		{false, false, false, false, true, false, true, true, true, false, true}}
+
+	line := make([]bool, q.Size)
+	for pass := 0; pass < 2; pass++ { // rows, then columns
+		for a := 0; a < q.Size; a++ {
+			for b := 0; b < q.Size; b++ {
+				if pass == 0 {
+					line[b] = q.modules[a][b]
+				} else {
+					line[b] = q.modules[b][a]
+				}
+			}
+
+			// runs of 5 or more modules of the same color
+			run := 1
+			for b := 1; b <= q.Size; b++ {
+				if b < q.Size && line[b] == line[b-1] {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += 3 + run - 5
+				}
+				run = 1
+			}
+
+			// patterns like the finders
+			for b := 0; b+11 <= q.Size; b++ {
+				for _, pattern := range finderLike {
+					match := true
+					for k, dark := range pattern {
+						if line[b+k] != dark {
+							match = false
+							break
+						}
+					}
+					if match {
+						score += 40
+					}
+				}
+			}
+		}
+	}
+
+	// 2x2 blocks of the same color, and the balance of the dark modules
+	dark := 0
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			if q.modules[y][x] {
+				dark++
+			}
+			if x > 0 && y > 0 {
+				c := q.modules[y][x]
+				if c == q.modules[y-1][x] && c == q.modules[y][x-1] && c == q.modules[y-1][x-1] {
+					score += 3
+				}
+			}
+		}
+	}
+	total := q.Size * q.Size
+	k := (absInt(dark*20-total*10)+total-1)/total - 1
+	return score + k*10
+}
+
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func maxInt(x int, y int) int {
+	if x > y {
+		return x
+	}
+	return y
+}
@@ -0,0 +1,70 @@
+package label
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_rsRemainder(t *testing.T) {
+	// the example of version 1-M, "01234567", in ISO/IEC 18004 Annex I
+	data := []byte{0x10, 0x20, 0x0C, 0x56, 0x61, 0x80, 0xEC, 0x11,
+		0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11}
+	want := []byte{0xA5, 0x24, 0xD4, 0xC1, 0xED, 0x36, 0xC7, 0x87, 0x2C, 0x55}
+	if got := rsRemainder(data, rsDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("rsRemainder() = %X, want %X", got, want)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		wantSize int
+		wantErr  bool
+	}{
+		{"version 1", "A@base", 21, false},
+		{"version 3", "Projector 3@Meeting Room#ABCD2345", 29, false},
+		{"version 7, with version info", strings.Repeat("x", 110), 45, false},
+		{"version 10, 16-bit count", strings.Repeat("x", 213), 57, false},
+		{"too long", strings.Repeat("x", 214), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Encode([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Encode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if q.Size != tt.wantSize {
+				t.Errorf("Encode() size = %v, want %v", q.Size, tt.wantSize)
+			}
+
+			// the finders, and the dark module
+			for _, c := range [][2]int{{0, 0}, {q.Size - 7, 0}, {0, q.Size - 7}} {
+				if !q.Dark(c[0], c[1]) || q.Dark(c[0]+1, c[1]+1) || !q.Dark(c[0]+3, c[1]+3) {
+					t.Errorf("Encode() finder at %v is broken", c)
+				}
+			}
+			if !q.Dark(8, q.Size-8) {
+				t.Errorf("Encode() dark module is light")
+			}
+
+			// both copies of the format info are the same
+			for i := 0; i < 7; i++ {
+				if q.Dark(8, q.Size-1-i) != q.Dark(i+boolInt(i >= 6), 8) {
+					t.Errorf("Encode() format info bit %v differs", 14-i)
+				}
+			}
+		})
+	}
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
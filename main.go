@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -21,6 +22,12 @@ func main() {
 	mongoDB := flag.String("mongodb", "", "mongoDB Database name")
 	redisURL := flag.String("redisurl", "", "Redis server URL")
 	redisPass := flag.String("redispass", "", "Redis auth password")
+	labelSecret := flag.String("labelsecret", "", "secret signing the verification tokens on the asset labels, "+
+		"default to the one generated in archive/label-secret")
+	signedScans := flag.Bool("signedscans", false, "refuse the scanned codes without a label's verification token")
+	blobStore := flag.String("blobstore", "local", "where the attached files are kept, local or gridfs")
+	blobDir := flag.String("blobdir", "", "folder of the local blob store, default to archive/attachment")
+	importDir := flag.String("importdir", "", "folder of the local files to import by path, like the booking exports")
 
 	var r net.RestContext
 	c := net.CheckResource{
@@ -34,6 +41,19 @@ func main() {
 	}()
 
 	flag.Parse()
+	if *blobStore != net.BLOB_STORE_LOCAL && *blobStore != net.BLOB_STORE_GRIDFS {
+		log.Panicln("unknown blob store " + *blobStore + ", should be local or gridfs")
+	}
+	if flag.Arg(0) == "fsck" { // readygo [flags] fsck [--fix]
+		r = net.BakCtx
+		for _, o := range []struct{ flag, field *string }{
+			{mongoURI, &r.MongoURI}, {mongoDB, &r.MongoDBName}, {redisURL, &r.RedisURL}, {redisPass, &r.RedisPass}} {
+			if *o.flag != "" {
+				*o.field = *o.flag
+			}
+		}
+		os.Exit(fsck(&r, flag.Args()[1:]))
+	}
 	if *demo || *sample {
 		if *demo {
 			r = net.RCTest
@@ -80,6 +100,20 @@ func main() {
 	if *redisPass != "" {
 		r.RedisPass = *redisPass
 	}
+	if *labelSecret != "" {
+		r.LabelSecret = *labelSecret
+	}
+	if err := r.LoadLabelSecret(""); err != nil {
+		log.Panicln("cannot load the label secret:", err)
+	}
+	r.SignedScans = *signedScans
+	r.BlobStore = *blobStore
+	if *blobDir != "" {
+		r.BlobDir = *blobDir
+	}
+	r.ImportDir = *importDir
+
+	go net.NewScheduler(&r).Run(nil) // generates the sessions of the inspection plans
 
 	restful.DefaultContainer.Add(c.WebService(&r))
 	config := restfulspec.Config{
@@ -94,3 +128,29 @@ func main() {
 	server := &http.Server{Addr: ":8043", Handler: restful.DefaultContainer}
 	log.Panicln(server.ListenAndServeTLS(r.CrtPath, r.KeyPath))
 }
+
+// fsck checks the spaces, the assets and their cache, and fixes the problems if asked;
+// it returns the exit code, 1 if any problem is left
+func fsck(r *net.RestContext, args []string) int {
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	fix := fs.Bool("fix", false, "fix the problems found: delete the duplicates and the stale cache, reset the "+
+		"invalid numbers, and move the orphans and the cycles into "+net.LOST_FOUND)
+	fs.Parse(args)
+
+	if err := r.ConnectDB(); err != nil {
+		log.Println("cannot connect to the DB servers")
+		return 2
+	}
+	report, _, err := r.Fsck(*fix)
+	if err != nil {
+		log.Println(err)
+		return 2
+	}
+	fmt.Print(report)
+	for _, p := range report.Problems {
+		if !p.Fixed {
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,414 @@
+// Files attached to the Assets and the check results in the Sessions, like photos and invoices
+
+package net
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	_ "image/gif" // decodes the gif thumbnails
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/image/draw"
+)
+
+/*
+MongoDB collection structure:
+readygo(DB): {
+	Attachment(Collection): {
+		id: "",
+		name: "",
+		base: "",
+		sessionid: "",
+		filename: "",
+		contenttype: "",
+		size: 0,
+		created: ISODate(),
+		thumbnail: false
+	}
+}*/
+
+// MAX_ATTACHMENT_BYTES limits the size of an attached file, 10M
+const MAX_ATTACHMENT_BYTES = 10 << 20
+
+// the longest side of a thumbnail, in pixels
+const THUMBNAIL_SIZE = 200
+
+// MAX_THUMBNAIL_PIXELS limits the pictures decoded for the thumbnails, as a small file may
+// declare a huge canvas
+const MAX_THUMBNAIL_PIXELS = 40 << 20
+
+// the multipart form around the attached file, beyond MAX_ATTACHMENT_BYTES
+const MAX_FORM_OVERHEAD = 1 << 20
+
+// ATTACHMENT_TYPES are the MIME types allowed to attach, and whether they have thumbnails
+var ATTACHMENT_TYPES = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"application/pdf": false,
+	"text/plain":      false,
+}
+
+// Attachment is a file attached to an Asset, or to its check result in a Session
+type Attachment struct {
+	ID          string    `json:"id" description:"unique id of the attachment, set by the server"`
+	Name        string    `json:"name" description:"the asset's name"`
+	Base        string    `json:"base" description:"the asset's base space"`
+	SessionID   string    `json:"sessionId,omitempty" description:"the session whose check result it is attached to, if any"`
+	FileName    string    `json:"fileName" description:"the uploaded file's name"`
+	ContentType string    `json:"contentType" description:"the MIME type detected from the content"`
+	Size        int64     `json:"size" description:"size of the file in bytes"`
+	Created     time.Time `json:"created" description:"the time when it was attached"`
+	Thumbnail   bool      `json:"thumbnail" description:"whether it has a thumbnail, for the images"`
+}
+
+// thumbnailID is the blob id of the Attachment's thumbnail
+func (a Attachment) thumbnailID() string {
+	return a.ID + "-thumb"
+}
+
+// detectContentType sniffs the MIME type from the content, ignoring the client's claim
+func detectContentType(data []byte) string {
+	contentType := http.DetectContentType(data)
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mediaType
+	}
+	return contentType
+}
+
+// checkAttachment validates the size and the type of the file
+func checkAttachment(size int64, contentType string) (errCode int, err error) {
+	if size > MAX_ATTACHMENT_BYTES {
+		return http.StatusRequestEntityTooLarge,
+			errors.New("the file should be at most " + strconv.Itoa(MAX_ATTACHMENT_BYTES) + " bytes")
+	}
+	if size == 0 {
+		return http.StatusNotAcceptable, errors.New("the file is empty")
+	}
+	if _, ok := ATTACHMENT_TYPES[contentType]; !ok {
+		return http.StatusUnsupportedMediaType, errors.New("the file of type " + contentType + " cannot be attached")
+	}
+	return http.StatusOK, nil
+}
+
+// thumbnailSize fits the picture into the square of THUMBNAIL_SIZE keeping its ratio, never enlarging it
+func thumbnailSize(width int, height int) (int, int) {
+	if width <= THUMBNAIL_SIZE && height <= THUMBNAIL_SIZE {
+		return width, height
+	}
+	if width >= height {
+		h := height * THUMBNAIL_SIZE / width
+		if h < 1 {
+			h = 1
+		}
+		return THUMBNAIL_SIZE, h
+	}
+	w := width * THUMBNAIL_SIZE / height
+	if w < 1 {
+		w = 1
+	}
+	return w, THUMBNAIL_SIZE
+}
+
+// makeThumbnail scales the picture down, encoded as PNG; the pictures of more than
+// MAX_THUMBNAIL_PIXELS are refused before decoding
+func makeThumbnail(data []byte) ([]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || int64(config.Width)*int64(config.Height) > MAX_THUMBNAIL_PIXELS {
+		return nil, errors.New("the picture of " + strconv.Itoa(config.Width) + "x" + strconv.Itoa(config.Height) +
+			" pixels is too large for a thumbnail")
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	w, h := thumbnailSize(src.Bounds().Dx(), src.Bounds().Dy())
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err = png.Encode(&buf, dst); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readAttachment reads the form file "file" of the request, and validates it; the body
+// larger than the form can be is cut before it is read or spilled to the disk
+func readAttachment(req *restful.Request, resp *restful.Response) (a Attachment, data []byte, errCode int, err error) {
+	req.Request.Body = http.MaxBytesReader(resp.ResponseWriter, req.Request.Body, MAX_ATTACHMENT_BYTES+MAX_FORM_OVERHEAD)
+	if err = req.Request.ParseMultipartForm(MAX_ATTACHMENT_BYTES); err != nil {
+		log.Printf("error during reading form @readAttachment: %v\n", err)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return a, nil, http.StatusRequestEntityTooLarge,
+				errors.New("the file should be at most " + strconv.Itoa(MAX_ATTACHMENT_BYTES) + " bytes")
+		}
+		return a, nil, http.StatusNotAcceptable, err
+	}
+	file, header, err := req.Request.FormFile("file")
+	if err != nil {
+		log.Printf("error during reading form @readAttachment: %v\n", err)
+		return a, nil, http.StatusNotAcceptable, err
+	}
+	defer file.Close()
+	if header.Size > MAX_ATTACHMENT_BYTES { // rejects it before reading
+		return a, nil, http.StatusRequestEntityTooLarge,
+			errors.New("the file should be at most " + strconv.Itoa(MAX_ATTACHMENT_BYTES) + " bytes")
+	}
+
+	// reads one more byte to tell a file larger than the header says
+	if data, err = ioutil.ReadAll(io.LimitReader(file, MAX_ATTACHMENT_BYTES+1)); err != nil {
+		log.Println(err)
+		return a, nil, http.StatusInternalServerError, err
+	}
+	a = Attachment{
+		ID:          primitive.NewObjectID().Hex(),
+		FileName:    header.Filename,
+		ContentType: detectContentType(data),
+		Size:        int64(len(data)),
+		Created:     time.Now()}
+	if errCode, err = checkAttachment(a.Size, a.ContentType); err != nil {
+		return a, nil, errCode, err
+	}
+	return a, data, http.StatusOK, nil
+}
+
+// dbInsertAttachment stores the file and its thumbnail in the blob store, then the Attachment;
+// the blobs are removed if it fails
+func (r RestContext) dbInsertAttachment(a *Attachment, data []byte) (errCode int, err error) {
+	store := r.blobStore()
+	if _, errCode, err = store.Put(a.ID, a.ContentType, bytes.NewReader(data)); err != nil {
+		return errCode, err
+	}
+
+	if ATTACHMENT_TYPES[a.ContentType] {
+		if thumb, err := makeThumbnail(data); err != nil {
+			log.Println(err) // kept without the thumbnail
+		} else if _, _, err := store.Put(a.thumbnailID(), "image/png", bytes.NewReader(thumb)); err != nil {
+			log.Println(err)
+		} else {
+			a.Thumbnail = true
+		}
+	}
+
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+	if _, err = r.mongoDB.Collection("attachment").InsertOne(ctx, *a); err != nil {
+		log.Println(err)
+		store.Delete(a.ID)
+		if a.Thumbnail {
+			store.Delete(a.thumbnailID())
+		}
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusCreated, nil
+}
+
+// dbGetAttachment finds the Attachment by id
+func (r RestContext) dbGetAttachment(id string) (result *Attachment, errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+
+	result = new(Attachment)
+	if err = r.mongoDB.Collection("attachment").FindOne(ctx, bson.M{"id": id}).Decode(result); err != nil {
+		log.Println(err)
+		return nil, http.StatusNotFound, err
+	}
+	return result, http.StatusOK, nil
+}
+
+// dbFindAttachments lists the Attachments matching the filter, latest first
+func (r RestContext) dbFindAttachments(filter bson.M) (list []Attachment, errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cf()
+
+	cur, err := r.mongoDB.Collection("attachment").Find(ctx, filter, options.Find().SetSort(bson.D{{"created", -1}}))
+	if err != nil {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, err
+	}
+	defer cur.Close(ctx)
+
+	list = []Attachment{}
+	for cur.Next(ctx) {
+		var a Attachment
+		if err = cur.Decode(&a); err != nil {
+			log.Println(err)
+			return nil, http.StatusInternalServerError, err
+		}
+		list = append(list, a)
+	}
+	return list, http.StatusOK, nil
+}
+
+// dbDeleteAttachment removes the Attachment, then its blobs
+func (r RestContext) dbDeleteAttachment(a Attachment) (errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+
+	deleteResult, err := r.mongoDB.Collection("attachment").DeleteOne(ctx, bson.M{"id": a.ID})
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, err
+	}
+	if deleteResult.DeletedCount == 0 {
+		return http.StatusNotFound, errors.New("the attachment does not exist")
+	}
+
+	store := r.blobStore()
+	if _, err := store.Delete(a.ID); err != nil {
+		log.Println(err) // the attachment is gone anyway
+	}
+	if a.Thumbnail {
+		if _, err := store.Delete(a.thumbnailID()); err != nil {
+			log.Println(err)
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// writeAttachment reads the form file and attaches it
+func (r RestContext) writeAttachment(a Attachment, req *restful.Request, resp *restful.Response) {
+	uploaded, data, errCode, err := readAttachment(req, resp)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	uploaded.Name, uploaded.Base, uploaded.SessionID = a.Name, a.Base, a.SessionID
+
+	if errCode, err := r.dbInsertAttachment(&uploaded, data); err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusCreated, uploaded)
+}
+
+// POST PREFIX/spaces/{space-name}/assets/{asset-name}/attachments
+// form: {name: "file" ...}
+func (r RestContext) createAssetAttachment(req *restful.Request, resp *restful.Response) {
+	as, errCode, err := r.dbGetAsset(req.PathParameter("asset-name"), req.PathParameter("space-name"), true)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	r.writeAttachment(Attachment{Name: as.Name, Base: as.Base}, req, resp)
+}
+
+// GET PREFIX/spaces/{space-name}/assets/{asset-name}/attachments?all=false
+func (r RestContext) findAssetAttachments(req *restful.Request, resp *restful.Response) {
+	filter := bson.M{"name": req.PathParameter("asset-name"), "base": req.PathParameter("space-name")}
+	if all, _ := strconv.ParseBool(req.QueryParameter("all")); !all { // not the ones of the check results
+		filter["sessionid"] = ""
+	}
+
+	list, errCode, err := r.dbFindAttachments(filter)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, list)
+}
+
+// POST PREFIX/sessions/{session-id}/stops/{space-name}/{asset-name}/attachments
+// form: {name: "file" ...}
+func (r RestContext) createStopAttachment(req *restful.Request, resp *restful.Response) {
+	spaceName := req.PathParameter("space-name")
+	assetName := req.PathParameter("asset-name")
+
+	s, errCode, err := r.dbGetSession(req.PathParameter("session-id"))
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	if s.stopIndex(assetName, spaceName) < 0 {
+		resp.WriteError(http.StatusNotFound, errors.New("the asset is not a stop of the session"))
+		return
+	}
+	r.writeAttachment(Attachment{Name: assetName, Base: spaceName, SessionID: s.ID}, req, resp)
+}
+
+// GET PREFIX/sessions/{session-id}/stops/{space-name}/{asset-name}/attachments
+func (r RestContext) findStopAttachments(req *restful.Request, resp *restful.Response) {
+	list, errCode, err := r.dbFindAttachments(bson.M{
+		"sessionid": req.PathParameter("session-id"),
+		"name":      req.PathParameter("asset-name"),
+		"base":      req.PathParameter("space-name")})
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, list)
+}
+
+// writeBlob sends the blob as the file download
+func (r RestContext) writeBlob(id string, fileName string, contentType string, resp *restful.Response) {
+	rc, errCode, err := r.blobStore().Get(id)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	defer rc.Close()
+
+	resp.AddHeader("Content-Type", contentType)
+	resp.AddHeader("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": fileName}))
+	resp.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(resp, rc); err != nil {
+		log.Println(err) // the header is sent already
+	}
+}
+
+// GET PREFIX/attachments/{attachment-id}
+func (r RestContext) downloadAttachment(req *restful.Request, resp *restful.Response) {
+	a, errCode, err := r.dbGetAttachment(req.PathParameter("attachment-id"))
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	r.writeBlob(a.ID, a.FileName, a.ContentType, resp)
+}
+
+// GET PREFIX/attachments/{attachment-id}/thumbnail
+func (r RestContext) downloadThumbnail(req *restful.Request, resp *restful.Response) {
+	a, errCode, err := r.dbGetAttachment(req.PathParameter("attachment-id"))
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	if !a.Thumbnail {
+		resp.WriteError(http.StatusNotFound, errors.New("the attachment has no thumbnail"))
+		return
+	}
+	r.writeBlob(a.thumbnailID(), "thumbnail-"+a.ID+".png", "image/png", resp)
+}
+
+// DELETE PREFIX/attachments/{attachment-id}
+func (r RestContext) deleteAttachment(req *restful.Request, resp *restful.Response) {
+	a, errCode, err := r.dbGetAttachment(req.PathParameter("attachment-id"))
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	if errCode, err := r.dbDeleteAttachment(*a); err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeader(http.StatusOK)
+}
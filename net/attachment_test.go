@@ -0,0 +1,122 @@
+package net
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+)
+
+func Test_checkAttachment(t *testing.T) {
+	tests := []struct {
+		size        int64
+		contentType string
+		want        int
+	}{
+		{1024, "image/jpeg", http.StatusOK},
+		{1024, "application/pdf", http.StatusOK},
+		{MAX_ATTACHMENT_BYTES + 1, "image/png", http.StatusRequestEntityTooLarge},
+		{0, "text/plain", http.StatusNotAcceptable},
+		{1024, "application/zip", http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		if got, _ := checkAttachment(tt.size, tt.contentType); got != tt.want {
+			t.Errorf("checkAttachment(%v, %v) = %v, want %v", tt.size, tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func Test_detectContentType(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want string
+	}{
+		{[]byte("%PDF-1.4\n"), "application/pdf"},
+		{[]byte("serial: 1234\n"), "text/plain"},
+		{[]byte("PK\x03\x04"), "application/zip"},
+	}
+	for _, tt := range tests {
+		if got := detectContentType(tt.data); got != tt.want {
+			t.Errorf("detectContentType(%q) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func Test_thumbnailSize(t *testing.T) {
+	tests := []struct {
+		width, height int
+		wantW, wantH  int
+	}{
+		{100, 50, 100, 50},
+		{800, 600, 200, 150},
+		{600, 800, 150, 200},
+		{4000, 10, 200, 1},
+	}
+	for _, tt := range tests {
+		if w, h := thumbnailSize(tt.width, tt.height); w != tt.wantW || h != tt.wantH {
+			t.Errorf("thumbnailSize(%v, %v) = %v, %v, want %v, %v", tt.width, tt.height, w, h, tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func Test_makeThumbnail(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	for x := 0; x < 400; x++ {
+		src.Set(x, 150, color.Black)
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, src)
+
+	thumb, err := makeThumbnail(buf.Bytes())
+	if err != nil {
+		t.Fatalf("makeThumbnail() error = %v", err)
+	}
+	got, err := png.Decode(bytes.NewReader(thumb))
+	if err != nil {
+		t.Fatalf("makeThumbnail() is not a PNG: %v", err)
+	}
+	if got.Bounds().Dx() != 200 || got.Bounds().Dy() != 150 {
+		t.Errorf("makeThumbnail() = %v, want 200 x 150", got.Bounds())
+	}
+
+	if _, err := makeThumbnail([]byte("not a picture")); err == nil {
+		t.Errorf("makeThumbnail() of text should fail")
+	}
+}
+
+func Test_makeThumbnail_hugeCanvas(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1)))
+	data := buf.Bytes()
+	// IHDR right after the signature: length, type, width, height, ..., then its CRC
+	binary.BigEndian.PutUint32(data[16:], 100000)
+	binary.BigEndian.PutUint32(data[20:], 100000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+
+	if _, err := makeThumbnail(data); err == nil {
+		t.Errorf("makeThumbnail() of a 100000 x 100000 canvas should fail")
+	}
+}
+
+func Test_readAttachment_tooLarge(t *testing.T) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, _ := w.CreateFormFile("file", "huge.txt")
+	part.Write(bytes.Repeat([]byte("a"), MAX_ATTACHMENT_BYTES+MAX_FORM_OVERHEAD))
+	w.Close()
+
+	httpReq := httptest.NewRequest(http.MethodPost, "/v1/spaces/base/assets/A/attachments", &body)
+	httpReq.Header.Set("Content-Type", w.FormDataContentType())
+	_, _, errCode, err := readAttachment(restful.NewRequest(httpReq), restful.NewResponse(httptest.NewRecorder()))
+	if err == nil || errCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("readAttachment() = %v, %v, want %v", errCode, err, http.StatusRequestEntityTooLarge)
+	}
+}
@@ -0,0 +1,301 @@
+// Blob stores keeping the attached files: a local directory, or GridFS in MongoDB
+
+package net
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+MongoDB collection structure of GridFS, compatible with the drivers and mongofiles:
+readygo(DB): {
+	fs.files(Collection): {
+		_id: "", // blob id
+		length: 0,
+		chunkSize: 261120,
+		uploadDate: ISODate(),
+		filename: "",
+		contentType: ""
+	},
+	fs.chunks(Collection): {
+		_id: ObjectId(),
+		files_id: "",
+		n: 0,
+		data: BinData()
+	}
+}*/
+
+// the blob store backends, by RestContext.BlobStore
+const (
+	BLOB_STORE_LOCAL  = "local"
+	BLOB_STORE_GRIDFS = "gridfs"
+)
+
+// GRIDFS_CHUNK_SIZE is the default chunk size of GridFS, 255 KiB
+const GRIDFS_CHUNK_SIZE = 255 * 1024
+
+// BlobStore keeps the file contents by their ids
+type BlobStore interface {
+	Put(id string, contentType string, r io.Reader) (size int64, errCode int, err error)
+	Get(id string) (rc io.ReadCloser, errCode int, err error)
+	Delete(id string) (errCode int, err error)
+}
+
+// blobIDPattern keeps the ids from escaping the local directory
+var blobIDPattern = regexp.MustCompile(`^[0-9A-Za-z_-]+$`)
+
+// blobStore makes the blob store configured, the local directory by default
+func (r RestContext) blobStore() BlobStore {
+	if r.BlobStore == BLOB_STORE_GRIDFS {
+		return gridfsStore{db: r.mongoDB, bucket: "fs", chunkSize: GRIDFS_CHUNK_SIZE}
+	}
+	dir := r.BlobDir
+	if dir == "" {
+		dir = strings.Join([]string{os.Getenv("GOPATH"), "src", "github.com",
+			"miosolo", "readygo", "archive", "attachment"}, string(os.PathSeparator))
+	}
+	return localStore{dir: dir}
+}
+
+// localStore keeps every blob as a file named by its id in the directory
+type localStore struct {
+	dir string
+}
+
+func (s localStore) path(id string) (string, error) {
+	if !blobIDPattern.MatchString(id) {
+		return "", errors.New("invalid blob id " + id)
+	}
+	return strings.Join([]string{s.dir, id}, string(os.PathSeparator)), nil
+}
+
+// Put writes the blob, replacing the old one of the id
+func (s localStore) Put(id string, contentType string, r io.Reader) (size int64, errCode int, err error) {
+	path, err := s.path(id)
+	if err != nil {
+		return 0, http.StatusNotAcceptable, err
+	}
+	os.MkdirAll(s.dir, os.ModePerm) // ensure the folder exists
+
+	f, err := os.Create(path)
+	if err != nil {
+		log.Println(err)
+		return 0, http.StatusInternalServerError, err
+	}
+	defer f.Close()
+	if size, err = io.Copy(f, r); err != nil {
+		log.Println(err)
+		os.Remove(path)
+		return 0, http.StatusInternalServerError, err
+	}
+	return size, http.StatusCreated, nil
+}
+
+// Get opens the blob
+func (s localStore) Get(id string) (rc io.ReadCloser, errCode int, err error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, http.StatusNotAcceptable, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, http.StatusNotFound, errors.New("the blob " + id + " does not exist")
+	} else if err != nil {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, err
+	}
+	return f, http.StatusOK, nil
+}
+
+// Delete removes the blob
+func (s localStore) Delete(id string) (errCode int, err error) {
+	path, err := s.path(id)
+	if err != nil {
+		return http.StatusNotAcceptable, err
+	}
+	if err = os.Remove(path); os.IsNotExist(err) {
+		return http.StatusNotFound, errors.New("the blob " + id + " does not exist")
+	} else if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// gridfsStore keeps the blobs in the GridFS bucket, as files split into the chunks
+type gridfsStore struct {
+	db        *mongo.Database
+	bucket    string
+	chunkSize int
+}
+
+// gridfsFile is a document of the files collection
+type gridfsFile struct {
+	ID          string    `bson:"_id"`
+	Length      int64     `bson:"length"`
+	ChunkSize   int32     `bson:"chunkSize"`
+	UploadDate  time.Time `bson:"uploadDate"`
+	Filename    string    `bson:"filename"`
+	ContentType string    `bson:"contentType,omitempty"`
+}
+
+// gridfsChunk is a document of the chunks collection
+type gridfsChunk struct {
+	ID      primitive.ObjectID `bson:"_id"`
+	FilesID string             `bson:"files_id"`
+	N       int32              `bson:"n"`
+	Data    []byte             `bson:"data"`
+}
+
+// splitChunks reads r to the end in the chunks of the size, and emits them in order
+func splitChunks(r io.Reader, size int, emit func(n int32, data []byte) error) (length int64, err error) {
+	buf := make([]byte, size)
+	for n := int32(0); ; n++ {
+		read, err := io.ReadFull(r, buf)
+		if read > 0 {
+			if err := emit(n, append([]byte(nil), buf[:read]...)); err != nil {
+				return length, err
+			}
+			length += int64(read)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return length, nil
+		} else if err != nil {
+			return length, err
+		}
+	}
+}
+
+// Put writes the chunks first, then the file which makes it visible; the old blob of the id is replaced
+func (s gridfsStore) Put(id string, contentType string, r io.Reader) (size int64, errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cf()
+
+	if errCode, err := s.Delete(id); err != nil && errCode != http.StatusNotFound {
+		return 0, errCode, err
+	}
+	chunks := s.db.Collection(s.bucket + ".chunks")
+	size, err = splitChunks(r, s.chunkSize, func(n int32, data []byte) error {
+		_, err := chunks.InsertOne(ctx, gridfsChunk{ID: primitive.NewObjectID(), FilesID: id, N: n, Data: data})
+		return err
+	})
+	if err == nil {
+		_, err = s.db.Collection(s.bucket+".files").InsertOne(ctx, gridfsFile{
+			ID: id, Length: size, ChunkSize: int32(s.chunkSize), UploadDate: time.Now(), Filename: id,
+			ContentType: contentType})
+	}
+	if err != nil {
+		log.Println(err)
+		chunks.DeleteMany(ctx, bson.M{"files_id": id}) // no orphaned chunks
+		return 0, http.StatusInternalServerError, err
+	}
+	return size, http.StatusCreated, nil
+}
+
+// chunkCursor iterates the chunks, like *mongo.Cursor
+type chunkCursor interface {
+	Next(ctx context.Context) bool
+	Decode(val interface{}) error
+	Err() error
+	Close(ctx context.Context) error
+}
+
+// chunkReader reads the file from its chunks in order, checking none is missing
+type chunkReader struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	cur    chunkCursor
+	length int64 // bytes left in the file
+	n      int32 // the next chunk expected
+	buf    *bytes.Reader
+}
+
+func (cr *chunkReader) Read(p []byte) (int, error) {
+	for cr.buf == nil || cr.buf.Len() == 0 {
+		if cr.length <= 0 {
+			return 0, io.EOF
+		}
+		if !cr.cur.Next(cr.ctx) {
+			if err := cr.cur.Err(); err != nil {
+				return 0, err
+			}
+			return 0, io.ErrUnexpectedEOF
+		}
+		var chunk gridfsChunk
+		if err := cr.cur.Decode(&chunk); err != nil {
+			return 0, err
+		}
+		if chunk.N != cr.n {
+			return 0, errors.New("the chunks of the blob are broken")
+		}
+		cr.n++
+		cr.buf = bytes.NewReader(chunk.Data)
+	}
+
+	read, err := cr.buf.Read(p)
+	cr.length -= int64(read)
+	return read, err
+}
+
+func (cr *chunkReader) Close() error {
+	defer cr.cancel()
+	return cr.cur.Close(cr.ctx)
+}
+
+// Get finds the file, and reads its chunks as they are needed
+func (s gridfsStore) Get(id string) (rc io.ReadCloser, errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 5*time.Minute)
+
+	var file gridfsFile
+	if err = s.db.Collection(s.bucket+".files").FindOne(ctx, bson.M{"_id": id}).Decode(&file); err != nil {
+		cf()
+		if err == mongo.ErrNoDocuments {
+			return nil, http.StatusNotFound, errors.New("the blob " + id + " does not exist")
+		}
+		log.Println(err)
+		return nil, http.StatusInternalServerError, err
+	}
+
+	cur, err := s.db.Collection(s.bucket+".chunks").Find(ctx, bson.M{"files_id": id},
+		options.Find().SetSort(bson.D{{"n", 1}}))
+	if err != nil {
+		cf()
+		log.Println(err)
+		return nil, http.StatusInternalServerError, err
+	}
+	return &chunkReader{ctx: ctx, cancel: cf, cur: cur, length: file.Length}, http.StatusOK, nil
+}
+
+// Delete removes the file first so that it disappears at once, then its chunks
+func (s gridfsStore) Delete(id string) (errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cf()
+
+	deleteResult, err := s.db.Collection(s.bucket+".files").DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, err
+	}
+	if _, err = s.db.Collection(s.bucket+".chunks").DeleteMany(ctx, bson.M{"files_id": id}); err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, err
+	}
+	if deleteResult.DeletedCount == 0 {
+		return http.StatusNotFound, errors.New("the blob " + id + " does not exist")
+	}
+	return http.StatusOK, nil
+}
@@ -0,0 +1,118 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_localStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "readygo-blob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := localStore{dir: dir}
+
+	if size, _, err := s.Put("5d1f-a", "text/plain", strings.NewReader("hello")); err != nil || size != 5 {
+		t.Errorf("localStore.Put() = %v, %v, want 5", size, err)
+	}
+	rc, _, err := s.Get("5d1f-a")
+	if err != nil {
+		t.Fatalf("localStore.Get() error = %v", err)
+	}
+	got, _ := ioutil.ReadAll(rc)
+	rc.Close()
+	if string(got) != "hello" {
+		t.Errorf("localStore.Get() = %v, want hello", string(got))
+	}
+
+	if _, err := s.Delete("5d1f-a"); err != nil {
+		t.Errorf("localStore.Delete() error = %v", err)
+	}
+	if _, errCode, _ := s.Get("5d1f-a"); errCode != http.StatusNotFound {
+		t.Errorf("localStore.Get() deleted = %v, want %v", errCode, http.StatusNotFound)
+	}
+	if _, errCode, _ := s.Put("../escape", "text/plain", strings.NewReader("x")); errCode != http.StatusNotAcceptable {
+		t.Errorf("localStore.Put() invalid id = %v, want %v", errCode, http.StatusNotAcceptable)
+	}
+}
+
+func Test_splitChunks(t *testing.T) {
+	tests := []struct {
+		data string
+		size int
+		want []string
+	}{
+		{"", 4, nil},
+		{"abcd", 4, []string{"abcd"}},
+		{"abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		length, err := splitChunks(strings.NewReader(tt.data), tt.size, func(n int32, data []byte) error {
+			if int(n) != len(got) {
+				return errors.New("out of order")
+			}
+			got = append(got, string(data))
+			return nil
+		})
+		if err != nil || length != int64(len(tt.data)) || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitChunks(%v) = %v, %v, %v, want %v", tt.data, got, length, err, tt.want)
+		}
+	}
+}
+
+// fakeCursor iterates the chunks in memory
+type fakeCursor struct {
+	chunks []gridfsChunk
+	i      int
+}
+
+func (c *fakeCursor) Next(ctx context.Context) bool {
+	c.i++
+	return c.i <= len(c.chunks)
+}
+
+func (c *fakeCursor) Decode(val interface{}) error {
+	*val.(*gridfsChunk) = c.chunks[c.i-1]
+	return nil
+}
+
+func (c *fakeCursor) Err() error                      { return nil }
+func (c *fakeCursor) Close(ctx context.Context) error { return nil }
+
+func Test_chunkReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		chunks  []gridfsChunk
+		length  int64
+		want    string
+		wantErr bool
+	}{
+		{"whole", []gridfsChunk{{N: 0, Data: []byte("abcd")}, {N: 1, Data: []byte("ef")}}, 6, "abcdef", false},
+		{"empty", nil, 0, "", false},
+		{"missing chunk", []gridfsChunk{{N: 0, Data: []byte("abcd")}, {N: 2, Data: []byte("ef")}}, 6, "", true},
+		{"truncated", []gridfsChunk{{N: 0, Data: []byte("abcd")}}, 6, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &chunkReader{ctx: context.Background(), cancel: func() {}, cur: &fakeCursor{chunks: tt.chunks}, length: tt.length}
+			var buf bytes.Buffer
+			_, err := io.Copy(&buf, cr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("chunkReader.Read() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && buf.String() != tt.want {
+				t.Errorf("chunkReader.Read() = %v, want %v", buf.String(), tt.want)
+			}
+		})
+	}
+}
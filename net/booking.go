@@ -0,0 +1,629 @@
+// Room bookings imported from iCalendar exports, keeping the routes out of meetings
+
+package net
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+MongoDB collection structure:
+readygo(DB): {
+	Booking(Collection): {
+		space: "",
+		uid: "",
+		summary: "",
+		start: ISODate(),
+		end: ISODate(),
+		rule: "FREQ=WEEKLY;BYDAY=MO",
+		except: [ISODate()],
+		zone: "Asia/Shanghai"
+	}
+}*/
+
+// DEFAULT_VISIT_MINUTES is how long a route is supposed to take when checking the bookings
+const DEFAULT_VISIT_MINUTES = 60
+
+// MAX_OCCURRENCES limits the slots a recurring booking repeats in one window
+const MAX_OCCURRENCES = 1000
+
+// Booking is a slot when the space is occupied
+type Booking struct {
+	Space   string      `json:"space" description:"the space booked"`
+	UID     string      `json:"uid" description:"the event's uid in the calendar"`
+	Summary string      `json:"summary" description:"the event's summary, like the meeting's title"`
+	Start   time.Time   `json:"start" description:"the start of the booked slot, the first one if recurring"`
+	End     time.Time   `json:"end" description:"the end of the booked slot"`
+	Rule    string      `json:"rule,omitempty" description:"the RRULE repeating the slot, like FREQ=WEEKLY;BYDAY=MO,WE"`
+	Except  []time.Time `json:"except,omitempty" description:"the starts of the repetitions cancelled (EXDATE)"`
+	Zone    string      `json:"zone,omitempty" description:"the time zone the slot repeats in, keeping its wall clock"`
+}
+
+// recurrence is the supported part of an RRULE: FREQ of DAILY, WEEKLY, MONTHLY or YEARLY,
+// INTERVAL, COUNT, UNTIL, and BYDAY of plain weekdays for WEEKLY
+type recurrence struct {
+	freq     string
+	interval int
+	count    int
+	until    time.Time
+	weekdays []time.Weekday // from Monday on
+}
+
+var icsWeekdays = map[string]time.Weekday{"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday}
+
+// sinceMonday is how many days the weekday is after Monday
+func sinceMonday(d time.Weekday) int {
+	return (int(d) + 6) % 7
+}
+
+// parseRecurrence parses the RRULE value, refusing the parts not supported
+func parseRecurrence(rule string) (rec recurrence, err error) {
+	rec.interval = 1
+	for _, part := range strings.Split(rule, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return rec, errors.New("invalid recurrence " + rule)
+		}
+		switch value := strings.ToUpper(kv[1]); strings.ToUpper(kv[0]) {
+		case "FREQ":
+			rec.freq = value
+		case "INTERVAL":
+			if rec.interval, err = strconv.Atoi(value); err != nil || rec.interval <= 0 {
+				return rec, errors.New("invalid recurrence interval " + value)
+			}
+		case "COUNT":
+			if rec.count, err = strconv.Atoi(value); err != nil || rec.count <= 0 {
+				return rec, errors.New("invalid recurrence count " + value)
+			}
+		case "UNTIL":
+			if rec.until, _, err = parseIcsTime(value, nil); err != nil {
+				return rec, errors.New("invalid recurrence end " + value)
+			}
+		case "BYDAY":
+			seen := make(map[time.Weekday]bool)
+			for _, code := range strings.Split(value, ",") {
+				d, ok := icsWeekdays[code]
+				if !ok {
+					return rec, errors.New("unsupported recurrence day " + code)
+				}
+				seen[d] = true
+			}
+			for d := range seen {
+				rec.weekdays = append(rec.weekdays, d)
+			}
+			sort.Slice(rec.weekdays, func(i, j int) bool {
+				return sinceMonday(rec.weekdays[i]) < sinceMonday(rec.weekdays[j])
+			})
+		case "WKST":
+			// the weeks start on Monday
+		default:
+			return rec, errors.New("unsupported recurrence part " + kv[0])
+		}
+	}
+
+	switch rec.freq {
+	case "DAILY", "MONTHLY", "YEARLY":
+		if rec.weekdays != nil {
+			return rec, errors.New("BYDAY is supported only for weekly recurrences")
+		}
+	case "WEEKLY":
+	default:
+		return rec, errors.New("unsupported recurrence frequency " + rec.freq)
+	}
+	return rec, nil
+}
+
+// occurrences lists the slots of the Booking overlapping [from, to): itself, or its repetitions
+// by the rule, at most MAX_OCCURRENCES of them
+func (b Booking) occurrences(from time.Time, to time.Time) (list []Booking, err error) {
+	list = []Booking{}
+	if b.Rule == "" {
+		if b.Start.Before(to) && b.End.After(from) {
+			list = append(list, b)
+		}
+		return list, nil
+	}
+	rec, err := parseRecurrence(b.Rule)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := time.UTC
+	if b.Zone != "" {
+		if loc, err = time.LoadLocation(b.Zone); err != nil {
+			return nil, err
+		}
+	}
+	start, length := b.Start.In(loc), b.End.Sub(b.Start)
+	except := make(map[int64]bool, len(b.Except))
+	for _, t := range b.Except {
+		except[t.Unix()] = true
+	}
+
+	// emit counts the repetition at t, false after the last one
+	n := 0
+	emit := func(t time.Time) bool {
+		if !t.Before(to) || rec.count > 0 && n >= rec.count || !rec.until.IsZero() && t.After(rec.until) ||
+			len(list) >= MAX_OCCURRENCES {
+			return false
+		}
+		n++
+		if !except[t.Unix()] && t.Add(length).After(from) {
+			slot := b
+			slot.Start, slot.End = t, t.Add(length)
+			list = append(list, slot)
+		}
+		return true
+	}
+	at := func(years int, months int, days int) time.Time {
+		return time.Date(start.Year()+years, start.Month()+time.Month(months), start.Day()+days,
+			start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), loc)
+	}
+
+	for i := 0; ; i++ {
+		step := i * rec.interval
+		switch {
+		case rec.freq == "DAILY":
+			if !emit(at(0, 0, step)) {
+				return list, nil
+			}
+		case rec.freq == "WEEKLY" && rec.weekdays == nil:
+			if !emit(at(0, 0, 7*step)) {
+				return list, nil
+			}
+		case rec.freq == "WEEKLY":
+			monday := 7*step - sinceMonday(start.Weekday())
+			for _, d := range rec.weekdays {
+				if t := at(0, 0, monday+sinceMonday(d)); !t.Before(start) && !emit(t) {
+					return list, nil
+				}
+			}
+		default: // MONTHLY or YEARLY, skipping the months without the day, like the 31st
+			t := at(0, step, 0)
+			if rec.freq == "YEARLY" {
+				t = at(step, 0, 0)
+			}
+			if t.Day() != start.Day() {
+				if !t.Before(to) {
+					return list, nil
+				}
+				continue
+			}
+			if !emit(t) {
+				return list, nil
+			}
+		}
+	}
+}
+
+// expandBookings repeats the recurring bookings in [from, to), ordered by start time
+func expandBookings(bookings []Booking, from time.Time, to time.Time) []Booking {
+	list := []Booking{}
+	for _, b := range bookings {
+		slots, err := b.occurrences(from, to)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		list = append(list, slots...)
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Start.Before(list[j].Start) })
+	return list
+}
+
+// bookingFilter matches the bookings of the spaces that may overlap [from, to): the recurring
+// ones starting before to, to be expanded
+func bookingFilter(spaces interface{}, from time.Time, to time.Time) bson.M {
+	return bson.M{"space": spaces, "start": bson.M{"$lt": to},
+		"$or": []bson.M{{"end": bson.M{"$gt": from}}, {"rule": bson.M{"$gt": ""}}}}
+}
+
+var icsDurationRegexp = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseIcsDuration parses the DURATION value like PT1H30M or P1D
+func parseIcsDuration(value string) (time.Duration, error) {
+	m := icsDurationRegexp.FindStringSubmatch(value)
+	if m == nil || value == "P" || strings.HasSuffix(value, "T") {
+		return 0, errors.New("invalid duration " + value)
+	}
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, unit := range units {
+		if m[i+2] != "" {
+			n, _ := strconv.Atoi(m[i+2])
+			d += time.Duration(n) * unit
+		}
+	}
+	if m[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
+
+// parseIcsTime parses the DATE-TIME or DATE value; without a UTC mark it is in the
+// TZID of the params, or the server's local time
+func parseIcsTime(value string, params map[string]string) (t time.Time, allDay bool, err error) {
+	loc := time.Local
+	if tzid, ok := params["TZID"]; ok {
+		if loc, err = time.LoadLocation(strings.Trim(tzid, `"`)); err != nil {
+			return t, false, errors.New("unknown time zone " + tzid)
+		}
+	}
+
+	switch {
+	case params["VALUE"] == "DATE" || len(value) == 8:
+		t, err = time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	case strings.HasSuffix(value, "Z"):
+		t, err = time.Parse("20060102T150405Z", value)
+	default:
+		t, err = time.ParseInLocation("20060102T150405", value, loc)
+	}
+	return t, false, err
+}
+
+// splitIcsLine splits the content line into name, params and value
+func splitIcsLine(line string) (name string, params map[string]string, value string) {
+	quoted, colon := false, -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return "", nil, ""
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	params = make(map[string]string)
+	for _, p := range parts[1:] {
+		if kv := strings.SplitN(p, "=", 2); len(kv) == 2 {
+			params[strings.ToUpper(kv[0])] = kv[1]
+		}
+	}
+	return strings.ToUpper(parts[0]), params, line[colon+1:]
+}
+
+// parseBookings reads the busy slots from the events in the .ics export; cancelled and
+// free (transparent) events are ignored, and recurring events keep their rule to repeat
+// the first slot
+func parseBookings(space string, r io.Reader) (list []Booking, err error) {
+	// unfold the lines
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+		} else if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	list = []Booking{}
+	var cur *Booking
+	var duration time.Duration
+	var allDay, skip bool
+	for _, line := range lines {
+		name, params, value := splitIcsLine(line)
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			cur, duration, allDay, skip = &Booking{Space: space}, 0, false, false
+		case cur == nil:
+			continue
+		case name == "END" && value == "VEVENT":
+			if cur.Start.IsZero() {
+				return nil, errors.New("event " + cur.UID + " has no start time")
+			}
+			if cur.End.IsZero() {
+				switch {
+				case duration > 0:
+					cur.End = cur.Start.Add(duration)
+				case allDay:
+					cur.End = cur.Start.AddDate(0, 0, 1)
+				default:
+					cur.End = cur.Start
+				}
+			}
+			if cur.Rule != "" {
+				cur.Zone = cur.Start.Location().String()
+			}
+			if !skip && cur.End.After(cur.Start) {
+				list = append(list, *cur)
+			}
+			cur = nil
+		case name == "UID":
+			cur.UID = value
+		case name == "SUMMARY":
+			cur.Summary = strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+		case name == "DTSTART":
+			if cur.Start, allDay, err = parseIcsTime(value, params); err != nil {
+				return nil, err
+			}
+		case name == "DTEND":
+			if cur.End, _, err = parseIcsTime(value, params); err != nil {
+				return nil, err
+			}
+		case name == "RRULE":
+			if _, err = parseRecurrence(value); err != nil {
+				return nil, err
+			}
+			cur.Rule = value
+		case name == "EXDATE":
+			for _, v := range strings.Split(value, ",") {
+				t, _, err := parseIcsTime(v, params)
+				if err != nil {
+					return nil, err
+				}
+				cur.Except = append(cur.Except, t)
+			}
+		case name == "DURATION":
+			if duration, err = parseIcsDuration(value); err != nil {
+				return nil, err
+			}
+		case name == "STATUS" && value == "CANCELLED", name == "TRANSP" && value == "TRANSPARENT":
+			skip = true
+		}
+	}
+	return list, nil
+}
+
+// deferredSpace tests whether the space is in the sub-tree of an occupied space,
+// walking up to the root; the root itself is never deferred
+func deferredSpace(name string, rootName string, spaces map[string]Space, occupied map[string]bool) bool {
+	for name != rootName {
+		if occupied[name] {
+			return true
+		}
+		sp, ok := spaces[name]
+		if !ok {
+			return false
+		}
+		name = sp.Base
+	}
+	return false
+}
+
+// parseBookingQuery reads the route's start time and expected duration, zero start for ignoring the bookings
+func parseBookingQuery(qr url.Values) (start time.Time, end time.Time, err error) {
+	if qr.Get("start") == "" {
+		return start, end, nil
+	}
+	if start, err = time.Parse(time.RFC3339, qr.Get("start")); err != nil {
+		return start, end, errors.New("invalid start time")
+	}
+	minutes := float64(DEFAULT_VISIT_MINUTES)
+	if qr.Get("duration") != "" {
+		if minutes, err = strconv.ParseFloat(qr.Get("duration"), 64); err != nil || minutes <= 0 {
+			return start, end, errors.New("invalid duration")
+		}
+	}
+	return start, start.Add(time.Duration(minutes * float64(time.Minute))), nil
+}
+
+// deferBookedSpaces defers the spaces under the root booked in [start, end) in the policy,
+// returning the bookings causing it
+func (r RestContext) deferBookedSpaces(spaceName string, start time.Time, end time.Time,
+	policy *samplePolicy) (deferred []Booking, errCode int, err error) {
+	deferred = []Booking{}
+	if start.IsZero() {
+		return deferred, http.StatusOK, nil
+	}
+
+	spaceList, errCode, err := r.dbGetSubtreeSpaces(spaceName, true)
+	if err != nil {
+		return nil, errCode, err
+	}
+	subspaces := make([]string, 0, len(spaceList))
+	for _, sp := range spaceList[1:] {
+		subspaces = append(subspaces, sp.Name)
+	}
+
+	if deferred, errCode, err = r.dbGetBookings(bookingFilter(bson.M{"$in": subspaces}, start, end)); err != nil {
+		return nil, errCode, err
+	}
+	deferred = expandBookings(deferred, start, end)
+	policy.Deferred = make(map[string]bool, len(deferred))
+	for _, b := range deferred {
+		policy.Deferred[b.Space] = true
+	}
+	return deferred, http.StatusOK, nil
+}
+
+// bookedSpaceNames lists the spaces of the bookings, once each
+func bookedSpaceNames(list []Booking) []string {
+	names := []string{}
+	seen := make(map[string]bool)
+	for _, b := range list {
+		if !seen[b.Space] {
+			seen[b.Space] = true
+			names = append(names, b.Space)
+		}
+	}
+	return names
+}
+
+// dbGetBookings finds the bookings matching the filter, ordered by start time
+func (r RestContext) dbGetBookings(filter bson.M) (list []Booking, errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cf()
+
+	cur, err := r.mongoDB.Collection("booking").Find(ctx, filter, options.Find().SetSort(bson.D{{"start", 1}}))
+	if err != nil {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, err
+	}
+	defer cur.Close(ctx)
+
+	list = []Booking{}
+	for cur.Next(ctx) {
+		var b Booking
+		if err = cur.Decode(&b); err != nil {
+			log.Println(err)
+			return nil, http.StatusInternalServerError, err
+		}
+		list = append(list, b)
+	}
+	return list, http.StatusOK, nil
+}
+
+// dbReplaceBookings replaces all the bookings of the space
+func (r RestContext) dbReplaceBookings(space string, list []Booking) (errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cf()
+
+	if _, err = r.mongoDB.Collection("booking").DeleteMany(ctx, bson.M{"space": space}); err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, err
+	}
+	if len(list) == 0 {
+		return http.StatusOK, nil
+	}
+
+	docs := make([]interface{}, len(list))
+	for i := range list {
+		docs[i] = list[i]
+	}
+	if _, err = r.mongoDB.Collection("booking").InsertMany(ctx, docs); err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// importPath resolves the relative path in the import folder, refusing the absolute ones
+// and the ones getting out of it
+func importPath(dir string, path string) (string, error) {
+	path = filepath.Clean(filepath.FromSlash(path))
+	if filepath.IsAbs(path) || filepath.VolumeName(path) != "" || path == ".." ||
+		strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return "", errors.New("the local file should be relative to the import folder")
+	}
+	return filepath.Join(dir, path), nil
+}
+
+// PUT PREFIX/spaces/{space-name}/bookings?file=room-101/export.ics
+// form: {name: "ics" ...}
+func (r RestContext) putBookings(req *restful.Request, resp *restful.Response) {
+	spaceName := req.PathParameter("space-name")
+	if _, errCode, err := r.dbGetSpace(spaceName, true); err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+
+	// either the local export, or the uploaded one
+	var file io.ReadCloser
+	if path := req.QueryParameter("file"); path != "" {
+		if r.ImportDir == "" {
+			resp.WriteError(http.StatusForbidden, errors.New("no folder is configured to import the local files from"))
+			return
+		}
+		path, err := importPath(r.ImportDir, path)
+		if err != nil {
+			resp.WriteError(http.StatusForbidden, err)
+			return
+		}
+		if filepath.Ext(path) != ".ics" {
+			resp.WriteError(http.StatusNotAcceptable, errors.New("the local file should be an .ics export"))
+			return
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			resp.WriteError(http.StatusNotFound, err)
+			return
+		}
+		file = f
+	} else {
+		req.Request.ParseMultipartForm(10 << 20) // 10M
+		f, _, err := req.Request.FormFile("ics")
+		if err != nil {
+			log.Printf("error during reading form @putBookings: %v\n", err)
+			resp.WriteError(http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		file = f
+	}
+	defer file.Close()
+
+	list, err := parseBookings(spaceName, file)
+	if err != nil {
+		resp.WriteError(http.StatusNotAcceptable, err)
+		return
+	}
+	if errCode, err := r.dbReplaceBookings(spaceName, list); err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, list)
+}
+
+// GET PREFIX/spaces/{space-name}/bookings?from=RFC3339&to=RFC3339
+func (r RestContext) findBookings(req *restful.Request, resp *restful.Response) {
+	var from, to time.Time
+	var err error
+	if v := req.QueryParameter("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			resp.WriteError(http.StatusNotAcceptable, errors.New("invalid start time"))
+			return
+		}
+	}
+	if v := req.QueryParameter("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			resp.WriteError(http.StatusNotAcceptable, errors.New("invalid end time"))
+			return
+		}
+	}
+
+	// the recurring bookings are repeated only in a bounded window
+	spaceName := req.PathParameter("space-name")
+	filter := bson.M{"space": spaceName}
+	if !to.IsZero() {
+		filter = bookingFilter(spaceName, from, to)
+	} else if !from.IsZero() {
+		filter["$or"] = []bson.M{{"end": bson.M{"$gt": from}}, {"rule": bson.M{"$gt": ""}}}
+	}
+
+	list, errCode, err := r.dbGetBookings(filter)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	if !to.IsZero() {
+		list = expandBookings(list, from, to)
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, list)
+}
+
+// DELETE PREFIX/spaces/{space-name}/bookings
+func (r RestContext) deleteBookings(req *restful.Request, resp *restful.Response) {
+	if errCode, err := r.dbReplaceBookings(req.PathParameter("space-name"), nil); err != nil {
+		resp.WriteError(errCode, err)
+	} else {
+		resp.WriteHeader(http.StatusOK)
+	}
+}
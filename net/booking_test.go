@@ -0,0 +1,212 @@
+package net
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const bookingTestIcs = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:weekly-sync\r\n" +
+	"SUMMARY:Weekly sync\\, team A\r\n" +
+	"DTSTART:20190701T090000Z\r\n" +
+	"DTEND:20190701T100000Z\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:interview\r\n" +
+	"SUMMARY:Interv\r\n" +
+	" iew\r\n" +
+	"DTSTART;TZID=Asia/Shanghai:20190701T140000\r\n" +
+	"DURATION:PT1H30M\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:cancelled\r\n" +
+	"DTSTART:20190701T120000Z\r\n" +
+	"DTEND:20190701T130000Z\r\n" +
+	"STATUS:CANCELLED\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:offsite\r\n" +
+	"DTSTART;VALUE=DATE:20190702\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func Test_parseBookings(t *testing.T) {
+	list, err := parseBookings("Meeting Room", strings.NewReader(bookingTestIcs))
+	if err != nil {
+		t.Fatalf("parseBookings() error = %v", err)
+	}
+	if len(list) != 3 {
+		t.Fatalf("parseBookings() got %v bookings, want 3", len(list))
+	}
+
+	if list[0].Summary != "Weekly sync, team A" || list[0].Space != "Meeting Room" ||
+		!list[0].End.Equal(time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("parseBookings() first = %v", list[0])
+	}
+	// 14:00 in Shanghai is 06:00 UTC, lasting 1.5 hours
+	if list[1].Summary != "Interview" || !list[1].Start.Equal(time.Date(2019, 7, 1, 6, 0, 0, 0, time.UTC)) ||
+		list[1].End.Sub(list[1].Start) != 90*time.Minute {
+		t.Errorf("parseBookings() second = %v", list[1])
+	}
+	if list[2].End.Sub(list[2].Start) != 24*time.Hour {
+		t.Errorf("parseBookings() all-day = %v", list[2])
+	}
+
+	if _, err := parseBookings("Meeting Room", strings.NewReader("BEGIN:VEVENT\nUID:x\nEND:VEVENT\n")); err == nil {
+		t.Errorf("parseBookings() no error without a start time")
+	}
+}
+
+func Test_parseIcsDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"PT1H30M", 90 * time.Minute, false},
+		{"P1D", 24 * time.Hour, false},
+		{"P1W", 7 * 24 * time.Hour, false},
+		{"-PT15M", -15 * time.Minute, false},
+		{"PT", 0, true},
+		{"1H", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseIcsDuration(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseIcsDuration(%v) = %v, %v, want %v", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func Test_deferredSpace(t *testing.T) {
+	spaces := map[string]Space{
+		"base":         Space{Name: "base"},
+		"Meeting Room": Space{Name: "Meeting Room", Base: "base"},
+		"Closet":       Space{Name: "Closet", Base: "Meeting Room"},
+		"Lobby":        Space{Name: "Lobby", Base: "base"}}
+	occupied := map[string]bool{"Meeting Room": true, "base": true}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"base", false}, // the root is never deferred
+		{"Meeting Room", true},
+		{"Closet", true},
+		{"Lobby", false},
+	}
+	for _, tt := range tests {
+		if got := deferredSpace(tt.name, "base", spaces, occupied); got != tt.want {
+			t.Errorf("deferredSpace(%v) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBooking_occurrences(t *testing.T) {
+	monday := time.Date(2019, 7, 1, 9, 0, 0, 0, time.UTC)
+	weekly := Booking{UID: "sync", Start: monday, End: monday.Add(time.Hour), Rule: "FREQ=WEEKLY;BYDAY=MO,WE", Zone: "UTC"}
+	starts := func(list []Booking) []string {
+		res := []string{}
+		for _, b := range list {
+			res = append(res, b.Start.Format("01-02 15:04"))
+		}
+		return res
+	}
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	march := time.Date(2019, 3, 29, 9, 0, 0, 0, berlin)
+
+	tests := []struct {
+		name     string
+		b        Booking
+		from, to time.Time
+		want     []string
+	}{
+		{"single, overlapping", Booking{Start: monday, End: monday.Add(time.Hour)},
+			monday.Add(30 * time.Minute), monday.Add(2 * time.Hour), []string{"07-01 09:00"}},
+		{"single, outside", Booking{Start: monday, End: monday.Add(time.Hour)},
+			monday.Add(time.Hour), monday.Add(2 * time.Hour), []string{}},
+		{"weekly by day, in a later window", weekly,
+			monday.AddDate(0, 0, 14), monday.AddDate(0, 0, 21), []string{"07-15 09:00", "07-17 09:00"}},
+		{"weekly, overlapping the window start", weekly,
+			monday.AddDate(0, 0, 2).Add(30 * time.Minute), monday.AddDate(0, 0, 3), []string{"07-03 09:00"}},
+		{"count", Booking{Start: monday, End: monday.Add(time.Hour), Rule: "FREQ=DAILY;COUNT=3"},
+			monday.AddDate(0, 0, 1), monday.AddDate(0, 0, 10), []string{"07-02 09:00", "07-03 09:00"}},
+		{"interval and until", Booking{Start: monday, End: monday.Add(time.Hour), Rule: "FREQ=DAILY;INTERVAL=2;UNTIL=20190705T090000Z"},
+			monday, monday.AddDate(0, 1, 0), []string{"07-01 09:00", "07-03 09:00", "07-05 09:00"}},
+		{"except", Booking{Start: monday, End: monday.Add(time.Hour), Rule: "FREQ=DAILY;COUNT=3",
+			Except: []time.Time{monday.AddDate(0, 0, 1)}}, monday, monday.AddDate(0, 0, 10), []string{"07-01 09:00", "07-03 09:00"}},
+		{"monthly, skipping the months without the day",
+			Booking{Start: time.Date(2019, 1, 31, 9, 0, 0, 0, time.UTC), End: time.Date(2019, 1, 31, 10, 0, 0, 0, time.UTC),
+				Rule: "FREQ=MONTHLY"}, monday.AddDate(0, -6, 0), monday, []string{"01-31 09:00", "03-31 09:00", "05-31 09:00"}},
+		{"the wall clock kept over daylight saving", Booking{Start: march, End: march.Add(time.Hour),
+			Rule: "FREQ=DAILY", Zone: "Europe/Berlin"}, march.AddDate(0, 0, 3), march.AddDate(0, 0, 4), []string{"04-01 09:00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.b.occurrences(tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("Booking.occurrences() error = %v", err)
+			}
+			if gotStarts := starts(got); !reflect.DeepEqual(gotStarts, tt.want) {
+				t.Errorf("Booking.occurrences() = %v, want %v", gotStarts, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseRecurrence("FREQ=HOURLY"); err == nil {
+		t.Errorf("parseRecurrence() no error for an unsupported frequency")
+	}
+	if _, err := parseRecurrence("FREQ=MONTHLY;BYDAY=1MO"); err == nil {
+		t.Errorf("parseRecurrence() no error for an unsupported day")
+	}
+}
+
+func Test_parseBookings_recurring(t *testing.T) {
+	list, err := parseBookings("Meeting Room", strings.NewReader("BEGIN:VEVENT\r\n"+
+		"UID:standup\r\n"+
+		"DTSTART;TZID=Asia/Shanghai:20190701T093000\r\n"+
+		"DURATION:PT15M\r\n"+
+		"RRULE:FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR\r\n"+
+		"EXDATE;TZID=Asia/Shanghai:20190702T093000,20190703T093000\r\n"+
+		"END:VEVENT\r\n"))
+	if err != nil || len(list) != 1 {
+		t.Fatalf("parseBookings() = %v, %v", list, err)
+	}
+	if b := list[0]; b.Rule != "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR" || b.Zone != "Asia/Shanghai" || len(b.Except) != 2 {
+		t.Errorf("parseBookings() recurring = %v", b)
+	}
+
+	// the standups of the week, but the cancelled ones
+	from := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	if got := expandBookings(list, from, from.AddDate(0, 0, 7)); len(got) != 3 {
+		t.Errorf("expandBookings() = %v, want 3 standups", got)
+	}
+}
+
+func Test_importPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{"room-101/export.ics", filepath.Join("/srv/import", "room-101", "export.ics"), false},
+		{"./a/../export.ics", filepath.Join("/srv/import", "export.ics"), false},
+		{"../etc/secret.ics", "", true},
+		{"a/../../secret.ics", "", true},
+		{"/etc/secret.ics", "", true},
+		{"..", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := importPath("/srv/import", tt.path)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("importPath() = %v, %v, want %v, wantErr %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+// iCalendar feeds of the inspection plans and sessions
+
+package net
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	dataio "github.com/miosolo/readygo/io"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// calendarHorizon is how far the upcoming runs of the plans are listed
+const calendarHorizon = 90 * 24 * time.Hour
+
+// calendarEvent is a VEVENT in the feed
+type calendarEvent struct {
+	UID         string
+	Start       time.Time
+	Duration    time.Duration
+	Summary     string
+	Description string
+	URL         string
+}
+
+// estimateDuration is the time to walk through the route at the speed
+func estimateDuration(distance float64, speed float64) time.Duration {
+	if speed <= 0 {
+		speed = WALKING_SPEED
+	}
+	return time.Duration(distance / speed * float64(time.Second)).Round(time.Second)
+}
+
+// routeDuration is the route's estimated duration with the dwell times if planned with,
+// or the time to walk through it at the speed
+func routeDuration(rt dataio.Route, speed float64) time.Duration {
+	if rt.Duration > 0 {
+		return time.Duration(rt.Duration * float64(time.Second)).Round(time.Second)
+	}
+	return estimateDuration(rt.Distance, speed)
+}
+
+// routeSummary describes the Session's stops in the route order, with the progress
+func routeSummary(s Session) string {
+	stops := make([]string, 0, len(s.Stops))
+	for _, stop := range s.Stops {
+		stops = append(stops, stop.Name+"@"+stop.Base+" ("+stop.Status+")")
+	}
+	return fmt.Sprintf("%d/%d checked, distance %.1f, estimated %s\n%s",
+		s.Checked, s.Total, s.Route.Distance, formatDuration(s.Route.Duration), strings.Join(stops, " -> "))
+}
+
+// sessionEvent is the event of the Session, starting when it was created
+func sessionEvent(s Session, speed float64, baseURL string) calendarEvent {
+	summary := "Inspection of " + s.Space + " by " + s.Inspector
+	if s.Overdue {
+		summary += " (overdue)"
+	} else if s.Done {
+		summary += " (done)"
+	}
+	return calendarEvent{
+		UID:         "session-" + s.ID + "@readygo",
+		Start:       s.Created,
+		Duration:    routeDuration(s.Route, speed),
+		Summary:     summary,
+		Description: routeSummary(s),
+		URL:         baseURL + "/sessions/" + s.ID + "/route"}
+}
+
+// planEvents are the upcoming runs of the plan until the horizon; the duration is
+// estimated from the route of its last Session, if any
+func planEvents(p InspectionPlan, last *Session, speed float64, now time.Time, baseURL string) (list []calendarEvent) {
+	sched, err := parseCron(p.Recurrence)
+	if err != nil {
+		return nil
+	}
+
+	var duration time.Duration
+	description := fmt.Sprintf("Planned inspection sampling %.0f%% of the assets", p.SampleRate*100)
+	if last != nil {
+		duration = routeDuration(last.Route, speed)
+		description += "\nLast route: " + routeSummary(*last)
+	}
+
+	for t := p.NextRun; !t.IsZero() && t.Before(now.Add(calendarHorizon)); t = sched.next(t) {
+		list = append(list, calendarEvent{
+			UID:         "plan-" + p.ID + "-" + t.UTC().Format("20060102T1504") + "@readygo",
+			Start:       t,
+			Duration:    duration,
+			Summary:     "Planned inspection of " + p.Space + " by " + p.Assignee,
+			Description: description,
+			URL:         baseURL + "/plans/" + p.ID})
+	}
+	return list
+}
+
+// icsEscape escapes the TEXT value
+func icsEscape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
+
+// icsFold folds the content line longer than 75 octets, without splitting a UTF-8 character
+func icsFold(line string) string {
+	var b strings.Builder
+	width := 0
+	for _, c := range line {
+		size := len(string(c))
+		if width+size > 75 {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(c)
+		width += size
+	}
+	return b.String()
+}
+
+// icsDuration formats the duration like PT1H2M3S
+func icsDuration(d time.Duration) string {
+	secs := int64(d / time.Second)
+	out := "PT"
+	if h := secs / 3600; h > 0 {
+		out += strconv.FormatInt(h, 10) + "H"
+	}
+	if m := secs % 3600 / 60; m > 0 {
+		out += strconv.FormatInt(m, 10) + "M"
+	}
+	if s := secs % 60; s > 0 || out == "PT" {
+		out += strconv.FormatInt(s, 10) + "S"
+	}
+	return out
+}
+
+// writeCalendar writes the events as an iCalendar (RFC 5545) feed
+func writeCalendar(w io.Writer, name string, events []calendarEvent, now time.Time) error {
+	const stamp = "20060102T150405Z"
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//miosolo//readygo//EN",
+		"CALSCALE:GREGORIAN",
+		"X-WR-CALNAME:" + icsEscape(name)}
+	for _, e := range events {
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			"UID:"+e.UID,
+			"DTSTAMP:"+now.UTC().Format(stamp),
+			"DTSTART:"+e.Start.UTC().Format(stamp),
+			"DURATION:"+icsDuration(e.Duration),
+			"SUMMARY:"+icsEscape(e.Summary),
+			"DESCRIPTION:"+icsEscape(e.Description+"\n"+e.URL),
+			"URL:"+e.URL,
+			"END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, line := range lines {
+		if _, err := io.WriteString(w, icsFold(line)+"\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCalendarFeed collects the events of the Sessions and plans matching the filters as the response
+func (r RestContext) writeCalendarFeed(name string, sessionFilter bson.M, planMatch func(InspectionPlan) bool,
+	req *restful.Request, resp *restful.Response) {
+	speed := WALKING_SPEED
+	if qs := req.QueryParameter("walking-speed"); qs != "" {
+		var err error
+		if speed, err = strconv.ParseFloat(qs, 64); err != nil || speed <= 0 {
+			resp.WriteError(http.StatusNotAcceptable, errors.New("walking speed should be a positive number"))
+			return
+		}
+	}
+	baseURL := "https://" + req.Request.Host + "/v1"
+	now := time.Now()
+
+	sessions, errCode, err := r.dbFindSessions(sessionFilter)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	plans, errCode, err := r.dbGetPlans()
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+
+	events := []calendarEvent{}
+	sessionIndex := make(map[string]*Session, len(sessions))
+	for i, s := range sessions {
+		sessionIndex[s.ID] = &sessions[i]
+		events = append(events, sessionEvent(s, speed, baseURL))
+	}
+	for _, p := range plans {
+		if !planMatch(p) {
+			continue
+		}
+		last := sessionIndex[p.LastSession]
+		if last == nil && p.LastSession != "" {
+			last, _, _ = r.dbGetSession(p.LastSession)
+		}
+		events = append(events, planEvents(p, last, speed, now, baseURL)...)
+	}
+
+	resp.AddHeader("Content-Type", "text/calendar; charset=utf-8")
+	resp.WriteHeader(http.StatusOK)
+	writeCalendar(resp, name, events, now)
+}
+
+// GET PREFIX/calendar/inspectors/{inspector}?walking-speed=1.2
+func (r RestContext) findInspectorCalendar(req *restful.Request, resp *restful.Response) {
+	inspector := req.PathParameter("inspector")
+	r.writeCalendarFeed("Inspections of "+inspector, bson.M{"inspector": inspector},
+		func(p InspectionPlan) bool { return p.Assignee == inspector }, req, resp)
+}
+
+// GET PREFIX/calendar/spaces/{space-name}?walking-speed=1.2
+func (r RestContext) findSpaceCalendar(req *restful.Request, resp *restful.Response) {
+	spaceName := req.PathParameter("space-name")
+	if _, errCode, err := r.dbGetSpace(spaceName, true); err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	r.writeCalendarFeed("Inspections in "+spaceName, bson.M{"space": spaceName},
+		func(p InspectionPlan) bool { return p.Space == spaceName }, req, resp)
+}
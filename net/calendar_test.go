@@ -0,0 +1,75 @@
+package net
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_icsDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "PT0S"},
+		{90 * time.Second, "PT1M30S"},
+		{2*time.Hour + 5*time.Second, "PT2H5S"},
+	}
+	for _, tt := range tests {
+		if got := icsDuration(tt.d); got != tt.want {
+			t.Errorf("icsDuration(%v) = %v, want %v", tt.d, got, tt.want)
+		}
+	}
+}
+
+func Test_icsEscapeFold(t *testing.T) {
+	if got, want := icsEscape("A@base; B, C\nD\\"), `A@base\; B\, C\nD\\`; got != want {
+		t.Errorf("icsEscape() = %v, want %v", got, want)
+	}
+
+	folded := icsFold(strings.Repeat("会议室", 30))
+	for _, line := range strings.Split(folded, "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("icsFold() line of %v octets, want <= 75", len(line))
+		}
+	}
+	if strings.Replace(folded, "\r\n ", "", -1) != strings.Repeat("会议室", 30) {
+		t.Errorf("icsFold() changed the content")
+	}
+}
+
+func Test_planEvents(t *testing.T) {
+	now := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	p := InspectionPlan{ID: "floor-1", Space: "base", Assignee: "mio", Recurrence: "@monthly", SampleRate: 0.3}
+	p.schedule(now)
+	last := newSession("base", "mio", sessionTestRoute, now)
+
+	events := planEvents(p, &last, 1, now, "https://host/v1")
+	if len(events) != 2 { // Aug and Sep in 90 days
+		t.Fatalf("planEvents() got %v events, want 2", len(events))
+	}
+	if !events[0].Start.Equal(time.Date(2019, 8, 1, 0, 0, 0, 0, time.UTC)) || events[0].Duration != 5*time.Second {
+		t.Errorf("planEvents() first event = %v", events[0])
+	}
+	if events[0].URL != "https://host/v1/plans/floor-1" || events[0].UID == events[1].UID {
+		t.Errorf("planEvents() url = %v, uid = %v", events[0].URL, events[0].UID)
+	}
+}
+
+func Test_writeCalendar(t *testing.T) {
+	now := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	s := newSession("base", "mio", sessionTestRoute, now)
+
+	var b strings.Builder
+	if err := writeCalendar(&b, "Inspections of mio", []calendarEvent{sessionEvent(s, 1, "https://host/v1")}, now); err != nil {
+		t.Fatalf("writeCalendar() error = %v", err)
+	}
+	ics := b.String()
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n", "UID:session-" + s.ID + "@readygo\r\n", "DTSTART:20190701T000000Z\r\n",
+		"DURATION:PT5S\r\n", "URL:https://host/v1/sessions/" + s.ID + "/route\r\n", "END:VCALENDAR\r\n"} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("writeCalendar() missing %q", want)
+		}
+	}
+}
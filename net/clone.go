@@ -0,0 +1,232 @@
+// Cloning a Space subtree, like onboarding a floor identical to another one
+
+package net
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CloneRequest tells where the copy goes and how the Spaces are named
+type CloneRequest struct {
+	Base        string  `json:"base" description:"the parent space of the copy, the same as the original's if empty"`
+	Prefix      string  `json:"prefix" description:"prepended to the names of the spaces copied, like F2-"`
+	StripPrefix string  `json:"stripPrefix,omitempty" description:"removed from the names before prepending the prefix, like F1-"`
+	Dx          float64 `json:"dx,omitempty" description:"moves the door of the copy along x of its parent"`
+	Dy          float64 `json:"dy,omitempty" description:"moves the door of the copy along y of its parent"`
+	Rotation    float64 `json:"rotation,omitempty" description:"turns the copy counter-clockwise around its door, in degrees"`
+}
+
+// CloneResult lists what is copied
+type CloneResult struct {
+	Spaces []Space `json:"spaces" description:"the spaces created, the top one first"`
+	Assets []Asset `json:"assets" description:"the assets created"`
+}
+
+// cloneName names the copy of the Space
+func (c CloneRequest) cloneName(name string) string {
+	return c.Prefix + strings.TrimPrefix(name, c.StripPrefix)
+}
+
+// copyAttrs copies the attributes, not to share the map with the original
+func copyAttrs(attrs map[string]string) map[string]string {
+	if attrs == nil {
+		return nil
+	}
+	result := make(map[string]string, len(attrs))
+	for k, v := range attrs {
+		result[k] = v
+	}
+	return result
+}
+
+// cloneSubtree copies the Spaces and their Assets; subtree is in BFS order with the top one first.
+// The Assets keep their names in the copied spaces, without the serials, the statuses and the inspections
+// that belong to the physical originals
+func cloneSubtree(subtree []Space, assetList []Asset, c CloneRequest) CloneResult {
+	result := CloneResult{Spaces: make([]Space, 0, len(subtree)), Assets: make([]Asset, 0, len(assetList))}
+	for i, sp := range subtree {
+		sp.Name = c.cloneName(sp.Name)
+		if i == 0 {
+			if c.Base != "" {
+				sp.Base = c.Base
+			}
+			sp.Rx, sp.Ry, sp.Rotation = sp.Rx+c.Dx, sp.Ry+c.Dy, sp.Rotation+c.Rotation
+		} else {
+			sp.Base = c.cloneName(sp.Base)
+		}
+		sp.Attrs = copyAttrs(sp.Attrs)
+		result.Spaces = append(result.Spaces, sp)
+	}
+	for _, as := range assetList {
+		as.Base = c.cloneName(as.Base)
+		as.Serial, as.Status, as.LastChecked = "", "", time.Time{}
+		as.Attrs = copyAttrs(as.Attrs)
+		result.Assets = append(result.Assets, as)
+	}
+	return result
+}
+
+// cloneConflicts lists the names of the copies taken twice in the copy, or in the DB already
+func cloneConflicts(spaceList []Space, existing map[string]bool) []string {
+	conflicts := []string{}
+	seen := make(map[string]bool, len(spaceList))
+	for _, sp := range spaceList {
+		if seen[sp.Name] {
+			conflicts = append(conflicts, "the space "+sp.Name+" would be copied twice")
+		} else if existing[sp.Name] {
+			conflicts = append(conflicts, "the space "+sp.Name+" already exists")
+		}
+		seen[sp.Name] = true
+	}
+	sort.Strings(conflicts)
+	return conflicts
+}
+
+// dbExistingSpaces finds which of the Spaces exist in MongoDB
+func (r RestContext) dbExistingSpaces(ctx context.Context, names []string) (existing map[string]bool, errCode int, err error) {
+	cur, err := r.mongoDB.Collection("space").Find(ctx, bson.M{"name": bson.M{"$in": names}},
+		options.Find().SetProjection(bson.M{"name": 1}))
+	if err != nil {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, err
+	}
+	defer cur.Close(ctx)
+
+	existing = make(map[string]bool)
+	for cur.Next(ctx) {
+		var sp Space
+		if err = cur.Decode(&sp); err != nil {
+			log.Println(err)
+			return nil, http.StatusInternalServerError, err
+		}
+		existing[sp.Name] = true
+	}
+	return existing, http.StatusOK, nil
+}
+
+// dbClone inserts the copy in one transaction, checking there that none of its Spaces exists,
+// so that a conflict reports all the names and leaves nothing half-cloned; then caches it
+func (r RestContext) dbClone(result CloneResult) (errCode int, err error) {
+	names := make([]string, 0, len(result.Spaces))
+	for _, sp := range result.Spaces {
+		names = append(names, sp.Name)
+	}
+
+	errCode, err = r.dbTransaction(30*time.Second, func(ctx mongo.SessionContext) (int, error) {
+		existing, errCode, err := r.dbExistingSpaces(ctx, names)
+		if err != nil {
+			return errCode, err
+		}
+		if conflicts := cloneConflicts(result.Spaces, existing); len(conflicts) > 0 {
+			return http.StatusConflict, errors.New(strings.Join(conflicts, "; "))
+		}
+
+		items := make([]interface{}, 0, len(result.Spaces))
+		for _, sp := range result.Spaces {
+			items = append(items, sp)
+		}
+		if _, err := r.mongoDB.Collection("space").InsertMany(ctx, items); err != nil {
+			return cloneWriteStatus(err), err
+		}
+		if len(result.Assets) == 0 {
+			return http.StatusOK, nil
+		}
+		items = make([]interface{}, 0, len(result.Assets))
+		for _, as := range result.Assets {
+			items = append(items, as)
+		}
+		if _, err := r.mongoDB.Collection("asset").InsertMany(ctx, items); err != nil {
+			return cloneWriteStatus(err), err
+		}
+		return http.StatusOK, nil
+	})
+	if err != nil {
+		return errCode, err
+	}
+
+	// cache only what is committed
+	redisConn := r.redisConnPool.Get()
+	defer redisConn.Close()
+	set := func(k string, v interface{}, expire int) {
+		b, _ := json.Marshal(v)
+		redisConn.Do("SET", k, b)
+		redisConn.Do("EXPIRE", k, expire)
+	}
+	for _, sp := range result.Spaces {
+		set("space-"+sp.Name, sp, WEEK_SECONDS)
+	}
+	for _, as := range result.Assets {
+		set(as.Name+"@"+as.Base, as, MONTH_SECONDS)
+	}
+	return http.StatusCreated, nil
+}
+
+// cloneWriteStatus is 409 for a duplicate key, inserted by someone else meanwhile
+func cloneWriteStatus(err error) int {
+	if wrEx, ok := err.(mongo.BulkWriteException); ok {
+		for _, wrErr := range wrEx.WriteErrors {
+			if wrErr.Code == 11000 { //duplicate key
+				return http.StatusConflict
+			}
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// POST PREFIX/spaces/{space-name}/clone
+// CloneRequest: {base: "building", prefix: "F2-", stripPrefix: "F1-", dx: 0, dy: 0, rotation: 0}
+func (r RestContext) cloneSpace(req *restful.Request, resp *restful.Response) {
+	var c CloneRequest
+	if err := req.ReadEntity(&c); err != nil {
+		resp.WriteError(http.StatusNotAcceptable, err)
+		return
+	}
+	if c.Prefix == "" && c.StripPrefix == "" {
+		resp.WriteError(http.StatusNotAcceptable, errors.New("the copy should have a prefix to its names"))
+		return
+	}
+
+	subtree, errCode, err := r.dbGetSubtreeSpaces(req.PathParameter("space-name"), false)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	if c.Base != "" {
+		if _, _, err := r.dbGetSpace(c.Base, false); err != nil {
+			resp.WriteError(http.StatusForbidden, errors.New("the base space "+c.Base+" does not exist"))
+			return
+		}
+	}
+	baseNames := make([]string, 0, len(subtree))
+	for _, sp := range subtree {
+		baseNames = append(baseNames, sp.Name)
+	}
+	assetList, errCode, err := r.dbFindAssets(bson.M{"base": bson.M{"$in": baseNames}})
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+
+	result := cloneSubtree(subtree, assetList, c)
+	if errCode, err := r.checkPlacement(result.Spaces, result.Assets); err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	if errCode, err := r.dbClone(result); err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusCreated, result)
+}
@@ -0,0 +1,57 @@
+package net
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_cloneSubtree(t *testing.T) {
+	subtree := []Space{
+		{Name: "F1", Base: "building", Rx: 0, Ry: 0, Width: 20, Height: 10},
+		{Name: "F1-101", Base: "F1", Rx: 2, Ry: 2, Attrs: map[string]string{"public": "true"}},
+		{Name: "F1-102", Base: "F1", Rx: 8, Ry: 2},
+		{Name: "closet", Base: "F1-101", Rx: 1, Ry: 1},
+	}
+	assetList := []Asset{
+		{Name: "A", Base: "F1-101", Rx: 1, Ry: 1, Weight: 2, Serial: "SN1", Status: STATUS_IN_REPAIR,
+			LastChecked: time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC), Category: "laptop"},
+		{Name: "B", Base: "closet", Rx: 0, Ry: 1, Weight: 1},
+	}
+	c := CloneRequest{Base: "building", Prefix: "F2", StripPrefix: "F1", Dy: 4, Rotation: 90}
+
+	got := cloneSubtree(subtree, assetList, c)
+	wantSpaces := []Space{
+		{Name: "F2", Base: "building", Rx: 0, Ry: 4, Width: 20, Height: 10, Rotation: 90},
+		{Name: "F2-101", Base: "F2", Rx: 2, Ry: 2, Attrs: map[string]string{"public": "true"}},
+		{Name: "F2-102", Base: "F2", Rx: 8, Ry: 2},
+		{Name: "F2closet", Base: "F2-101", Rx: 1, Ry: 1},
+	}
+	wantAssets := []Asset{
+		{Name: "A", Base: "F2-101", Rx: 1, Ry: 1, Weight: 2, Category: "laptop"},
+		{Name: "B", Base: "F2closet", Rx: 0, Ry: 1, Weight: 1},
+	}
+	if !reflect.DeepEqual(got.Spaces, wantSpaces) {
+		t.Errorf("cloneSubtree() spaces = %v, want %v", got.Spaces, wantSpaces)
+	}
+	if !reflect.DeepEqual(got.Assets, wantAssets) {
+		t.Errorf("cloneSubtree() assets = %v, want %v", got.Assets, wantAssets)
+	}
+
+	got.Spaces[1].Attrs["public"] = "false"
+	if subtree[1].Attrs["public"] != "true" {
+		t.Errorf("cloneSubtree() shares the attributes with the original")
+	}
+}
+
+func Test_cloneConflicts(t *testing.T) {
+	spaceList := []Space{{Name: "F2"}, {Name: "F2-101"}, {Name: "F2-101"}, {Name: "F2-102"}}
+	got := cloneConflicts(spaceList, map[string]bool{"F2-102": true})
+	want := []string{"the space F2-101 would be copied twice", "the space F2-102 already exists"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cloneConflicts() = %v, want %v", got, want)
+	}
+	if got := cloneConflicts(spaceList[:2], nil); len(got) != 0 {
+		t.Errorf("cloneConflicts() = %v, want none", got)
+	}
+}
@@ -0,0 +1,140 @@
+// Cron-like recurrence of the inspection plans
+
+package net
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronField is the set of the values allowed in a field, as bits
+type cronField uint64
+
+// cronSchedule is the parsed recurrence: minute hour day-of-month month day-of-week
+type cronSchedule struct {
+	minute, hour, dom, month, dow cronField
+	domStar, dowStar              bool
+}
+
+// the shorthands of the common recurrences
+var cronMacros = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *"}
+
+// parseCronField parses a field like *, */15, 1-5, 1-31/2 or 1,15 in [min, max]
+func parseCronField(expr string, min int, max int) (f cronField, err error) {
+	for _, part := range strings.Split(expr, ",") {
+		step, rangePart := 1, part
+		if i := strings.Index(part, "/"); i >= 0 {
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, errors.New("invalid step in " + part)
+			}
+			rangePart = part[:i]
+		}
+
+		lo, hi := min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, errors.New("invalid range " + rangePart)
+			}
+			if hi, err = strconv.Atoi(bounds[1]); err != nil {
+				return 0, errors.New("invalid range " + rangePart)
+			}
+		default:
+			if lo, err = strconv.Atoi(rangePart); err != nil {
+				return 0, errors.New("invalid value " + rangePart)
+			}
+			if rangePart == part { // a single value, unless stepping from it
+				hi = lo
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, errors.New(part + " out of range " + strconv.Itoa(min) + "-" + strconv.Itoa(max))
+		}
+
+		for v := lo; v <= hi; v += step {
+			f |= 1 << uint(v)
+		}
+	}
+	return f, nil
+}
+
+// parseCron parses the recurrence of 5 fields, or one of @hourly, @daily, @weekly, @monthly and @yearly
+func parseCron(expr string) (sched cronSchedule, err error) {
+	if macro, ok := cronMacros[strings.TrimSpace(expr)]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return sched, errors.New("recurrence should be 5 fields: minute hour day-of-month month day-of-week")
+	}
+
+	if sched.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return sched, err
+	}
+	if sched.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return sched, err
+	}
+	if sched.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return sched, err
+	}
+	if sched.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return sched, err
+	}
+	if sched.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return sched, err
+	}
+	if sched.dow&(1<<7) != 0 { // both 0 and 7 are Sunday
+		sched.dow |= 1
+	}
+	// a stepped star like */2 still counts as unrestricted, like the classic cron
+	sched.domStar, sched.dowStar = strings.HasPrefix(fields[2], "*"), strings.HasPrefix(fields[4], "*")
+	return sched, nil
+}
+
+// has tests whether the value is allowed in the field
+func (f cronField) has(v int) bool {
+	return f&(1<<uint(v)) != 0
+}
+
+// dayMatch tests the day: when both day-of-month and day-of-week are restricted,
+// either of them matching is enough, like the classic cron
+func (sched cronSchedule) dayMatch(t time.Time) bool {
+	domOk, dowOk := sched.dom.has(t.Day()), sched.dow.has(int(t.Weekday()))
+	if sched.domStar || sched.dowStar {
+		return domOk && dowOk
+	}
+	return domOk || dowOk
+}
+
+// next finds the first time matching the schedule after t, in t's location;
+// zero time if it never falls due in 5 years, like on Feb 30
+func (sched cronSchedule) next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case !sched.month.has(int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !sched.dayMatch(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case !sched.hour.has(t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case !sched.minute.has(t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,59 @@
+package net
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseCron(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr bool
+	}{
+		{"every minute", "* * * * *", false},
+		{"lists and steps", "0,30 9-17/2 1 */3 1-5", false},
+		{"macro", "@monthly", false},
+		{"sunday as 7", "0 0 * * 7", false},
+		{"too few fields", "0 9 1 *", true},
+		{"out of range", "60 * * * *", true},
+		{"reversed range", "0 17-9 * * *", true},
+		{"bad step", "*/0 * * * *", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseCron(tt.expr); (err != nil) != tt.wantErr {
+				t.Errorf("parseCron() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_cronSchedule_next(t *testing.T) {
+	from := time.Date(2019, 7, 1, 10, 30, 20, 0, time.UTC) // a Monday
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2019, 7, 1, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2019, 7, 1, 10, 45, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2019, 7, 2, 9, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2019, 8, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2019, 7, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 0 15 * 5", time.Date(2019, 7, 5, 0, 0, 0, 0, time.UTC)}, // the 15th or a Friday
+		{"0 9 */2 * 1", time.Date(2019, 7, 15, 9, 0, 0, 0, time.UTC)}, // an odd day and a Monday
+		{"0 0 29 2 *", time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			sched, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("parseCron() error = %v", err)
+			}
+			if got := sched.next(from); !got.Equal(tt.want) {
+				t.Errorf("cronSchedule.next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -18,6 +18,8 @@ import (
 	"encoding/json"
 )
 
+var errNoTransactions = errors.New("the transactions need MongoDB as a replica set")
+
 /*
 MongoDB collection structure:
 readygo(DB): {
@@ -25,13 +27,25 @@ readygo(DB): {
 		_id: "", // name
 		base: "",
 		rx: 0,
-		ry: 0
+		ry: 0,
+		width: 0,
+		height: 0,
+		outline: [{x: 0, y: 0}], // see geometry.go
+		rotation: 0, // degrees, see transform.go
+		scale: 1
 	},
 	Asset(Collection): {
 		_id: {name: "", base: ""},
 		rx: 0,
 		ry: 0,
-		weight: 1
+		weight: 1,
+		category: "",
+		serial: "",
+		owner: "",
+		purchasevalue: 0,
+		purchasedate: Date(),
+		attrs: {key: "value"},
+		status: "" // lifecycle, see status.go
 	}
 }*/
 
@@ -58,9 +72,68 @@ func (r *RestContext) connectMongoDB() (err error) {
 		return errors.New("Failed connecting to MongoDB database specified")
 	}
 
+	// the transactions need a replica set, or the mongos of a sharded cluster
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err = client.Database("admin").RunCommand(ctx, bson.D{{"isMaster", 1}}).Decode(&hello); err != nil {
+		log.Println("trying connecting to MongoDB server failed: " + err.Error())
+		return err
+	}
+	if r.transactions = hello.SetName != "" || hello.Msg == "isdbgrid"; !r.transactions {
+		log.Println("MongoDB is a standalone server: moving, patching the base, cloning and resurveying " +
+			"the spaces are unavailable, as they need the transactions of a replica set")
+	}
+
 	return nil
 }
 
+// dbEnsureIndexes creates the unique indexes on the names of the Spaces and on name@base of the
+// Assets, so that a duplicate inserted concurrently fails with a duplicate key error
+func (r RestContext) dbEnsureIndexes() error {
+	ctx, cf := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cf()
+
+	if _, err := r.mongoDB.Collection("space").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{"name", 1}}, Options: options.Index().SetUnique(true)}); err != nil {
+		return err
+	}
+	_, err := r.mongoDB.Collection("asset").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{"name", 1}, {"base", 1}}, Options: options.Index().SetUnique(true)})
+	return err
+}
+
+// dbTransaction runs fn in a MongoDB transaction, committed if fn succeeds and aborted otherwise;
+// fn reports the HTTP code of its error. Note that the transactions need a replica set (MongoDB 4.0+),
+// otherwise it fails with 503
+func (r RestContext) dbTransaction(timeout time.Duration, fn func(ctx mongo.SessionContext) (errCode int, err error)) (errCode int, err error) {
+	if !r.transactions {
+		return http.StatusServiceUnavailable, errNoTransactions
+	}
+	ctx, cf := context.WithTimeout(context.Background(), timeout)
+	defer cf()
+
+	errCode = http.StatusInternalServerError
+	err = r.mongoDB.Client().UseSession(ctx, func(sctx mongo.SessionContext) error {
+		if err := sctx.StartTransaction(); err != nil {
+			return err
+		}
+		code, err := fn(sctx)
+		if err != nil {
+			errCode = code
+			sctx.AbortTransaction(sctx)
+			return err
+		}
+		return sctx.CommitTransaction(sctx)
+	})
+	if err != nil {
+		log.Println(err)
+		return errCode, err
+	}
+	return http.StatusOK, nil
+}
+
 /*
 Redis Key names rules:
 - space-{space-name}: Space
@@ -91,8 +164,12 @@ func (r *RestContext) makeRedisPool() {
 }
 
 //dbInsertSpace accept []Space, insert them through goroutine to Redis,
-//at the same time insert to MongoDB, then returns the non-volatile DB insert error
+//at the same time insert to MongoDB, then returns the non-volatile DB insert error;
+//the Spaces should lie inside their parents
 func (r RestContext) dbInsertSpace(list []Space) (errCode int, err error) {
+	if errCode, err := r.checkPlacement(list, nil); err != nil {
+		return errCode, err
+	}
 
 	// insert into mongo
 	col := r.mongoDB.Collection("space")
@@ -146,10 +223,13 @@ func (r RestContext) dbInsertAsset(list []Asset) (errCode int, err error) {
 		baseSpaceSet[a.Base] = true
 	}
 	for k, _ := range baseSpaceSet {
-		if result := r.mongoDB.Collection("space").FindOne(ctx, bson.M{"base": k}); result.Err() != nil {
+		if result := r.mongoDB.Collection("space").FindOne(ctx, bson.M{"name": k}); result.Err() != nil {
 			return http.StatusForbidden, errors.New("some base spaces not exists now")
 		}
 	}
+	if errCode, err := r.checkPlacement(nil, list); err != nil {
+		return errCode, err
+	}
 
 	// insert into mongo
 	mongoHandler := r.mongoDB.Collection("asset")
@@ -260,6 +340,60 @@ func (r RestContext) dbGetSpace(name string, cacheFlag bool) (result *Space, err
 	return result, http.StatusOK, nil
 }
 
+// dbGetSubtreeSpaces finds the root space and all its sub-spaces in BFS order,
+// the cacheFlag works on the root space like in dbGetSpace
+func (r RestContext) dbGetSubtreeSpaces(rootSpace string, cacheFlag bool) (list []Space, errCode int, err error) {
+	rootPtr, errCode, err := r.dbGetSpace(rootSpace, cacheFlag)
+	if err != nil {
+		return nil, errCode, err
+	}
+
+	ctx, cf := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cf()
+
+	list = []Space{*rootPtr}
+	for head := 0; head < len(list); head++ {
+		cur, err := r.mongoDB.Collection("space").Find(ctx, bson.M{"base": list[head].Name})
+		if err != nil {
+			log.Println(err)
+			return nil, http.StatusInternalServerError, err
+		}
+		for cur.Next(ctx) {
+			var sp Space
+			if err = cur.Decode(&sp); err != nil {
+				log.Println(err)
+				return nil, http.StatusInternalServerError, err
+			}
+			list = append(list, sp)
+		}
+	}
+	return list, http.StatusOK, nil
+}
+
+// dbFindAssets finds the Assets matching the filter in MongoDB, sorted by base and name
+func (r RestContext) dbFindAssets(filter bson.M) (list []Asset, errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cf()
+
+	cur, err := r.mongoDB.Collection("asset").Find(ctx, filter, options.Find().SetSort(bson.D{{"base", 1}, {"name", 1}}))
+	if err != nil {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, err
+	}
+	defer cur.Close(ctx)
+
+	list = []Asset{}
+	for cur.Next(ctx) {
+		var as Asset
+		if err = cur.Decode(&as); err != nil {
+			log.Println(err)
+			return nil, http.StatusInternalServerError, err
+		}
+		list = append(list, as)
+	}
+	return list, http.StatusOK, nil
+}
+
 // dbUpdateAsset partically update the Asset, makes the new cache, and return the new Asset
 func (r RestContext) dbUpdateAsset(name string, base string, toSet bson.D) (newAssetPtr *Asset, errCode int, err error) {
 
@@ -336,33 +470,15 @@ func (r RestContext) dbDeleteAsset(name string, base string) (errCode int, err e
 func (r RestContext) dbDeleteSpace(rootSpace string) (errCode int, err error) {
 	var eg errgroup.Group
 
-	// store subspaces -> del this space by name -> find space's Assets
+	// find the space tree -> del every space by name -> find space's Assets
 	// -> del everyone in Redis -> del all Assets by base in mongo
-	bfsQueue := []string{rootSpace}
-
-	for len(bfsQueue) > 0 {
-		// read from head
-		base := bfsQueue[0]
-		bfsQueue = bfsQueue[1:]
+	spaceList, errCode, err := r.dbGetSubtreeSpaces(rootSpace, false)
+	if err != nil {
+		return errCode, err
+	}
 
-		{ // find subspaces
-			ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
-			defer cf()
-			cur, err := r.mongoDB.Collection("space").Find(ctx, bson.M{"base": base})
-			if err != nil {
-				log.Println(err)
-				return http.StatusInternalServerError, err
-			}
-			for cur.Next(ctx) {
-				var sp Space
-				err = cur.Decode(&sp)
-				if err != nil {
-					log.Println(err)
-					return http.StatusInternalServerError, err
-				}
-				bfsQueue = append(bfsQueue, sp.Name)
-			}
-		}
+	for _, sp := range spaceList {
+		base := sp.Name
 
 		{ // delete the space in mongo in the first place to avoid err (space not exist)
 			ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
@@ -0,0 +1,191 @@
+// Estimated time of arrival at every stop of a route, by walking speed and dwell time
+
+package net
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	dataio "github.com/miosolo/readygo/io"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+MongoDB collection structure:
+readygo(DB): {
+	DwellTime(Collection): {
+		category: "",
+		seconds: 0
+	}
+}*/
+
+// DEFAULT_DWELL_SECONDS is the time to check an Asset without its own or its category's
+const DEFAULT_DWELL_SECONDS = 30
+
+// DwellTime is the time to check an Asset of the category
+type DwellTime struct {
+	Category string  `json:"category" description:"the asset category"`
+	Seconds  float64 `json:"seconds" description:"seconds to check an asset of the category"`
+}
+
+// etaConfig tells how fast the inspector walks and how long the checks take
+type etaConfig struct {
+	Speed   float64            // walking speed, distance per second
+	Factors map[string]float64 // the space -> the ratio of the walking speed in it
+	Dwell   map[string]float64 // name@base of the Asset -> seconds to check it
+}
+
+// dwellOf is the time to check the Asset: its own, its category's, or the default
+func dwellOf(as Asset, categories map[string]float64) float64 {
+	if as.Dwell > 0 {
+		return as.Dwell
+	}
+	if seconds, ok := categories[as.category()]; ok {
+		return seconds
+	}
+	return DEFAULT_DWELL_SECONDS
+}
+
+// legSpace finds the space the inspector walks in from a to b: the base of the Asset
+// on either end, or the space entered or left through the doors
+func legSpace(a dataio.Checkpoint, b dataio.Checkpoint) string {
+	switch {
+	case !b.IsPortal:
+		return b.Base
+	case !a.IsPortal:
+		return a.Base
+	case b.Base == a.Name: // entering a's subspace
+		return b.Base
+	default: // leaving, or between doors in the same space
+		return a.Base
+	}
+}
+
+// estimateETA sets the cumulative ETA and dwell time of every checkpoint in the route,
+// and its total duration; the first one is where the inspector starts
+func estimateETA(rt *dataio.Route, cfg etaConfig) {
+	speed := cfg.Speed
+	if speed <= 0 {
+		speed = WALKING_SPEED
+	}
+
+	elapsed := 0.0
+	for i := range rt.Sequence {
+		cp := &rt.Sequence[i]
+		if i > 0 {
+			prev := rt.Sequence[i-1]
+			factor := cfg.Factors[legSpace(prev, *cp)]
+			if factor <= 0 {
+				factor = 1
+			}
+			elapsed += math.Hypot(cp.Rx-prev.Rx, cp.Ry-prev.Ry) / (speed * factor)
+		}
+
+		cp.ETA, cp.Dwell = elapsed, 0
+		if i > 0 && !cp.IsPortal {
+			cp.Dwell = cfg.Dwell[cp.Name+"@"+cp.Base]
+			elapsed += cp.Dwell
+		}
+	}
+	rt.Duration = elapsed
+}
+
+// formatDuration formats the seconds like 1h2m3s
+func formatDuration(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second).String()
+}
+
+// dbGetDwellTimes finds the dwell times of all the categories
+func (r RestContext) dbGetDwellTimes() (list []DwellTime, errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+
+	cur, err := r.mongoDB.Collection("dwelltime").Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{"category", 1}}))
+	if err != nil {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, err
+	}
+	defer cur.Close(ctx)
+
+	list = []DwellTime{}
+	for cur.Next(ctx) {
+		var dt DwellTime
+		if err = cur.Decode(&dt); err != nil {
+			log.Println(err)
+			return nil, http.StatusInternalServerError, err
+		}
+		list = append(list, dt)
+	}
+	return list, http.StatusOK, nil
+}
+
+// dbUpsertDwellTime sets the dwell time of the category
+func (r RestContext) dbUpsertDwellTime(dt DwellTime) (errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+
+	if _, err = r.mongoDB.Collection("dwelltime").ReplaceOne(ctx, bson.M{"category": dt.Category}, dt,
+		options.Replace().SetUpsert(true)); err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// dbDeleteDwellTime resets the dwell time of the category to the default
+func (r RestContext) dbDeleteDwellTime(category string) (errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+
+	deleteResult, err := r.mongoDB.Collection("dwelltime").DeleteOne(ctx, bson.M{"category": category})
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, err
+	}
+	if deleteResult.DeletedCount == 0 {
+		return http.StatusNotFound, errors.New("the category has no dwell time set")
+	}
+	return http.StatusOK, nil
+}
+
+// GET PREFIX/dwell-times
+func (r RestContext) findDwellTimes(req *restful.Request, resp *restful.Response) {
+	list, errCode, err := r.dbGetDwellTimes()
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, list)
+}
+
+// PUT PREFIX/dwell-times/{category}?seconds=xx
+func (r RestContext) putDwellTime(req *restful.Request, resp *restful.Response) {
+	seconds, err := strconv.ParseFloat(req.QueryParameter("seconds"), 64)
+	if err != nil || seconds < 0 {
+		resp.WriteError(http.StatusNotAcceptable, errors.New("dwell seconds should be a non-negative number"))
+		return
+	}
+
+	dt := DwellTime{Category: req.PathParameter("category"), Seconds: seconds}
+	if errCode, err := r.dbUpsertDwellTime(dt); err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, dt)
+}
+
+// DELETE PREFIX/dwell-times/{category}
+func (r RestContext) deleteDwellTime(req *restful.Request, resp *restful.Response) {
+	if errCode, err := r.dbDeleteDwellTime(req.PathParameter("category")); err != nil {
+		resp.WriteError(errCode, err)
+	} else {
+		resp.WriteHeader(http.StatusOK)
+	}
+}
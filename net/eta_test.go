@@ -0,0 +1,76 @@
+package net
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/miosolo/readygo/io"
+)
+
+func Test_legSpace(t *testing.T) {
+	room := Checkpoint{Name: "Meeting Room", Base: "base", IsPortal: true}
+	closet := Checkpoint{Name: "Closet", Base: "Meeting Room", IsPortal: true}
+	lobby := Checkpoint{Name: "Lobby", Base: "base", IsPortal: true}
+	tests := []struct {
+		name string
+		a, b Checkpoint
+		want string
+	}{
+		{"to an asset", room, Checkpoint{Name: "D", Base: "Meeting Room"}, "Meeting Room"},
+		{"from an asset", Checkpoint{Name: "D", Base: "Meeting Room"}, room, "Meeting Room"},
+		{"entering a subspace", room, closet, "Meeting Room"},
+		{"leaving a subspace", closet, room, "Meeting Room"},
+		{"between doors", room, lobby, "base"},
+	}
+	for _, tt := range tests {
+		if got := legSpace(tt.a, tt.b); got != tt.want {
+			t.Errorf("legSpace() %v = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func Test_dwellOf(t *testing.T) {
+	categories := map[string]float64{"laptop": 60}
+	tests := []struct {
+		name  string
+		asset Asset
+		want  float64
+	}{
+		{"own", Asset{Dwell: 10, Attrs: map[string]string{"category": "laptop"}}, 10},
+		{"category", Asset{Attrs: map[string]string{"category": "laptop"}}, 60},
+		{"default", Asset{}, DEFAULT_DWELL_SECONDS},
+	}
+	for _, tt := range tests {
+		if got := dwellOf(tt.asset, categories); got != tt.want {
+			t.Errorf("dwellOf() %v = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func Test_estimateETA(t *testing.T) {
+	rt := Route{Sequence: []Checkpoint{
+		Checkpoint{Name: "init point", Base: "base", Rx: 0, Ry: 0},
+		Checkpoint{Name: "A", Base: "base", Rx: 3, Ry: 4},
+		Checkpoint{Name: "Meeting Room", Base: "base", Rx: 3, Ry: 6, IsPortal: true},
+		Checkpoint{Name: "D", Base: "Meeting Room", Rx: 3, Ry: 7},
+		Checkpoint{Name: "Meeting Room", Base: "base", Rx: 3, Ry: 6, IsPortal: true}}}
+	cfg := etaConfig{
+		Speed:   1,
+		Factors: map[string]float64{"Meeting Room": 0.5}, // crowded, half the speed
+		Dwell:   map[string]float64{"A@base": 10, "D@Meeting Room": 20}}
+	estimateETA(&rt, cfg)
+
+	wantETA := []float64{0, 5, 17, 19, 41}
+	wantDwell := []float64{0, 10, 0, 20, 0}
+	for i, cp := range rt.Sequence {
+		if math.Abs(cp.ETA-wantETA[i]) > 1e-9 || cp.Dwell != wantDwell[i] {
+			t.Errorf("estimateETA() %v: eta = %v, dwell = %v, want %v, %v", cp.Name, cp.ETA, cp.Dwell, wantETA[i], wantDwell[i])
+		}
+	}
+	if math.Abs(rt.Duration-41) > 1e-9 {
+		t.Errorf("estimateETA() duration = %v, want 41", rt.Duration)
+	}
+	if got := formatDuration(3723.4); got != "1h2m3s" {
+		t.Errorf("formatDuration() = %v, want 1h2m3s", got)
+	}
+}
@@ -0,0 +1,454 @@
+// Checking the consistency of the Spaces, the Assets and their cache, and fixing what is found
+
+package net
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/gomodule/redigo/redis"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LOST_FOUND is the top space the orphans are moved into by the fixes
+const LOST_FOUND = "lost+found"
+
+// the kinds of the problems
+const (
+	FSCK_DUPLICATE   = "duplicate"
+	FSCK_NON_FINITE  = "non-finite"
+	FSCK_NEGATIVE    = "negative-weight"
+	FSCK_ORPHAN      = "orphan"
+	FSCK_CYCLE       = "cycle"
+	FSCK_STALE_CACHE = "stale-cache"
+	FSCK_CACHE_DRIFT = "cache-drift"
+)
+
+// FSCK_SCAN_COUNT is how many Redis keys a SCAN looks at
+const FSCK_SCAN_COUNT = 1000
+
+// FsckProblem is an inconsistency found, and how it is fixed
+type FsckProblem struct {
+	Kind     string `json:"kind" description:"duplicate, non-finite, negative-weight, orphan, cycle, stale-cache or cache-drift"`
+	Key      string `json:"key" description:"space-{name}, {name}@{base}, or the Redis key"`
+	Message  string `json:"message" description:"what is wrong"`
+	Fix      string `json:"fix" description:"what the fix does"`
+	Fixed    bool   `json:"fixed" description:"whether it is fixed in this run"`
+	FixError string `json:"fixError,omitempty" description:"why the fix failed, if it did"`
+	fix      fsckFix
+}
+
+// FsckReport lists the problems found in the check
+type FsckReport struct {
+	Time      time.Time     `json:"time" description:"when it is checked"`
+	Spaces    int           `json:"spaces" description:"the space documents checked"`
+	Assets    int           `json:"assets" description:"the asset documents checked"`
+	CacheKeys int           `json:"cacheKeys" description:"the Redis keys of the spaces and the assets checked"`
+	Fix       bool          `json:"fix" description:"whether the problems are fixed in this run"`
+	Problems  []FsckProblem `json:"problems" description:"the problems found, by kind and key"`
+}
+
+// fsckFix updates or deletes the document matching, and drops the cache
+type fsckFix struct {
+	collection string
+	filter     bson.M
+	update     bson.M // nil to delete
+	cacheKey   string
+	lostFound  bool // needs the lost+found space
+}
+
+// spaceDoc is the Space with its document id, to tell the duplicates apart
+type spaceDoc struct {
+	ID    interface{} `bson:"_id"`
+	Space `bson:",inline"`
+}
+
+// assetDoc is the Asset with its document id
+type assetDoc struct {
+	ID    interface{} `bson:"_id"`
+	Asset `bson:",inline"`
+}
+
+func finite(values ...float64) bool {
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// spaceFinite checks the numbers of the Space, returning the fields to reset
+func spaceFinite(sp Space) (reset bson.M) {
+	reset = bson.M{}
+	for field, v := range map[string]float64{"rx": sp.Rx, "ry": sp.Ry, "rotation": sp.Rotation,
+		"scale": sp.Scale, "width": sp.Width, "height": sp.Height, "speedfactor": sp.SpeedFactor} {
+		if !finite(v) {
+			reset[field] = 0.0
+		}
+	}
+	for _, p := range sp.Outline {
+		if !finite(p.X, p.Y) {
+			reset["outline"] = nil
+		}
+	}
+	return reset
+}
+
+func sortedKeys(m bson.M) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// fsckDocuments finds the problems in the documents of the Spaces and the Assets, with their fixes:
+// the duplicates after the first are deleted, the invalid numbers reset, and the orphans and the
+// cycles moved into lost+found
+func fsckDocuments(spaceList []spaceDoc, assetList []assetDoc) (problems []FsckProblem, spaces map[string]Space) {
+	problems = []FsckProblem{}
+
+	spaces = make(map[string]Space, len(spaceList))
+	for _, doc := range spaceList {
+		sp, key := doc.Space, "space-"+doc.Name
+		if _, ok := spaces[sp.Name]; ok {
+			problems = append(problems, FsckProblem{Kind: FSCK_DUPLICATE, Key: key,
+				Message: fmt.Sprintf("the space %s has another document %v", sp.Name, doc.ID),
+				Fix:     "delete the later document", fix: fsckFix{collection: "space", filter: bson.M{"_id": doc.ID}, cacheKey: key}})
+			continue
+		}
+		spaces[sp.Name] = sp
+		if reset := spaceFinite(sp); len(reset) > 0 {
+			problems = append(problems, FsckProblem{Kind: FSCK_NON_FINITE, Key: key,
+				Message: "the space " + sp.Name + " has invalid " + strings.Join(sortedKeys(reset), ", "),
+				Fix:     "reset them to 0, or remove the outline",
+				fix:     fsckFix{collection: "space", filter: bson.M{"_id": doc.ID}, update: bson.M{"$set": reset}, cacheKey: key}})
+		}
+	}
+
+	assets := make(map[string]bool, len(assetList))
+	lostNames := map[string]bool{} // the names taken in lost+found, by the assets there or moved there
+	for _, doc := range assetList {
+		if doc.Base == LOST_FOUND {
+			lostNames[doc.Name] = true
+		}
+	}
+	for _, doc := range assetList {
+		as, key := doc.Asset, doc.Name+"@"+doc.Base
+		byID := bson.M{"_id": doc.ID}
+		if assets[key] {
+			problems = append(problems, FsckProblem{Kind: FSCK_DUPLICATE, Key: key,
+				Message: fmt.Sprintf("the asset %s has another document %v", key, doc.ID),
+				Fix:     "delete the later document", fix: fsckFix{collection: "asset", filter: byID, cacheKey: key}})
+			continue
+		}
+		assets[key] = true
+
+		if !finite(as.Rx, as.Ry) {
+			problems = append(problems, FsckProblem{Kind: FSCK_NON_FINITE, Key: key,
+				Message: "the asset " + key + " has an invalid position", Fix: "reset it to the door (0, 0)",
+				fix: fsckFix{collection: "asset", filter: byID, update: bson.M{"$set": bson.M{"rx": 0.0, "ry": 0.0}}, cacheKey: key}})
+		}
+		if !finite(as.Weight) || as.Weight < 0 {
+			problems = append(problems, FsckProblem{Kind: FSCK_NEGATIVE, Key: key,
+				Message: "the asset " + key + " has the weight " + strconv.FormatFloat(as.Weight, 'g', -1, 64),
+				Fix:     "reset it to 1",
+				fix:     fsckFix{collection: "asset", filter: byID, update: bson.M{"$set": bson.M{"weight": 1.0}}, cacheKey: key}})
+		}
+		if _, ok := spaces[as.Base]; !ok && as.Base != LOST_FOUND {
+			name := as.Name
+			for i := 2; lostNames[name]; i++ {
+				name = as.Name + "~" + strconv.Itoa(i)
+			}
+			lostNames[name] = true
+			// keep the original base in the attrs, the whole map set as it may be null
+			attrs := bson.M{}
+			for k, v := range as.Attrs {
+				attrs[k] = v
+			}
+			attrs["lostFrom"] = as.Base
+			problems = append(problems, FsckProblem{Kind: FSCK_ORPHAN, Key: key,
+				Message: "the base space of the asset " + key + " does not exist",
+				Fix:     "move it into " + LOST_FOUND + " as " + name + ", with the attr lostFrom: " + as.Base,
+				fix: fsckFix{collection: "asset", filter: byID, cacheKey: key, lostFound: true,
+					update: bson.M{"$set": bson.M{"name": name, "base": LOST_FOUND, "attrs": attrs}}}})
+		}
+	}
+
+	names := make([]string, 0, len(spaces))
+	for name := range spaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	moveSpace := func(name string) fsckFix {
+		return fsckFix{collection: "space", filter: bson.M{"name": name}, cacheKey: "space-" + name, lostFound: true,
+			update: bson.M{"$set": bson.M{"base": LOST_FOUND}}}
+	}
+	for _, name := range names {
+		if base := spaces[name].Base; base != "" {
+			if _, ok := spaces[base]; !ok {
+				problems = append(problems, FsckProblem{Kind: FSCK_ORPHAN, Key: "space-" + name,
+					Message: "the base space " + base + " of the space " + name + " does not exist",
+					Fix:     "move it into " + LOST_FOUND, fix: moveSpace(name)})
+			}
+		}
+	}
+
+	// follow the bases from every space, a cycle is met again on the same walk
+	walked := make(map[string]int, len(spaces)) // the walk visiting it first
+	for i, name := range names {
+		path := []string{}
+		for cur := name; ; cur = spaces[cur].Base {
+			if _, ok := spaces[cur]; !ok {
+				break
+			}
+			if w, ok := walked[cur]; ok {
+				if w == i { // the cycle from cur on
+					for j, n := range path {
+						if n == cur {
+							cycle := append([]string{}, path[j:]...)
+							sort.Strings(cycle)
+							problems = append(problems, FsckProblem{Kind: FSCK_CYCLE, Key: "space-" + cycle[0],
+								Message: "the spaces " + strings.Join(cycle, ", ") + " lie in each other",
+								Fix:     "move " + cycle[0] + " into " + LOST_FOUND, fix: moveSpace(cycle[0])})
+							break
+						}
+					}
+				}
+				break
+			}
+			walked[cur] = i
+			path = append(path, cur)
+		}
+	}
+
+	sortProblems(problems)
+	return problems, spaces
+}
+
+// normalizeAsset keeps the times as precise as MongoDB does, to compare the cache
+func normalizeAsset(as Asset) Asset {
+	as.LastChecked = as.LastChecked.UTC().Truncate(time.Millisecond)
+	as.PurchaseDate = as.PurchaseDate.UTC().Truncate(time.Millisecond)
+	return as
+}
+
+// sameJSON tells whether the two are encoded the same
+func sameJSON(a interface{}, b interface{}) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
+
+// fsckCache compares the cached Spaces and Assets by their Redis keys to the documents in MongoDB;
+// the keys stale or drifted are dropped by the fixes, and read from MongoDB again
+func fsckCache(cache map[string][]byte, spaces map[string]Space, assetList []assetDoc) []FsckProblem {
+	problems := []FsckProblem{}
+	assets := make(map[string]Asset, len(assetList))
+	for _, doc := range assetList {
+		if _, ok := assets[doc.Name+"@"+doc.Base]; !ok {
+			assets[doc.Name+"@"+doc.Base] = doc.Asset
+		}
+	}
+
+	for key, data := range cache {
+		var inDB, cached interface{}
+		_, isSpace := spaces[strings.TrimPrefix(key, "space-")]
+		isSpace = strings.HasPrefix(key, "space-") && (isSpace || !strings.Contains(key, "@"))
+		if isSpace {
+			sp, ok := spaces[strings.TrimPrefix(key, "space-")]
+			var c Space
+			inDB, cached = sp, &c
+			if !ok {
+				inDB = nil
+			} else if json.Unmarshal(data, &c) == nil {
+				cached = c
+			}
+		} else {
+			as, ok := assets[key]
+			var c Asset
+			inDB, cached = normalizeAsset(as), &c
+			if !ok {
+				inDB = nil
+			} else if json.Unmarshal(data, &c) == nil {
+				cached = normalizeAsset(c)
+			}
+		}
+
+		drop := fsckFix{cacheKey: key}
+		if inDB == nil {
+			problems = append(problems, FsckProblem{Kind: FSCK_STALE_CACHE, Key: key,
+				Message: "the cache of " + key + " is not in MongoDB", Fix: "delete the key", fix: drop})
+		} else if !sameJSON(inDB, cached) {
+			problems = append(problems, FsckProblem{Kind: FSCK_CACHE_DRIFT, Key: key,
+				Message: "the cache of " + key + " differs from MongoDB", Fix: "delete the key", fix: drop})
+		}
+	}
+	sortProblems(problems)
+	return problems
+}
+
+func sortProblems(problems []FsckProblem) {
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].Kind != problems[j].Kind {
+			return problems[i].Kind < problems[j].Kind
+		}
+		return problems[i].Key < problems[j].Key
+	})
+}
+
+// dbLoadFsck reads all the documents of the Spaces and the Assets, and their cache
+func (r RestContext) dbLoadFsck() (spaceList []spaceDoc, assetList []assetDoc, cache map[string][]byte, errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cf()
+
+	load := func(collection string, decode func(*mongo.Cursor) error) error {
+		cur, err := r.mongoDB.Collection(collection).Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+		if err != nil {
+			return err
+		}
+		defer cur.Close(ctx)
+		for cur.Next(ctx) {
+			if err := decode(cur); err != nil {
+				return err
+			}
+		}
+		return cur.Err()
+	}
+	if err = load("space", func(cur *mongo.Cursor) error {
+		var doc spaceDoc
+		err := cur.Decode(&doc)
+		spaceList = append(spaceList, doc)
+		return err
+	}); err != nil {
+		log.Println(err)
+		return nil, nil, nil, http.StatusInternalServerError, err
+	}
+	if err = load("asset", func(cur *mongo.Cursor) error {
+		var doc assetDoc
+		err := cur.Decode(&doc)
+		assetList = append(assetList, doc)
+		return err
+	}); err != nil {
+		log.Println(err)
+		return nil, nil, nil, http.StatusInternalServerError, err
+	}
+
+	redisConn := r.redisConnPool.Get()
+	defer redisConn.Close()
+	cache = make(map[string][]byte)
+	for _, pattern := range []string{"space-*", "*@*"} {
+		for cursor := 0; ; {
+			values, err := redis.Values(redisConn.Do("SCAN", cursor, "MATCH", pattern, "COUNT", FSCK_SCAN_COUNT))
+			if err != nil {
+				log.Println(err)
+				return nil, nil, nil, http.StatusInternalServerError, err
+			}
+			keys, _ := redis.Strings(values[1], nil)
+			for _, k := range keys {
+				if data, err := redis.Bytes(redisConn.Do("GET", k)); err == nil {
+					cache[k] = data
+				}
+			}
+			if cursor, _ = redis.Int(values[0], nil); cursor == 0 {
+				break
+			}
+		}
+	}
+	return spaceList, assetList, cache, http.StatusOK, nil
+}
+
+// dbFix applies the fixes of the problems one by one, creating lost+found if needed
+func (r RestContext) dbFix(problems []FsckProblem) {
+	ctx, cf := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cf()
+	redisConn := r.redisConnPool.Get()
+	defer redisConn.Close()
+
+	lostFound := false
+	for i := range problems {
+		fix := &problems[i].fix
+		var err error
+		if fix.lostFound && !lostFound {
+			if _, _, e := r.dbGetSpace(LOST_FOUND, false); e != nil {
+				_, err = r.mongoDB.Collection("space").InsertOne(ctx, Space{Name: LOST_FOUND})
+			}
+			lostFound = err == nil
+		}
+		if err == nil && fix.collection != "" {
+			if fix.update == nil {
+				_, err = r.mongoDB.Collection(fix.collection).DeleteOne(ctx, fix.filter)
+			} else {
+				_, err = r.mongoDB.Collection(fix.collection).UpdateOne(ctx, fix.filter, fix.update)
+			}
+		}
+		if err == nil && fix.cacheKey != "" {
+			_, err = redisConn.Do("DEL", fix.cacheKey)
+		}
+
+		if err != nil {
+			log.Println(err)
+			problems[i].FixError = err.Error()
+		} else {
+			problems[i].Fixed = true
+		}
+	}
+}
+
+// Fsck checks the Spaces, the Assets and their cache, and fixes the problems if asked
+func (r RestContext) Fsck(fix bool) (report FsckReport, errCode int, err error) {
+	spaceList, assetList, cache, errCode, err := r.dbLoadFsck()
+	if err != nil {
+		return report, errCode, err
+	}
+	problems, spaces := fsckDocuments(spaceList, assetList)
+	problems = append(problems, fsckCache(cache, spaces, assetList)...)
+	if fix {
+		r.dbFix(problems)
+		if err := r.dbEnsureIndexes(); err != nil { // once the duplicates are gone
+			log.Println(err)
+		}
+	}
+	return FsckReport{Time: time.Now(), Spaces: len(spaceList), Assets: len(assetList), CacheKeys: len(cache),
+		Fix: fix, Problems: problems}, http.StatusOK, nil
+}
+
+// GET PREFIX/admin/fsck, or POST to fix
+func (r RestContext) fsck(req *restful.Request, resp *restful.Response) {
+	report, errCode, err := r.Fsck(req.Request.Method == http.MethodPost)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, report)
+}
+
+// String prints the report in lines, for the command line
+func (report FsckReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "checked %d spaces, %d assets and %d cache keys: %d problems\n",
+		report.Spaces, report.Assets, report.CacheKeys, len(report.Problems))
+	for _, p := range report.Problems {
+		status := "fix: " + p.Fix
+		if p.Fixed {
+			status = "fixed: " + p.Fix
+		} else if p.FixError != "" {
+			status = "fix failed: " + p.FixError
+		}
+		fmt.Fprintf(&b, "%-16s %s: %s (%s)\n", p.Kind, p.Key, p.Message, status)
+	}
+	return b.String()
+}
@@ -0,0 +1,125 @@
+package net
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	dataio "github.com/miosolo/readygo/io"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func kindsAndKeys(problems []FsckProblem) [][2]string {
+	res := [][2]string{}
+	for _, p := range problems {
+		res = append(res, [2]string{p.Kind, p.Key})
+	}
+	return res
+}
+
+func Test_fsckDocuments(t *testing.T) {
+	spaceList := []spaceDoc{
+		{ID: 1, Space: Space{Name: "building", Base: ""}},
+		{ID: 2, Space: Space{Name: "floor", Base: "building"}},
+		{ID: 3, Space: Space{Name: "floor", Base: "building", Rx: 1}},
+		{ID: 4, Space: Space{Name: "annex", Base: "demolished"}},
+		{ID: 5, Space: Space{Name: "a", Base: "c"}},
+		{ID: 6, Space: Space{Name: "b", Base: "a"}},
+		{ID: 7, Space: Space{Name: "c", Base: "b"}},
+		{ID: 8, Space: Space{Name: "d", Base: "c"}}, // hangs on the cycle
+		{ID: 9, Space: Space{Name: "room", Base: "floor", Rotation: math.NaN(),
+			Outline: []dataio.Point{{X: 0, Y: 0}, {X: math.Inf(1), Y: 0}, {X: 0, Y: 1}}}},
+		{ID: 10, Space: Space{Name: "top", Base: "base"}},
+	}
+	assetList := []assetDoc{
+		{ID: 11, Asset: Asset{Name: "A", Base: "floor", Weight: 1}},
+		{ID: 12, Asset: Asset{Name: "A", Base: "floor", Weight: 2}},
+		{ID: 13, Asset: Asset{Name: "B", Base: "floor", Rx: math.NaN(), Weight: -1}},
+		{ID: 14, Asset: Asset{Name: "C", Base: "gone", Weight: 1, Attrs: map[string]string{"color": "red"}}},
+		{ID: 15, Asset: Asset{Name: "C", Base: LOST_FOUND, Weight: 1}},
+	}
+
+	problems, spaces := fsckDocuments(spaceList, assetList)
+	want := [][2]string{
+		{FSCK_CYCLE, "space-a"},
+		{FSCK_DUPLICATE, "A@floor"},
+		{FSCK_DUPLICATE, "space-floor"},
+		{FSCK_NEGATIVE, "B@floor"},
+		{FSCK_NON_FINITE, "B@floor"},
+		{FSCK_NON_FINITE, "space-room"},
+		{FSCK_ORPHAN, "C@gone"},
+		{FSCK_ORPHAN, "space-annex"},
+		{FSCK_ORPHAN, "space-top"},
+	}
+	if got := kindsAndKeys(problems); !reflect.DeepEqual(got, want) {
+		t.Errorf("fsckDocuments() = %v, want %v", got, want)
+	}
+	if spaces["floor"].Rx != 0 {
+		t.Errorf("fsckDocuments() keeps %v, want the first document", spaces["floor"])
+	}
+
+	fixes := map[[2]string]fsckFix{}
+	for _, p := range problems {
+		fixes[[2]string{p.Kind, p.Key}] = p.fix
+	}
+	tests := []struct {
+		name string
+		key  [2]string
+		want fsckFix
+	}{
+		{"the later duplicate deleted", [2]string{FSCK_DUPLICATE, "space-floor"},
+			fsckFix{collection: "space", filter: bson.M{"_id": 3}, cacheKey: "space-floor"}},
+		{"the invalid numbers reset", [2]string{FSCK_NON_FINITE, "space-room"},
+			fsckFix{collection: "space", filter: bson.M{"_id": 9}, cacheKey: "space-room",
+				update: bson.M{"$set": bson.M{"rotation": 0.0, "outline": nil}}}},
+		{"the cycle broken", [2]string{FSCK_CYCLE, "space-a"},
+			fsckFix{collection: "space", filter: bson.M{"name": "a"}, cacheKey: "space-a", lostFound: true,
+				update: bson.M{"$set": bson.M{"base": LOST_FOUND}}}},
+		{"the orphan asset moved, renamed past the one in lost+found", [2]string{FSCK_ORPHAN, "C@gone"},
+			fsckFix{collection: "asset", filter: bson.M{"_id": 14}, cacheKey: "C@gone", lostFound: true,
+				update: bson.M{"$set": bson.M{"name": "C~2", "base": LOST_FOUND,
+					"attrs": bson.M{"color": "red", "lostFrom": "gone"}}}}},
+		{"the space in the missing space base moved", [2]string{FSCK_ORPHAN, "space-top"},
+			fsckFix{collection: "space", filter: bson.M{"name": "top"}, cacheKey: "space-top", lostFound: true,
+				update: bson.M{"$set": bson.M{"base": LOST_FOUND}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fixes[tt.key]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fsckDocuments() fix = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_fsckCache(t *testing.T) {
+	bought := time.Date(2019, 7, 1, 8, 0, 0, 0, time.FixedZone("CST", 8*3600))
+	spaces := map[string]Space{"floor": {Name: "floor", Base: "building"}}
+	assetList := []assetDoc{
+		{ID: 1, Asset: Asset{Name: "A", Base: "floor", Weight: 1, PurchaseDate: bought.UTC()}},
+		{ID: 2, Asset: Asset{Name: "B", Base: "floor", Weight: 1}},
+	}
+	encode := func(v interface{}) []byte {
+		b, _ := json.Marshal(v)
+		return b
+	}
+	cache := map[string][]byte{
+		"space-floor": encode(Space{Name: "floor", Base: "building"}),
+		"space-gone":  encode(Space{Name: "gone"}),
+		"A@floor":     encode(Asset{Name: "A", Base: "floor", Weight: 1, PurchaseDate: bought}), // the same time
+		"B@floor":     encode(Asset{Name: "B", Base: "floor", Weight: 3}),
+		"C@floor":     []byte("not json"),
+	}
+
+	got := kindsAndKeys(fsckCache(cache, spaces, assetList))
+	want := [][2]string{
+		{FSCK_CACHE_DRIFT, "B@floor"},
+		{FSCK_STALE_CACHE, "C@floor"},
+		{FSCK_STALE_CACHE, "space-gone"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fsckCache() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,173 @@
+// Geometry of the Spaces: their outlines, and keeping the Assets and the subspaces inside them
+
+package net
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	dataio "github.com/miosolo/readygo/io"
+)
+
+// GEOMETRY_EPSILON is how far a point can be off an edge and still be on it
+const GEOMETRY_EPSILON = 1e-9
+
+// boundary is the polygon of the Space in its own coordinates, nil if it has no extent
+func (sp Space) boundary() []dataio.Point {
+	if len(sp.Outline) > 0 {
+		return sp.Outline
+	}
+	if sp.Width > 0 && sp.Height > 0 {
+		return []dataio.Point{{X: 0, Y: 0}, {X: sp.Width, Y: 0}, {X: sp.Width, Y: sp.Height}, {X: 0, Y: sp.Height}}
+	}
+	return nil
+}
+
+// polygonArea is the signed area of the polygon, positive if counter-clockwise
+func polygonArea(poly []dataio.Point) float64 {
+	area := 0.0
+	for i, j := 0, len(poly)-1; i < len(poly); j, i = i, i+1 {
+		area += poly[j].X*poly[i].Y - poly[i].X*poly[j].Y
+	}
+	return area / 2
+}
+
+// onSegment tells whether (x, y) is on the segment from a to b
+func onSegment(a dataio.Point, b dataio.Point, x float64, y float64) bool {
+	cross := (b.X-a.X)*(y-a.Y) - (b.Y-a.Y)*(x-a.X)
+	if math.Abs(cross) > GEOMETRY_EPSILON*(math.Abs(b.X-a.X)+math.Abs(b.Y-a.Y)+1) {
+		return false
+	}
+	return x >= math.Min(a.X, b.X)-GEOMETRY_EPSILON && x <= math.Max(a.X, b.X)+GEOMETRY_EPSILON &&
+		y >= math.Min(a.Y, b.Y)-GEOMETRY_EPSILON && y <= math.Max(a.Y, b.Y)+GEOMETRY_EPSILON
+}
+
+// containsPoint tells whether (x, y) is inside the polygon or on its edges, by ray casting
+func containsPoint(poly []dataio.Point, x float64, y float64) bool {
+	inside := false
+	for i, j := 0, len(poly)-1; i < len(poly); j, i = i, i+1 {
+		a, b := poly[i], poly[j]
+		if onSegment(a, b, x, y) {
+			return true
+		}
+		if (a.Y > y) != (b.Y > y) && x < (b.X-a.X)*(y-a.Y)/(b.Y-a.Y)+a.X {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// validGeometry checks the Space's extent: either an outline, or both width and height,
+// with its door (0, 0) inside
+func validGeometry(sp Space) error {
+	if math.IsNaN(sp.Rotation) || math.IsInf(sp.Rotation, 0) {
+		return errors.New("the rotation of " + sp.Name + " should be a number")
+	}
+	if !(sp.Scale >= 0) || math.IsInf(sp.Scale, 0) {
+		return errors.New("the scale of " + sp.Name + " should be a positive number")
+	}
+	if sp.Width < 0 || sp.Height < 0 {
+		return errors.New("the width and height of " + sp.Name + " should not be negative")
+	}
+	if (sp.Width > 0) != (sp.Height > 0) {
+		return errors.New("the space " + sp.Name + " should have both width and height")
+	}
+	if len(sp.Outline) > 0 && sp.Width > 0 {
+		return errors.New("the space " + sp.Name + " should have either an outline or width and height")
+	}
+	if len(sp.Outline) > 0 && len(sp.Outline) < 3 {
+		return errors.New("the outline of " + sp.Name + " should have at least 3 vertices")
+	}
+
+	poly := sp.boundary()
+	for _, v := range poly {
+		if math.IsNaN(v.X) || math.IsNaN(v.Y) || math.IsInf(v.X, 0) || math.IsInf(v.Y, 0) {
+			return errors.New("the outline of " + sp.Name + " has an invalid vertex")
+		}
+	}
+	if poly != nil && math.Abs(polygonArea(poly)) < GEOMETRY_EPSILON {
+		return errors.New("the outline of " + sp.Name + " has no area")
+	}
+	if poly != nil && !containsPoint(poly, 0, 0) {
+		return errors.New("the door (0, 0) of " + sp.Name + " should be inside its outline")
+	}
+	return nil
+}
+
+// placementErrors lists what lies outside its parent's outline: the door and the corners of
+// the Spaces in the parent's coordinates, and the Assets; the parents without outlines contain everything
+func placementErrors(spaceList []Space, assetList []Asset, parents map[string]Space) []string {
+	errs := []string{}
+	inside := func(base string, x float64, y float64) bool {
+		parent, ok := parents[base]
+		if !ok {
+			return true // checked elsewhere
+		}
+		poly := parent.boundary()
+		return poly == nil || containsPoint(poly, x, y)
+	}
+
+	for _, sp := range spaceList {
+		if err := validGeometry(sp); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		ok := inside(sp.Base, sp.Rx, sp.Ry)
+		toParent := localTransform(sp)
+		for _, v := range sp.boundary() {
+			x, y := toParent.Apply(v.X, v.Y)
+			ok = ok && inside(sp.Base, x, y)
+		}
+		if !ok {
+			errs = append(errs, "the space "+sp.Name+" is out of "+sp.Base)
+		}
+	}
+	for _, as := range assetList {
+		if !inside(as.Base, as.Rx, as.Ry) {
+			errs = append(errs, "the asset "+as.Name+"@"+as.Base+" is out of "+as.Base)
+		}
+	}
+	return errs
+}
+
+// checkPlacement validates the geometry of the Spaces, and that the Spaces and the Assets lie
+// inside their parents; the parents are looked up in the list first, then in the DB
+func (r RestContext) checkPlacement(spaceList []Space, assetList []Asset) (errCode int, err error) {
+	parents := make(map[string]Space, len(spaceList))
+	for _, sp := range spaceList {
+		parents[sp.Name] = sp
+	}
+	lookup := func(base string) {
+		if _, ok := parents[base]; !ok && base != "" {
+			if sp, _, err := r.dbGetSpace(base, false); err == nil {
+				parents[base] = *sp
+			}
+		}
+	}
+	for _, sp := range spaceList {
+		lookup(sp.Base)
+	}
+	for _, as := range assetList {
+		lookup(as.Base)
+	}
+
+	if errs := placementErrors(spaceList, assetList, parents); len(errs) > 0 {
+		sort.Strings(errs)
+		return http.StatusNotAcceptable, errors.New(strings.Join(errs, "; "))
+	}
+	return http.StatusOK, nil
+}
+
+// outlineOf is the Space's boundary mapped by the transform, like to the root's coordinates to draw on the route
+func outlineOf(sp Space, t Transform) dataio.Outline {
+	poly := sp.boundary()
+	outline := dataio.Outline{Name: sp.Name, Points: make([]dataio.Point, 0, len(poly))}
+	for _, v := range poly {
+		x, y := t.Apply(v.X, v.Y)
+		outline.Points = append(outline.Points, dataio.Point{X: x, Y: y})
+	}
+	return outline
+}
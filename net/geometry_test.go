@@ -0,0 +1,81 @@
+package net
+
+import (
+	"reflect"
+	"testing"
+
+	dataio "github.com/miosolo/readygo/io"
+)
+
+func Test_containsPoint(t *testing.T) {
+	// an L-shaped room
+	poly := []dataio.Point{{X: 0, Y: 0}, {X: 4, Y: 0}, {X: 4, Y: 2}, {X: 2, Y: 2}, {X: 2, Y: 4}, {X: 0, Y: 4}}
+	tests := []struct {
+		x, y float64
+		want bool
+	}{
+		{1, 1, true},
+		{3, 1, true},
+		{1, 3, true},
+		{3, 3, false}, // in the notch
+		{0, 0, true},  // on a vertex
+		{4, 1, true},  // on an edge
+		{-0.1, 1, false},
+		{5, 5, false},
+	}
+	for _, tt := range tests {
+		if got := containsPoint(poly, tt.x, tt.y); got != tt.want {
+			t.Errorf("containsPoint(%v, %v) = %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func Test_validGeometry(t *testing.T) {
+	tests := []struct {
+		name    string
+		sp      Space
+		wantErr bool
+	}{
+		{"no extent", Space{Name: "a"}, false},
+		{"rectangle", Space{Name: "a", Width: 10, Height: 8}, false},
+		{"polygon", Space{Name: "a", Outline: []dataio.Point{{X: -1, Y: 0}, {X: 3, Y: 0}, {X: 1, Y: 3}}}, false},
+		{"width only", Space{Name: "a", Width: 10}, true},
+		{"negative", Space{Name: "a", Width: -1, Height: -1}, true},
+		{"both", Space{Name: "a", Width: 1, Height: 1, Outline: []dataio.Point{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 0, Y: 1}}}, true},
+		{"two vertices", Space{Name: "a", Outline: []dataio.Point{{X: 0, Y: 0}, {X: 1, Y: 0}}}, true},
+		{"flat", Space{Name: "a", Outline: []dataio.Point{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 2, Y: 0}}}, true},
+		{"door outside", Space{Name: "a", Outline: []dataio.Point{{X: 1, Y: 1}, {X: 2, Y: 1}, {X: 1, Y: 2}}}, true},
+		{"negative scale", Space{Name: "a", Scale: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validGeometry(tt.sp); (err != nil) != tt.wantErr {
+				t.Errorf("validGeometry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_placementErrors(t *testing.T) {
+	parents := map[string]Space{
+		"floor": {Name: "floor", Width: 20, Height: 10},
+		"hall":  {Name: "hall"}, // no extent, contains everything
+	}
+	spaceList := []Space{
+		{Name: "room", Base: "floor", Rx: 2, Ry: 2, Width: 4, Height: 4},
+		{Name: "wide", Base: "floor", Rx: 18, Ry: 2, Width: 4, Height: 4}, // corners out
+		{Name: "lobby", Base: "hall", Rx: 100, Ry: 100, Width: 4, Height: 4},
+		{Name: "turned", Base: "floor", Rx: 2, Ry: 2, Width: 4, Height: 4, Rotation: 180}, // turned out of the corner
+		{Name: "small", Base: "floor", Rx: 1, Ry: 1, Width: 300, Height: 300, Scale: 0.01},
+	}
+	assetList := []Asset{
+		{Name: "A", Base: "floor", Rx: 20, Ry: 10},
+		{Name: "B", Base: "floor", Rx: 21, Ry: 5},
+		{Name: "C", Base: "hall", Rx: -50, Ry: 5},
+		{Name: "D", Base: "nowhere", Rx: -50, Ry: 5},
+	}
+	want := []string{"the space wide is out of floor", "the space turned is out of floor", "the asset B@floor is out of floor"}
+	if got := placementErrors(spaceList, assetList, parents); !reflect.DeepEqual(got, want) {
+		t.Errorf("placementErrors() = %v, want %v", got, want)
+	}
+}
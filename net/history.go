@@ -0,0 +1,359 @@
+// Inspection history of Assets, and the history-aware sampling policy built on it
+
+package net
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+MongoDB collection structure:
+readygo(DB): {
+	Inspection(Collection): {
+		name: "",
+		base: "",
+		time: ISODate(),
+		status: "",
+		session: "" // the session id, if marked in one
+	},
+	Campaign(Collection): {
+		space: "", // root space name
+		start: ISODate(),
+		rounds: 0,
+		round: 0
+	}
+}*/
+
+// Inspection records one check of an Asset
+type Inspection struct {
+	Name    string    `json:"name" description:"name of the inspected asset"`
+	Base    string    `json:"base" description:"base space of the inspected asset"`
+	Time    time.Time `json:"time" description:"the time when the asset was inspected"`
+	Status  string    `json:"status,omitempty" description:"the result in a session: found, missing or damaged"`
+	Session string    `json:"session,omitempty" description:"the session the result is marked in, if any"`
+}
+
+// Campaign guarantees every Asset under the space is inspected within the rounds
+type Campaign struct {
+	Space  string    `json:"space" description:"the root space the campaign covers, along with all its subspaces"`
+	Start  time.Time `json:"start" description:"Assets inspected after the start are covered"`
+	Rounds int       `json:"rounds" description:"the number of sessions to cover all the assets in"`
+	Round  int       `json:"round" description:"the number of sessions started so far"`
+}
+
+// boostDaysCap caps the days since the last inspection, so that
+// never-inspected Assets do not outweigh everything else
+const boostDaysCap = 365
+
+// samplePolicy tunes the weight of every Asset before sampling, by the weighting
+// rules and then the inspection history
+type samplePolicy struct {
+	Now         time.Time
+	BoostPerDay float64 // extra weight ratio per day since the last inspection
+	ExcludeDays float64 // Assets inspected within these days are excluded
+	Quota       int     // the least uncovered Assets to sample, in campaign mode
+	Campaign    *Campaign
+	Rules       []WeightRule     // rules computing the weight from attributes, see rule.go
+	Spaces      map[string]Space // the base spaces and their ancestors looked up by the rules
+	Deferred    map[string]bool  // the occupied spaces whose Assets are left out, see booking.go
+	Speed       float64          // the walking speed estimating the ETAs, see eta.go
+	Statuses    map[string]bool  // the lifecycle statuses of the Assets to sample, see status.go
+}
+
+// weigh returns the effective sampling weight of the Asset, 0 for excluded
+func (p samplePolicy) weigh(as Asset) float64 {
+	if len(p.Rules) > 0 {
+		as.Weight, _ = applyRules(p.Rules, as, p.Spaces)
+	}
+	if as.Weight <= 0 {
+		return 0
+	}
+
+	days := boostDaysCap * 1.0
+	if !as.LastChecked.IsZero() {
+		days = math.Min(p.Now.Sub(as.LastChecked).Seconds()/DAY_SECONDS, boostDaysCap)
+		if days < p.ExcludeDays {
+			return 0
+		}
+	}
+
+	return as.Weight * (1 + p.BoostPerDay*days)
+}
+
+// uncovered tells if the Asset has not been inspected since the campaign started
+func (p samplePolicy) uncovered(as Asset) bool {
+	return p.Campaign != nil && as.LastChecked.Before(p.Campaign.Start)
+}
+
+// campaignQuota spreads the uncovered Assets evenly over the rounds left
+func campaignQuota(uncovered int, c Campaign) int {
+	roundsLeft := c.Rounds - c.Round
+	if roundsLeft < 1 {
+		roundsLeft = 1
+	}
+	return (uncovered + roundsLeft - 1) / roundsLeft // ceil
+}
+
+// countUncovered counts the uncovered Assets in the stream that can be sampled: in the
+// lifecycle statuses to sample, and weighing more than 0 after the rules and the exclusion
+func countUncovered(ctx context.Context, stream assetStream, policy samplePolicy) (n int, err error) {
+	statuses := policy.sampleStatuses()
+	for stream.Next(ctx) {
+		var as Asset
+		if err = stream.Decode(&as); err != nil {
+			return 0, err
+		}
+		if statuses[assetStatus(as)] && policy.uncovered(as) && policy.weigh(as) > 0 {
+			n++
+		}
+	}
+	return n, stream.Err()
+}
+
+// uncoveredFilter matches the Assets not inspected since the start time,
+// including the ones never inspected
+func uncoveredFilter(start time.Time) bson.M {
+	return bson.M{"$or": []bson.M{
+		bson.M{"lastchecked": bson.M{"$lt": start}},
+		bson.M{"lastchecked": bson.M{"$exists": false}}}}
+}
+
+// dbInsertInspection records the inspection in history, and updates the Asset's
+// last inspection time and its cache; the result marked again in the same Session
+// replaces the one recorded there, so that it counts once
+func (r RestContext) dbInsertInspection(record Inspection) (errCode int, err error) {
+	toSet := bson.D{{"$set", bson.D{{"lastchecked", record.Time}}}}
+	if _, errCode, err = r.dbUpdateAsset(record.Name, record.Base, toSet); err != nil {
+		return errCode, err
+	}
+
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+	col := r.mongoDB.Collection("inspection")
+	if record.Session == "" {
+		_, err = col.InsertOne(ctx, record)
+	} else {
+		_, err = col.ReplaceOne(ctx, bson.M{"name": record.Name, "base": record.Base, "session": record.Session},
+			record, options.Replace().SetUpsert(true))
+	}
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusCreated, nil
+}
+
+// dbDeleteSessionInspection takes back the result recorded for the Asset in the Session, like
+// when the Stop is marked skipped after all
+func (r RestContext) dbDeleteSessionInspection(name string, base string, session string) (errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+
+	if _, err = r.mongoDB.Collection("inspection").DeleteOne(ctx,
+		bson.M{"name": name, "base": base, "session": session}); err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// dbGetInspections finds the inspection history of the Asset, latest first
+func (r RestContext) dbGetInspections(name string, base string) (list []Inspection, errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+
+	cur, err := r.mongoDB.Collection("inspection").Find(ctx, bson.M{"name": name, "base": base},
+		options.Find().SetSort(bson.D{{"time", -1}}))
+	if err != nil {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, err
+	}
+	defer cur.Close(ctx)
+
+	list = []Inspection{}
+	for cur.Next(ctx) {
+		var record Inspection
+		if err = cur.Decode(&record); err != nil {
+			log.Println(err)
+			return nil, http.StatusInternalServerError, err
+		}
+		list = append(list, record)
+	}
+	return list, http.StatusOK, nil
+}
+
+// dbUpsertCampaign starts a new campaign on the space, replacing the old one
+func (r RestContext) dbUpsertCampaign(c Campaign) (errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+
+	if _, err = r.mongoDB.Collection("campaign").ReplaceOne(ctx, bson.M{"space": c.Space}, c,
+		options.Replace().SetUpsert(true)); err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusCreated, nil
+}
+
+// dbGetCampaign finds the campaign running on the space
+func (r RestContext) dbGetCampaign(space string) (result *Campaign, errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+
+	result = new(Campaign)
+	if err = r.mongoDB.Collection("campaign").FindOne(ctx, bson.M{"space": space}).Decode(result); err != nil {
+		return nil, http.StatusNotFound, err
+	}
+	return result, http.StatusOK, nil
+}
+
+// dbFindCampaign finds the campaign covering the space: the one running on the space itself,
+// or else on its nearest ancestor
+func (r RestContext) dbFindCampaign(space string) (result *Campaign, errCode int, err error) {
+	ancestors, errCode, err := r.dbGetAncestors(space)
+	if err != nil {
+		return nil, errCode, err
+	}
+	names := make([]string, 0, len(ancestors))
+	for _, sp := range ancestors {
+		names = append(names, sp.Name)
+	}
+
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+	cur, err := r.mongoDB.Collection("campaign").Find(ctx, bson.M{"space": bson.M{"$in": names}})
+	if err != nil {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, err
+	}
+	defer cur.Close(ctx)
+	found := make(map[string]Campaign)
+	for cur.Next(ctx) {
+		var c Campaign
+		if err = cur.Decode(&c); err != nil {
+			log.Println(err)
+			return nil, http.StatusInternalServerError, err
+		}
+		found[c.Space] = c
+	}
+
+	for _, name := range names { // from the space up
+		if c, ok := found[name]; ok {
+			return &c, http.StatusOK, nil
+		}
+	}
+	return nil, http.StatusNotFound, errors.New("no campaign covers the space " + space)
+}
+
+// dbNextCampaignRound counts a session started in the campaign
+func (r RestContext) dbNextCampaignRound(space string) (errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+
+	if _, err = r.mongoDB.Collection("campaign").UpdateOne(ctx, bson.M{"space": space},
+		bson.D{{"$inc", bson.D{{"round", 1}}}}); err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// dbDeleteCampaign stops the campaign running on the space
+func (r RestContext) dbDeleteCampaign(space string) (errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+
+	deleteResult, err := r.mongoDB.Collection("campaign").DeleteOne(ctx, bson.M{"space": space})
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, err
+	}
+	if deleteResult.DeletedCount == 0 {
+		return http.StatusNotFound, errors.New("no campaign is running on the space")
+	}
+	return http.StatusOK, nil
+}
+
+// POST PREFIX/spaces/{space-name}/assets/{asset-name}/inspections?time=RFC3339
+func (r RestContext) createInspection(req *restful.Request, resp *restful.Response) {
+	record := Inspection{
+		Name: req.PathParameter("asset-name"),
+		Base: req.PathParameter("space-name"),
+		Time: time.Now()}
+
+	if t := req.QueryParameter("time"); t != "" {
+		var err error
+		if record.Time, err = time.Parse(time.RFC3339, t); err != nil {
+			resp.WriteError(http.StatusNotAcceptable, err)
+			return
+		}
+	}
+
+	if errCode, err := r.dbInsertInspection(record); err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusCreated, record)
+}
+
+// GET PREFIX/spaces/{space-name}/assets/{asset-name}/inspections
+func (r RestContext) findInspections(req *restful.Request, resp *restful.Response) {
+	list, errCode, err := r.dbGetInspections(req.PathParameter("asset-name"), req.PathParameter("space-name"))
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, list)
+}
+
+// PUT PREFIX/campaigns/{space-name}?rounds=K
+func (r RestContext) createCampaign(req *restful.Request, resp *restful.Response) {
+	spaceName := req.PathParameter("space-name")
+
+	rounds, err := strconv.Atoi(req.QueryParameter("rounds"))
+	if err != nil || rounds < 1 {
+		resp.WriteError(http.StatusNotAcceptable, errors.New("rounds should be a positive integer"))
+		return
+	}
+	if _, errCode, err := r.dbGetSpace(spaceName, false); err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+
+	c := Campaign{Space: spaceName, Start: time.Now(), Rounds: rounds, Round: 0}
+	if errCode, err := r.dbUpsertCampaign(c); err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusCreated, c)
+}
+
+// GET PREFIX/campaigns/{space-name}
+func (r RestContext) findCampaign(req *restful.Request, resp *restful.Response) {
+	resultPtr, errCode, err := r.dbGetCampaign(req.PathParameter("space-name"))
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, *resultPtr)
+}
+
+// DELETE PREFIX/campaigns/{space-name}
+func (r RestContext) deleteCampaign(req *restful.Request, resp *restful.Response) {
+	if errCode, err := r.dbDeleteCampaign(req.PathParameter("space-name")); err != nil {
+		resp.WriteError(errCode, err)
+	} else {
+		resp.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,149 @@
+package net
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_samplePolicy_weigh(t *testing.T) {
+	now := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		policy samplePolicy
+		asset  Asset
+		want   float64
+	}{{
+		name:   "no history policy",
+		policy: samplePolicy{Now: now},
+		asset:  Asset{Name: "A", Base: "base", Weight: 2, LastChecked: now.AddDate(0, 0, -10)},
+		want:   2,
+	}, {
+		name:   "boost by days",
+		policy: samplePolicy{Now: now, BoostPerDay: 0.1},
+		asset:  Asset{Name: "A", Base: "base", Weight: 2, LastChecked: now.AddDate(0, 0, -10)},
+		want:   4,
+	}, {
+		name:   "never inspected is capped",
+		policy: samplePolicy{Now: now, BoostPerDay: 0.1},
+		asset:  Asset{Name: "A", Base: "base", Weight: 1},
+		want:   1 + 0.1*boostDaysCap,
+	}, {
+		name:   "recently inspected excluded",
+		policy: samplePolicy{Now: now, ExcludeDays: 7},
+		asset:  Asset{Name: "A", Base: "base", Weight: 1, LastChecked: now.AddDate(0, 0, -3)},
+		want:   0,
+	}, {
+		name:   "never inspected not excluded",
+		policy: samplePolicy{Now: now, ExcludeDays: 7},
+		asset:  Asset{Name: "A", Base: "base", Weight: 1},
+		want:   1,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.weigh(tt.asset); got-tt.want > 1e-9 || tt.want-got > 1e-9 {
+				t.Errorf("samplePolicy.weigh() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_campaignQuota(t *testing.T) {
+	tests := []struct {
+		name      string
+		uncovered int
+		c         Campaign
+		want      int
+	}{
+		{"first round", 10, Campaign{Rounds: 4, Round: 0}, 3},
+		{"last round", 5, Campaign{Rounds: 4, Round: 3}, 5},
+		{"overdue", 5, Campaign{Rounds: 4, Round: 6}, 5},
+		{"all covered", 0, Campaign{Rounds: 4, Round: 1}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := campaignQuota(tt.uncovered, tt.c); got != tt.want {
+				t.Errorf("campaignQuota() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_sampleStream_campaign(t *testing.T) {
+	now := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	c := Campaign{Space: "base", Start: now.AddDate(0, 0, -7), Rounds: 3}
+
+	wholeList := []Asset{}
+	for i := 0; i < 10; i++ {
+		as := Asset{Name: strconv.Itoa(i), Base: "base", Weight: 1}
+		if i%2 == 0 { // half of them covered
+			as.LastChecked = now.AddDate(0, 0, -1)
+		}
+		wholeList = append(wholeList, as)
+	}
+
+	tests := []struct {
+		name    string
+		k       int
+		quota   int
+		wantLen int
+	}{
+		{"quota within sample size", 4, 2, 4},
+		{"quota beyond sample size", 1, 3, 3},
+		{"no quota", 3, 0, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := samplePolicy{Now: now, Campaign: &c, Quota: tt.quota}
+			for round := 0; round < 100; round++ {
+				sampledList, err := sampleStream(context.Background(), &sliceStream{list: wholeList}, tt.k, policy)
+				if err != nil {
+					t.Fatalf("sampleStream() error = %v", err)
+				}
+				if len(sampledList) != tt.wantLen {
+					t.Fatalf("sampleStream() sampled %v Assets, want %v", len(sampledList), tt.wantLen)
+				}
+				uncovered := 0
+				for _, as := range sampledList {
+					if policy.uncovered(as) {
+						uncovered++
+					}
+				}
+				if uncovered < tt.quota {
+					t.Fatalf("sampleStream() sampled %v uncovered Assets, want at least %v", uncovered, tt.quota)
+				}
+			}
+		})
+	}
+}
+
+func Test_countUncovered(t *testing.T) {
+	now := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	c := Campaign{Space: "base", Start: now.AddDate(0, 0, -30), Rounds: 3}
+	wholeList := []Asset{
+		{Name: "never", Base: "base", Weight: 1},
+		{Name: "long ago", Base: "base", Weight: 1, LastChecked: now.AddDate(0, 0, -60)},
+		{Name: "covered", Base: "base", Weight: 1, LastChecked: now.AddDate(0, 0, -10)},
+		{Name: "weightless", Base: "base", Weight: 0},
+		{Name: "retired", Base: "base", Weight: 1, Status: STATUS_RETIRED},
+	}
+
+	tests := []struct {
+		name   string
+		policy samplePolicy
+		want   int
+	}{
+		{"uncovered and sampleable", samplePolicy{Now: now, Campaign: &c}, 2},
+		{"excluded ones left out", samplePolicy{Now: now, Campaign: &c, ExcludeDays: 90}, 1},
+		{"no campaign", samplePolicy{Now: now}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := countUncovered(context.Background(), &sliceStream{list: wholeList}, tt.policy)
+			if err != nil || got != tt.want {
+				t.Errorf("countUncovered() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+// Importing the checkpoint csv file atomically: every row is applied, or none is
+
+package net
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dataio "github.com/miosolo/readygo/io"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ImportError is a row of the csv file aborting the import, and why
+type ImportError struct {
+	Row     int    `json:"row" description:"the line number in the file, the header is line 1"`
+	Key     string `json:"key,omitempty" description:"name@base of the asset, or space-name of the space"`
+	Message string `json:"message" description:"what is wrong with it"`
+
+	conflict bool // with another row or what is in MongoDB
+}
+
+// ImportResult is the response to an import: how many are inserted, or every row aborting it
+type ImportResult struct {
+	SpacesInserted int           `json:"spacesInserted"`
+	AssetsInserted int           `json:"assetsInserted"`
+	Errors         []ImportError `json:"errors,omitempty" description:"the rows aborting the import, sorted by row; nothing is inserted then"`
+}
+
+// importStatus is 409 if any of the errors is a conflict, otherwise 406
+func importStatus(errs []ImportError) int {
+	for _, e := range errs {
+		if e.conflict {
+			return http.StatusConflict
+		}
+	}
+	return http.StatusNotAcceptable
+}
+
+func sortImportErrors(errs []ImportError) {
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].Row != errs[j].Row {
+			return errs[i].Row < errs[j].Row
+		}
+		return errs[i].Message < errs[j].Message
+	})
+}
+
+// importRows converts the csv records to Spaces and Assets, and remembers the row of each
+// by the key of its Redis cache; the rows repeating a key or with invalid metadata are errors
+func importRows(records []dataio.Record) (spaceList []Space, assetList []Asset, rows map[string]int, errs []ImportError) {
+	spaceList, assetList, errs = []Space{}, []Asset{}, []ImportError{}
+	rows = make(map[string]int, len(records))
+
+	for _, rec := range records {
+		key := rec.Name + "@" + rec.Base
+		if rec.IsPortal {
+			key = "space-" + rec.Name
+		}
+		if rec.Name == "" {
+			errs = append(errs, ImportError{Row: rec.Line, Key: key, Message: "the name is empty"})
+			continue
+		}
+		if row, ok := rows[key]; ok {
+			errs = append(errs, ImportError{Row: rec.Line, Key: key,
+				Message: "already in row " + strconv.Itoa(row), conflict: true})
+			continue
+		}
+
+		if rec.IsPortal {
+			spaceList = append(spaceList, Space{Name: rec.Name, Base: rec.Base, Rx: rec.Rx, Ry: rec.Ry, Attrs: rec.Attrs})
+		} else {
+			as := Asset{Name: rec.Name, Base: rec.Base, Rx: rec.Rx, Ry: rec.Ry, Weight: rec.Weight}
+			if err := setMetadata(&as, rec.Attrs); err != nil {
+				errs = append(errs, ImportError{Row: rec.Line, Key: key, Message: err.Error()})
+				continue
+			}
+			assetList = append(assetList, as)
+		}
+		rows[key] = rec.Line
+	}
+	return spaceList, assetList, rows, errs
+}
+
+// importErrors checks the Spaces and Assets to import against the ones in MongoDB: dbSpaces are
+// the existing Spaces named by the file, as themselves or as bases, and dbAssets the existing
+// Assets by name@base. The rows already in MongoDB, with a base in neither, in a cycle of bases,
+// or out of the base's outline are errors
+func importErrors(spaceList []Space, assetList []Asset, rows map[string]int,
+	dbSpaces map[string]Space, dbAssets map[string]bool) []ImportError {
+	errs := []ImportError{}
+	fileSpaces := make(map[string]Space, len(spaceList))
+	for _, sp := range spaceList {
+		fileSpaces[sp.Name] = sp
+	}
+	parents := make(map[string]Space, len(dbSpaces)+len(spaceList))
+	for name, sp := range dbSpaces {
+		parents[name] = sp
+	}
+	for _, sp := range spaceList {
+		parents[sp.Name] = sp
+	}
+	add := func(key string, message string, conflict bool) {
+		errs = append(errs, ImportError{Row: rows[key], Key: key, Message: message, conflict: conflict})
+	}
+
+	for _, sp := range spaceList {
+		key := "space-" + sp.Name
+		if _, ok := dbSpaces[sp.Name]; ok {
+			add(key, "the space already exists", true)
+			continue
+		}
+		if _, ok := parents[sp.Base]; !ok && sp.Base != "" {
+			add(key, "the base space "+sp.Base+" does not exist", false)
+			continue
+		}
+		// follow the bases in the file, at most once around them all
+		base := sp.Base
+		for i := 0; i < len(spaceList) && base != sp.Name; i++ {
+			base = fileSpaces[base].Base
+		}
+		if base == sp.Name {
+			add(key, "the space is in a cycle of bases", false)
+			continue
+		}
+		if placement := placementErrors([]Space{sp}, nil, parents); len(placement) > 0 {
+			add(key, strings.Join(placement, "; "), false)
+		}
+	}
+	for _, as := range assetList {
+		key := as.Name + "@" + as.Base
+		if dbAssets[key] {
+			add(key, "the asset already exists", true)
+			continue
+		}
+		if _, ok := parents[as.Base]; !ok {
+			add(key, "the base space "+as.Base+" does not exist", false)
+			continue
+		}
+		if placement := placementErrors(nil, []Asset{as}, parents); len(placement) > 0 {
+			add(key, strings.Join(placement, "; "), false)
+		}
+	}
+	return errs
+}
+
+// dbImportExisting finds the existing Spaces named by the import as themselves or as bases,
+// and which of the Assets to import exist, by name@base
+func (r RestContext) dbImportExisting(spaceList []Space, assetList []Asset) (dbSpaces map[string]Space,
+	dbAssets map[string]bool, errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cf()
+
+	names := []string{}
+	for _, sp := range spaceList {
+		names = append(names, sp.Name, sp.Base)
+	}
+	for _, as := range assetList {
+		names = append(names, as.Base)
+	}
+	spaceCur, err := r.mongoDB.Collection("space").Find(ctx, bson.M{"name": bson.M{"$in": names}})
+	if err != nil {
+		log.Println(err)
+		return nil, nil, http.StatusInternalServerError, err
+	}
+	defer spaceCur.Close(ctx)
+	dbSpaces = make(map[string]Space)
+	for spaceCur.Next(ctx) {
+		var sp Space
+		if err = spaceCur.Decode(&sp); err != nil {
+			log.Println(err)
+			return nil, nil, http.StatusInternalServerError, err
+		}
+		dbSpaces[sp.Name] = sp
+	}
+
+	dbAssets = make(map[string]bool)
+	if len(assetList) == 0 {
+		return dbSpaces, dbAssets, http.StatusOK, nil
+	}
+	keys := make([]bson.M, 0, len(assetList))
+	for _, as := range assetList {
+		keys = append(keys, bson.M{"name": as.Name, "base": as.Base})
+	}
+	assetCur, err := r.mongoDB.Collection("asset").Find(ctx, bson.M{"$or": keys})
+	if err != nil {
+		log.Println(err)
+		return nil, nil, http.StatusInternalServerError, err
+	}
+	defer assetCur.Close(ctx)
+	for assetCur.Next(ctx) {
+		var as Asset
+		if err = assetCur.Decode(&as); err != nil {
+			log.Println(err)
+			return nil, nil, http.StatusInternalServerError, err
+		}
+		dbAssets[as.Name+"@"+as.Base] = true
+	}
+	return dbSpaces, dbAssets, http.StatusOK, nil
+}
+
+// insertedCount is how many of the items an ordered InsertMany has written before failing with
+// err: the ones before the first write error, or all of them if unknown
+func insertedCount(err error, n int) int {
+	if wrEx, ok := err.(mongo.BulkWriteException); ok && len(wrEx.WriteErrors) > 0 {
+		return wrEx.WriteErrors[0].Index
+	}
+	return n
+}
+
+// dbImport inserts the Spaces and Assets in one transaction, then caches them; a write error,
+// like a duplicate inserted by someone else meanwhile, aborts it with the rows. Without the
+// transactions of a replica set, they are inserted in stages and the written ones deleted on failure
+func (r RestContext) dbImport(spaceList []Space, assetList []Asset, rows map[string]int) (errs []ImportError,
+	errCode int, err error) {
+	spaceItems, spaceKeys, spaceFilters := make([]interface{}, 0, len(spaceList)),
+		make([]string, 0, len(spaceList)), make([]bson.M, 0, len(spaceList))
+	for _, sp := range spaceList {
+		spaceItems, spaceKeys = append(spaceItems, sp), append(spaceKeys, "space-"+sp.Name)
+		spaceFilters = append(spaceFilters, bson.M{"name": sp.Name})
+	}
+	assetItems, assetKeys, assetFilters := make([]interface{}, 0, len(assetList)),
+		make([]string, 0, len(assetList)), make([]bson.M, 0, len(assetList))
+	for _, as := range assetList {
+		assetItems, assetKeys = append(assetItems, as), append(assetKeys, as.Name+"@"+as.Base)
+		assetFilters = append(assetFilters, bson.M{"name": as.Name, "base": as.Base})
+	}
+
+	insert := func(ctx context.Context, collection string, items []interface{}, keys []string) (int, error) {
+		if len(items) == 0 {
+			return http.StatusOK, nil
+		}
+		_, err := r.mongoDB.Collection(collection).InsertMany(ctx, items)
+		if err == nil {
+			return http.StatusOK, nil
+		}
+		wrEx, ok := err.(mongo.BulkWriteException)
+		if !ok || len(wrEx.WriteErrors) == 0 {
+			return http.StatusInternalServerError, err
+		}
+		for _, wrErr := range wrEx.WriteErrors {
+			if wrErr.Index < len(keys) {
+				key := keys[wrErr.Index]
+				errs = append(errs, ImportError{Row: rows[key], Key: key, Message: wrErr.Message,
+					conflict: wrErr.Code == 11000}) //duplicate key
+			}
+		}
+		return importStatus(errs), wrEx
+	}
+
+	if r.transactions {
+		errCode, err = r.dbTransaction(30*time.Second, func(ctx mongo.SessionContext) (int, error) {
+			if errCode, err := insert(ctx, "space", spaceItems, spaceKeys); err != nil {
+				return errCode, err
+			}
+			return insert(ctx, "asset", assetItems, assetKeys)
+		})
+	} else {
+		ctx, cf := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cf()
+		rollback := func(collection string, filters []bson.M) {
+			if len(filters) == 0 {
+				return
+			}
+			ctx, cf := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cf()
+			if _, err := r.mongoDB.Collection(collection).DeleteMany(ctx, bson.M{"$or": filters}); err != nil {
+				log.Println("cannot roll back the import in " + collection + ": " + err.Error())
+			}
+		}
+
+		if errCode, err = insert(ctx, "space", spaceItems, spaceKeys); err != nil {
+			rollback("space", spaceFilters[:insertedCount(err, len(spaceFilters))])
+		} else if errCode, err = insert(ctx, "asset", assetItems, assetKeys); err != nil {
+			rollback("asset", assetFilters[:insertedCount(err, len(assetFilters))])
+			rollback("space", spaceFilters)
+		}
+	}
+	if err != nil {
+		sortImportErrors(errs)
+		return errs, errCode, err
+	}
+
+	// cache only what is committed, before responding
+	redisConn := r.redisConnPool.Get()
+	defer redisConn.Close()
+	set := func(k string, v interface{}, expire int) {
+		b, _ := json.Marshal(v)
+		redisConn.Do("SET", k, b)
+		redisConn.Do("EXPIRE", k, expire)
+	}
+	for _, sp := range spaceList {
+		set("space-"+sp.Name, sp, WEEK_SECONDS)
+	}
+	for _, as := range assetList {
+		set(as.Name+"@"+as.Base, as, MONTH_SECONDS)
+	}
+	return nil, http.StatusCreated, nil
+}
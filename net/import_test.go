@@ -0,0 +1,118 @@
+package net
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	dataio "github.com/miosolo/readygo/io"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func Test_importRows(t *testing.T) {
+	records := []dataio.Record{
+		{Checkpoint: dataio.Checkpoint{Name: "floor", Base: "", IsPortal: true}, Line: 2},
+		{Checkpoint: dataio.Checkpoint{Name: "A", Base: "floor", Rx: 1, Weight: 1},
+			Attrs: map[string]string{"category": "laptop"}, Line: 3},
+		{Checkpoint: dataio.Checkpoint{Name: "A", Base: "floor", Rx: 2, Weight: 1}, Line: 5},
+		{Checkpoint: dataio.Checkpoint{Name: "floor", Base: "building", IsPortal: true}, Line: 6},
+		{Checkpoint: dataio.Checkpoint{Name: "B", Base: "floor", Weight: 1},
+			Attrs: map[string]string{"purchaseValue": "cheap"}, Line: 7},
+		{Checkpoint: dataio.Checkpoint{Name: "", Base: "floor", Weight: 1}, Line: 8},
+	}
+
+	spaceList, assetList, rows, errs := importRows(records)
+	if want := []Space{{Name: "floor"}}; !reflect.DeepEqual(spaceList, want) {
+		t.Errorf("importRows() spaceList = %v, want %v", spaceList, want)
+	}
+	if want := []Asset{{Name: "A", Base: "floor", Rx: 1, Weight: 1, Category: "laptop"}}; !reflect.DeepEqual(assetList, want) {
+		t.Errorf("importRows() assetList = %v, want %v", assetList, want)
+	}
+	if want := map[string]int{"space-floor": 2, "A@floor": 3}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("importRows() rows = %v, want %v", rows, want)
+	}
+	gotRows := []int{}
+	for _, e := range errs {
+		gotRows = append(gotRows, e.Row)
+	}
+	if want := []int{5, 6, 7, 8}; !reflect.DeepEqual(gotRows, want) {
+		t.Errorf("importRows() errors = %v, want the rows %v", errs, want)
+	}
+	if importStatus(errs) != 409 || importStatus(errs[2:]) != 406 {
+		t.Errorf("importStatus() = %v, %v, want 409 for the repeated rows only",
+			importStatus(errs), importStatus(errs[2:]))
+	}
+}
+
+func Test_importErrors(t *testing.T) {
+	dbSpaces := map[string]Space{
+		"building": {Name: "building", Width: 10, Height: 10},
+		"lobby":    {Name: "lobby", Base: "building"},
+	}
+	dbAssets := map[string]bool{"old@lobby": true}
+	spaceList := []Space{
+		{Name: "floor", Base: "building", Rx: 1, Ry: 1},
+		{Name: "lobby", Base: "building"},
+		{Name: "annex", Base: "demolished"},
+		{Name: "a", Base: "b"},
+		{Name: "b", Base: "a"},
+		{Name: "roof", Base: "building", Rx: 20},
+		{Name: "top", Base: "base"},
+	}
+	assetList := []Asset{
+		{Name: "A", Base: "floor", Weight: 1},
+		{Name: "old", Base: "lobby", Weight: 1},
+		{Name: "B", Base: "gone", Weight: 1},
+		{Name: "C", Base: "building", Rx: -1, Weight: 1},
+		{Name: "D", Base: "lobby", Weight: 1},
+	}
+	rows := map[string]int{}
+	for i, sp := range spaceList {
+		rows["space-"+sp.Name] = i + 2
+	}
+	for i, as := range assetList {
+		rows[as.Name+"@"+as.Base] = len(spaceList) + i + 2
+	}
+
+	errs := importErrors(spaceList, assetList, rows, dbSpaces, dbAssets)
+	sortImportErrors(errs)
+	got := [][2]interface{}{}
+	for _, e := range errs {
+		got = append(got, [2]interface{}{e.Row, e.Key})
+	}
+	want := [][2]interface{}{
+		{3, "space-lobby"},
+		{4, "space-annex"},
+		{5, "space-a"},
+		{6, "space-b"},
+		{7, "space-roof"},
+		{8, "space-top"},
+		{10, "old@lobby"},
+		{11, "B@gone"},
+		{12, "C@building"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("importErrors() = %v, want %v", errs, want)
+	}
+}
+
+func Test_insertedCount(t *testing.T) {
+	duplicate := mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{
+		{WriteError: mongo.WriteError{Index: 2, Code: 11000}}, {WriteError: mongo.WriteError{Index: 4, Code: 11000}}}}
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"before the first write error", duplicate, 2},
+		{"unknown", errors.New("connection reset"), 5},
+		{"no write error", mongo.BulkWriteException{}, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := insertedCount(tt.err, 5); got != tt.want {
+				t.Errorf("insertedCount() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+// Printable QR code labels of the Assets, with a token verifying them on scanning
+
+package net
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/emicklei/go-restful"
+	"github.com/miosolo/readygo/label"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// LABEL_TOKEN_LENGTH is the characters of the verification token on a label
+const LABEL_TOKEN_LENGTH = 8
+
+var errNoLabelSecret = errors.New("no label secret is configured to sign or verify the labels")
+
+// LoadLabelSecret keeps the secret configured, or reads the one generated in the file,
+// generating and saving it for the first time, so that the labels printed stay valid
+func (r *RestContext) LoadLabelSecret(file string) (err error) {
+	if r.LabelSecret != "" {
+		return nil
+	}
+	if file == "" {
+		file = strings.Join([]string{os.Getenv("GOPATH"), "src", "github.com",
+			"miosolo", "readygo", "archive", "label-secret"}, string(os.PathSeparator))
+	}
+	if b, err := ioutil.ReadFile(file); err == nil {
+		if r.LabelSecret = strings.TrimSpace(string(b)); r.LabelSecret == "" {
+			return errors.New("the label secret file " + file + " is empty")
+		}
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	secret := hex.EncodeToString(b)
+	if err = ioutil.WriteFile(file, []byte(secret+"\n"), 0600); err != nil {
+		return err
+	}
+	r.LabelSecret = secret
+	return nil
+}
+
+// labelToken signs name@base of the Asset with the secret, so that a label can't be forged
+// without it; base32 keeps it easy to read out if the code can't be scanned
+func labelToken(secret string, name string, base string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(name + "@" + base))
+	return base32.StdEncoding.EncodeToString(mac.Sum(nil))[:LABEL_TOKEN_LENGTH]
+}
+
+// labelCode is encoded in the Asset's label: name@base#token
+func (r RestContext) labelCode(name string, base string) string {
+	return name + "@" + base + "#" + labelToken(r.LabelSecret, name, base)
+}
+
+// verifyLabel tells whether the token scanned on the label is the Asset's; nothing is
+// genuine without a secret
+func (r RestContext) verifyLabel(key AssetKey, token string) bool {
+	return r.LabelSecret != "" && token != "" &&
+		hmac.Equal([]byte(token), []byte(labelToken(r.LabelSecret, key.Name, key.Base)))
+}
+
+// assetLabel is what is printed on the Asset
+func (r RestContext) assetLabel(as Asset) label.Label {
+	return label.Label{
+		Code:     r.labelCode(as.Name, as.Base),
+		Title:    as.Name,
+		Subtitle: "@ " + as.Base,
+		Footnote: labelToken(r.LabelSecret, as.Name, as.Base)}
+}
+
+// writeReprintLabels lists in the X-Reprint-Labels header the Assets moved to another base, whose
+// printed labels no longer scan as themselves
+func writeReprintLabels(resp *restful.Response, keys []AssetKey) {
+	if len(keys) > 0 {
+		resp.AddHeader("X-Reprint-Labels", joinStops(keys))
+	}
+}
+
+// labelPage slices the page of the labels, counting from 1; the total pages are at least 1
+func labelPage(list []label.Label, page int) (result []label.Label, total int, err error) {
+	total = (len(list) + label.LABELS_PER_SHEET - 1) / label.LABELS_PER_SHEET
+	if total == 0 {
+		total = 1
+	}
+	if page < 1 || page > total {
+		return nil, total, errors.New("the page should be within 1 to " + strconv.Itoa(total))
+	}
+	start := (page - 1) * label.LABELS_PER_SHEET
+	end := start + label.LABELS_PER_SHEET
+	if end > len(list) {
+		end = len(list)
+	}
+	return list[start:end], total, nil
+}
+
+// GET PREFIX/spaces/{space-name}/assets/{asset-name}/label
+func (r RestContext) findAssetLabel(req *restful.Request, resp *restful.Response) {
+	if r.LabelSecret == "" {
+		resp.WriteError(http.StatusServiceUnavailable, errNoLabelSecret)
+		return
+	}
+	as, errCode, err := r.dbGetAsset(req.PathParameter("asset-name"), req.PathParameter("space-name"), true)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+
+	pic, errCode, err := label.DrawLabel(r.assetLabel(*as))
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	http.ServeFile(resp.ResponseWriter, req.Request, pic)
+}
+
+// GET PREFIX/spaces/{space-name}/labels?subtree=false&page=1
+func (r RestContext) findSpaceLabels(req *restful.Request, resp *restful.Response) {
+	if r.LabelSecret == "" {
+		resp.WriteError(http.StatusServiceUnavailable, errNoLabelSecret)
+		return
+	}
+	spaceName := req.PathParameter("space-name")
+	page := 1
+	if qs := req.QueryParameter("page"); qs != "" {
+		var err error
+		if page, err = strconv.Atoi(qs); err != nil {
+			resp.WriteError(http.StatusNotAcceptable, errors.New("the page should be an integer"))
+			return
+		}
+	}
+
+	baseNames := []string{spaceName}
+	if req.QueryParameter("subtree") == "true" {
+		spaceList, errCode, err := r.dbGetSubtreeSpaces(spaceName, true)
+		if err != nil {
+			resp.WriteError(errCode, err)
+			return
+		}
+		baseNames = baseNames[:0]
+		for _, sp := range spaceList {
+			baseNames = append(baseNames, sp.Name)
+		}
+	} else if _, errCode, err := r.dbGetSpace(spaceName, true); err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+
+	assetList, errCode, err := r.dbFindAssets(bson.M{"base": bson.M{"$in": baseNames}})
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	labels := make([]label.Label, 0, len(assetList))
+	for _, as := range assetList {
+		labels = append(labels, r.assetLabel(as))
+	}
+	labels, total, err := labelPage(labels, page)
+	if err != nil {
+		resp.WriteError(http.StatusNotAcceptable, err)
+		return
+	}
+
+	pic, errCode, err := label.DrawSheet(labels)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.AddHeader("X-Total-Pages", strconv.Itoa(total))
+	http.ServeFile(resp.ResponseWriter, req.Request, pic)
+}
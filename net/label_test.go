@@ -0,0 +1,108 @@
+package net
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/miosolo/readygo/label"
+)
+
+func Test_labelToken(t *testing.T) {
+	token := labelToken("secret", "A", "base")
+	if len(token) != LABEL_TOKEN_LENGTH || strings.Trim(token, "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567") != "" {
+		t.Errorf("labelToken() = %v, want %v base32 characters", token, LABEL_TOKEN_LENGTH)
+	}
+	if labelToken("secret", "A", "base") != token {
+		t.Errorf("labelToken() is not stable")
+	}
+	if labelToken("other", "A", "base") == token || labelToken("secret", "A", "Lab") == token {
+		t.Errorf("labelToken() = %v for another secret or asset", token)
+	}
+}
+
+func TestRestContext_verifyLabel(t *testing.T) {
+	r := RestContext{LabelSecret: "secret"}
+	key, token, err := parseScanCode(r.labelCode("A", "base"))
+	if err != nil || key != (AssetKey{Name: "A", Base: "base"}) {
+		t.Fatalf("parseScanCode(labelCode()) = %v, %v", key, err)
+	}
+	if !r.verifyLabel(key, token) {
+		t.Errorf("verifyLabel() = false for the genuine label")
+	}
+	if r.verifyLabel(AssetKey{Name: "B", Base: "base"}, token) || r.verifyLabel(key, "AAAAAAAA") {
+		t.Errorf("verifyLabel() = true for a forged label")
+	}
+	if (RestContext{LabelSecret: "other"}).verifyLabel(key, token) {
+		t.Errorf("verifyLabel() = true with another secret")
+	}
+	if r.verifyLabel(key, "") || (RestContext{}).verifyLabel(key, labelToken("", "A", "base")) {
+		t.Errorf("verifyLabel() = true without a token or a secret")
+	}
+}
+
+func TestRestContext_LoadLabelSecret(t *testing.T) {
+	dir, err := ioutil.TempDir("", "label-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "archive", "label-secret")
+
+	var r RestContext
+	if err := r.LoadLabelSecret(file); err != nil || len(r.LabelSecret) != 64 {
+		t.Fatalf("LoadLabelSecret() = %v, secret %q, want one generated", err, r.LabelSecret)
+	}
+	if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("LoadLabelSecret() saved %v, %v, want a file only the owner reads", info, err)
+	}
+	var again RestContext
+	if err := again.LoadLabelSecret(file); err != nil || again.LabelSecret != r.LabelSecret {
+		t.Errorf("LoadLabelSecret() = %v, %q, want the saved %q", err, again.LabelSecret, r.LabelSecret)
+	}
+	configured := RestContext{LabelSecret: "configured"}
+	if err := configured.LoadLabelSecret(file); err != nil || configured.LabelSecret != "configured" {
+		t.Errorf("LoadLabelSecret() = %v, %q, want the configured one kept", err, configured.LabelSecret)
+	}
+}
+
+func Test_labelPage(t *testing.T) {
+	list := make([]label.Label, label.LABELS_PER_SHEET+1)
+	tests := []struct {
+		list      []label.Label
+		page      int
+		wantLen   int
+		wantTotal int
+		wantErr   bool
+	}{
+		{list, 1, label.LABELS_PER_SHEET, 2, false},
+		{list, 2, 1, 2, false},
+		{list, 3, 0, 2, true},
+		{list, 0, 0, 2, true},
+		{nil, 1, 0, 1, false},
+	}
+	for _, tt := range tests {
+		got, total, err := labelPage(tt.list, tt.page)
+		if (err != nil) != tt.wantErr || len(got) != tt.wantLen || total != tt.wantTotal {
+			t.Errorf("labelPage(%v, %v) = %v, %v, %v, want %v, %v", len(tt.list), tt.page, len(got), total, err, tt.wantLen, tt.wantTotal)
+		}
+	}
+}
+
+func Test_writeReprintLabels(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeReprintLabels(restful.NewResponse(rec), []AssetKey{{Name: "A", Base: "lab"}, {Name: "B", Base: "lab"}})
+	if got, want := rec.Header().Get("X-Reprint-Labels"), "A@lab, B@lab"; got != want {
+		t.Errorf("writeReprintLabels() header = %q, want %q", got, want)
+	}
+
+	rec = httptest.NewRecorder()
+	writeReprintLabels(restful.NewResponse(rec), nil)
+	if _, ok := rec.Header()["X-Reprint-Labels"]; ok {
+		t.Errorf("writeReprintLabels() set the header with nothing to reprint")
+	}
+}
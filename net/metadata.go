@@ -0,0 +1,186 @@
+// Register metadata of the Assets, like category, serial and owner, and searching by it
+
+package net
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// metaKey normalizes the csv column name, so that Purchase Value, purchase_value
+// and purchaseValue are all the same
+func metaKey(column string) string {
+	return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToLower(column))
+}
+
+// parseDate accepts a date like 2019-07-01, or a time in RFC3339
+func parseDate(raw string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", raw); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return t, errors.New("the date " + raw + " should be like 2019-07-01")
+	}
+	return t, nil
+}
+
+// setMetadata sets the metadata of the Asset from the extra csv columns,
+// and keeps the unknown ones as free-form attributes
+func setMetadata(as *Asset, columns map[string]string) error {
+	keys := make([]string, 0, len(columns))
+	for column := range columns {
+		keys = append(keys, column)
+	}
+	sort.Strings(keys)
+
+	for _, column := range keys {
+		value := columns[column]
+		switch metaKey(column) {
+		case "category":
+			as.Category = value
+		case "serial", "serialnumber", "tag", "tagnumber":
+			as.Serial = value
+		case "owner":
+			as.Owner = value
+		case "purchasevalue":
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil || v < 0 {
+				return errors.New("the purchase value " + value + " should be a non-negative number")
+			}
+			as.PurchaseValue = v
+		case "purchasedate":
+			t, err := parseDate(value)
+			if err != nil {
+				return err
+			}
+			as.PurchaseDate = t
+		case "status":
+			if !validStatus(value) {
+				return errors.New("unknown status " + value)
+			}
+			as.Status = value
+		default:
+			if as.Attrs == nil {
+				as.Attrs = make(map[string]string)
+			}
+			as.Attrs[column] = value
+		}
+	}
+	return nil
+}
+
+// category is the Asset's category, or the attribute category set before it was a field
+func (as Asset) category() string {
+	if as.Category != "" {
+		return as.Category
+	}
+	return as.Attrs["category"]
+}
+
+// parseAssetSearch builds the MongoDB filter of the query; all the conditions should match
+func parseAssetSearch(query url.Values) (filter bson.M, err error) {
+	conds := []bson.M{}
+
+	if v := query.Get("category"); v != "" {
+		conds = append(conds, bson.M{"$or": []bson.M{{"category": v}, {"attrs.category": v}}})
+	}
+	if v := query.Get("serial"); v != "" {
+		conds = append(conds, bson.M{"serial": v})
+	}
+	if v := query.Get("owner"); v != "" {
+		conds = append(conds, bson.M{"owner": v})
+	}
+	if v := query.Get("status"); v != "" {
+		statuses, err := parseStatuses(v)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, statusFilter(statuses))
+	}
+	if v := query.Get("q"); v != "" { // case-insensitive, anywhere in the text fields
+		re := bson.M{"$regex": regexp.QuoteMeta(v), "$options": "i"}
+		conds = append(conds, bson.M{"$or": []bson.M{
+			{"name": re}, {"serial": re}, {"owner": re}, {"category": re}}})
+	}
+
+	for _, attr := range query["attr"] {
+		i := strings.Index(attr, ":")
+		if i <= 0 || strings.ContainsAny(attr[:i], ".$") {
+			return nil, errors.New("the attribute " + attr + " should be like key:value")
+		}
+		conds = append(conds, bson.M{"attrs." + attr[:i]: attr[i+1:]})
+	}
+
+	value := bson.M{}
+	for param, op := range map[string]string{"min-value": "$gte", "max-value": "$lte"} {
+		if v := query.Get(param); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, errors.New(param + " should be a number")
+			}
+			value[op] = f
+		}
+	}
+	if len(value) > 0 {
+		conds = append(conds, bson.M{"purchasevalue": value})
+	}
+
+	date := bson.M{}
+	for param, op := range map[string]string{"purchased-from": "$gte", "purchased-to": "$lte"} {
+		if v := query.Get(param); v != "" {
+			t, err := parseDate(v)
+			if err != nil {
+				return nil, errors.New(param + ": " + err.Error())
+			}
+			date[op] = t
+		}
+	}
+	if len(date) > 0 {
+		conds = append(conds, bson.M{"purchasedate": date})
+	}
+
+	if len(conds) == 0 {
+		return bson.M{}, nil
+	}
+	return bson.M{"$and": conds}, nil
+}
+
+// GET PREFIX/assets?space=base&category=laptop&owner=&serial=&status=active,in-repair&q=&attr=color:black
+// &min-value=&max-value=&purchased-from=2019-01-01&purchased-to=
+func (r RestContext) searchAssets(req *restful.Request, resp *restful.Response) {
+	filter, err := parseAssetSearch(req.Request.URL.Query())
+	if err != nil {
+		resp.WriteError(http.StatusNotAcceptable, err)
+		return
+	}
+
+	if spaceName := req.QueryParameter("space"); spaceName != "" { // in the space tree
+		spaceList, errCode, err := r.dbGetSubtreeSpaces(spaceName, true)
+		if err != nil {
+			resp.WriteError(errCode, err)
+			return
+		}
+		baseNames := make([]string, 0, len(spaceList))
+		for _, sp := range spaceList {
+			baseNames = append(baseNames, sp.Name)
+		}
+		filter = bson.M{"$and": []bson.M{filter, {"base": bson.M{"$in": baseNames}}}}
+	}
+
+	list, errCode, err := r.dbFindAssets(filter)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, list)
+}
@@ -0,0 +1,112 @@
+package net
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func Test_setMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns map[string]string
+		want    Asset
+		wantErr bool
+	}{{
+		name: "fields and attributes",
+		columns: map[string]string{"Category": "laptop", "Serial Number": "SN-01", "owner": "IT",
+			"purchase_value": "1200.5", "PurchaseDate": "2019-07-01", "color": "black"},
+		want: Asset{Category: "laptop", Serial: "SN-01", Owner: "IT", PurchaseValue: 1200.5,
+			PurchaseDate: time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC), Attrs: map[string]string{"color": "black"}},
+	}, {
+		name:    "negative value",
+		columns: map[string]string{"purchaseValue": "-1"},
+		wantErr: true,
+	}, {
+		name:    "bad date",
+		columns: map[string]string{"purchaseDate": "01/07/2019"},
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Asset
+			err := setMetadata(&got, tt.columns)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("setMetadata() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("setMetadata() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAsset_category(t *testing.T) {
+	tests := []struct {
+		asset Asset
+		want  string
+	}{
+		{Asset{Category: "laptop", Attrs: map[string]string{"category": "chair"}}, "laptop"},
+		{Asset{Attrs: map[string]string{"category": "chair"}}, "chair"},
+		{Asset{}, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.asset.category(); got != tt.want {
+			t.Errorf("Asset.category() = %v, want %v", got, tt.want)
+		}
+	}
+}
+
+func Test_parseAssetSearch(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    bson.M
+		wantErr bool
+	}{{
+		name:  "empty",
+		query: "",
+		want:  bson.M{},
+	}, {
+		name:  "owner and attributes",
+		query: "owner=IT&attr=color:black&attr=size:",
+		want: bson.M{"$and": []bson.M{{"owner": "IT"},
+			{"attrs.color": "black"}, {"attrs.size": ""}}},
+	}, {
+		name:  "text",
+		query: "q=a.b",
+		want: bson.M{"$and": []bson.M{{"$or": []bson.M{
+			{"name": bson.M{"$regex": `a\.b`, "$options": "i"}},
+			{"serial": bson.M{"$regex": `a\.b`, "$options": "i"}},
+			{"owner": bson.M{"$regex": `a\.b`, "$options": "i"}},
+			{"category": bson.M{"$regex": `a\.b`, "$options": "i"}}}}}},
+	}, {
+		name:  "value and date",
+		query: "min-value=100&purchased-to=2019-07-01",
+		want: bson.M{"$and": []bson.M{{"purchasevalue": bson.M{"$gte": 100.0}},
+			{"purchasedate": bson.M{"$lte": time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)}}}},
+	}, {
+		name:    "bad attribute",
+		query:   "attr=a.b:c",
+		wantErr: true,
+	}, {
+		name:    "bad value",
+		query:   "max-value=lots",
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			got, err := parseAssetSearch(query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAssetSearch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAssetSearch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
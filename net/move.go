@@ -0,0 +1,274 @@
+// Moving and renaming the Spaces, with everything referring to them by name
+
+package net
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// spaceReference is a field holding a Space's name, only where the other fields match if given;
+// a field under an array like "stops.base" is updated in every element of the array matching,
+// and then where tests the element
+type spaceReference struct {
+	collection string
+	field      string
+	where      bson.M
+}
+
+// spaceReferences are all the fields referring to the Spaces by name, renamed along with the Space
+var spaceReferences = []spaceReference{
+	{"space", "base", nil},
+	{"asset", "base", nil},
+	{"attachment", "base", nil},
+	{"booking", "space", nil},
+	{"campaign", "space", nil},
+	{"inspection", "base", nil},
+	{"plan", "space", nil},
+	{"statuschange", "base", nil},
+	{"session", "space", nil},
+	{"session", "stops.base", nil},
+	{"session", "deferred.space", nil},
+	{"session", "misplaced.base", nil},
+	{"session", "misplaced.foundin", nil},
+	{"session", "route.sequence.base", nil},
+	{"session", "route.sequence.name", bson.M{"isportal": true}}, // the doors of the spaces
+	{"session", "route.outlines.name", nil},
+	{"weightrule", "value", bson.M{"field": bson.M{"$in": []string{"base", "space.name"}}}},
+}
+
+// renameUpdate builds the filter, the update and the options renaming the reference from old to new;
+// a Session renamed in is a new version, see dbReplaceSession
+func (ref spaceReference) renameUpdate(old string, new string) (filter bson.M, update bson.M, opts *options.UpdateOptions) {
+	filter, update, opts = bson.M{ref.field: old}, bson.M{}, options.Update()
+	if ref.collection == "session" {
+		update["$inc"] = bson.M{"version": 1}
+	}
+	i := strings.LastIndex(ref.field, ".")
+	if i < 0 {
+		for k, v := range ref.where {
+			filter[k] = v
+		}
+		update["$set"] = bson.M{ref.field: new}
+		return filter, update, opts
+	}
+
+	// every element of the array matching
+	element := bson.M{"e." + ref.field[i+1:]: old}
+	if ref.where != nil {
+		match := bson.M{ref.field[i+1:]: old}
+		for k, v := range ref.where {
+			match[k], element["e."+k] = v, v
+		}
+		filter = bson.M{ref.field[:i]: bson.M{"$elemMatch": match}}
+	}
+	opts.SetArrayFilters(options.ArrayFilters{Filters: []interface{}{element}})
+	update["$set"] = bson.M{ref.field[:i] + ".$[e]." + ref.field[i+1:]: new}
+	return filter, update, opts
+}
+
+// checkMove checks moving the Space to the new base: it cannot lie in itself or its subspaces;
+// subtree is the Space and all its subspaces
+func checkMove(subtree []Space, base string) error {
+	for _, sp := range subtree {
+		if sp.Name == base {
+			return errors.New("the space " + subtree[0].Name + " cannot be moved into " + base + ", which lies in itself")
+		}
+	}
+	return nil
+}
+
+// dbCheckMove checks again in the transaction what moveSpace has checked: the new name is free,
+// and the new base exists and lies out of the Space
+func (r RestContext) dbCheckMove(ctx mongo.SessionContext, old Space, moved Space) (errCode int, err error) {
+	col := r.mongoDB.Collection("space")
+	if moved.Name != old.Name {
+		n, err := col.CountDocuments(ctx, bson.M{"name": moved.Name})
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if n > 0 {
+			return http.StatusConflict, errors.New("the space " + moved.Name + " already exists")
+		}
+	}
+	if moved.Base == old.Base {
+		return http.StatusOK, nil
+	}
+
+	// walk up from the new base, not through the Space
+	visited := make(map[string]bool)
+	for base := moved.Base; base != "" && !visited[base]; {
+		if base == old.Name {
+			return http.StatusConflict, errors.New("the space " + old.Name + " cannot be moved into " +
+				moved.Base + ", which lies in itself")
+		}
+		visited[base] = true
+		var sp Space
+		if err := col.FindOne(ctx, bson.M{"name": base}).Decode(&sp); err == mongo.ErrNoDocuments {
+			if base == moved.Base {
+				return http.StatusForbidden, errors.New("the base space " + moved.Base + " does not exist")
+			}
+			break
+		} else if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		base = sp.Base
+	}
+	return http.StatusOK, nil
+}
+
+// dbMoveSpace renames or moves the Space in one transaction, along with the base of its subspaces
+// and its Assets and the other references by name, then updates their cache; the labels of
+// the Assets directly in a renamed Space are void, as they carry name@base, and are listed to reprint
+func (r RestContext) dbMoveSpace(old Space, moved Space) (reprint []AssetKey, errCode int, err error) {
+	children, assetList := []Space{}, []Asset{}
+	if old.Name != moved.Name { // to update the cache
+		subtree, errCode, err := r.dbGetSubtreeSpaces(old.Name, false)
+		if err != nil {
+			return nil, errCode, err
+		}
+		for _, sp := range subtree[1:] {
+			if sp.Base == old.Name {
+				children = append(children, sp)
+			}
+		}
+		if assetList, errCode, err = r.dbFindAssets(bson.M{"base": old.Name}); err != nil {
+			return nil, errCode, err
+		}
+	}
+
+	errCode, err = r.dbTransaction(30*time.Second, func(ctx mongo.SessionContext) (int, error) {
+		if errCode, err := r.dbCheckMove(ctx, old, moved); err != nil {
+			return errCode, err
+		}
+		updateResult, err := r.mongoDB.Collection("space").UpdateOne(ctx, bson.M{"name": old.Name},
+			bson.M{"$set": bson.M{"name": moved.Name, "base": moved.Base, "rx": moved.Rx, "ry": moved.Ry}})
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if updateResult.MatchedCount == 0 {
+			return http.StatusNotFound, errors.New("the space " + old.Name + " does not exist")
+		}
+		if old.Name == moved.Name {
+			return http.StatusOK, nil
+		}
+
+		for _, ref := range spaceReferences {
+			filter, update, opts := ref.renameUpdate(old.Name, moved.Name)
+			if _, err := r.mongoDB.Collection(ref.collection).UpdateMany(ctx, filter, update, opts); err != nil {
+				return http.StatusInternalServerError, err
+			}
+		}
+		return http.StatusOK, nil
+	})
+	if err != nil {
+		return nil, errCode, err
+	}
+
+	reprint = make([]AssetKey, 0, len(assetList))
+	for _, as := range assetList {
+		reprint = append(reprint, AssetKey{Name: as.Name, Base: moved.Name})
+	}
+	go func() { // replace the cache under the new keys
+		redisConn := r.redisConnPool.Get()
+		defer redisConn.Close()
+
+		set := func(k string, v interface{}, expire int) {
+			b, _ := json.Marshal(v)
+			redisConn.Do("SET", k, b)
+			redisConn.Do("EXPIRE", k, expire)
+		}
+		redisConn.Do("DEL", "space-"+old.Name)
+		set("space-"+moved.Name, moved, WEEK_SECONDS)
+		for _, sp := range children {
+			sp.Base = moved.Name
+			set("space-"+sp.Name, sp, WEEK_SECONDS)
+		}
+		for _, as := range assetList {
+			redisConn.Do("DEL", as.Name+"@"+as.Base)
+			as.Base = moved.Name
+			set(as.Name+"@"+as.Base, as, MONTH_SECONDS)
+		}
+	}()
+	return reprint, http.StatusOK, nil
+}
+
+// POST PREFIX/spaces/{space-name}/move?name=new-name&base=new-base&rx=1&ry=2
+func (r RestContext) moveSpace(req *restful.Request, resp *restful.Response) {
+	spaceName := req.PathParameter("space-name")
+	query := req.Request.URL.Query()
+
+	old, errCode, err := r.dbGetSpace(spaceName, false)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	moved := *old
+
+	given := false
+	if v := query.Get("name"); v != "" {
+		moved.Name, given = v, true
+	}
+	if _, ok := query["base"]; ok { // empty to be a top space
+		moved.Base, given = query.Get("base"), true
+	}
+	for param, ptr := range map[string]*float64{"rx": &moved.Rx, "ry": &moved.Ry} {
+		if v := query.Get(param); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				resp.WriteError(http.StatusNotAcceptable, errors.New(param+" should be a number"))
+				return
+			}
+			*ptr, given = f, true
+		}
+	}
+	if !given {
+		resp.WriteError(http.StatusNotAcceptable, errors.New("no valid query parameter"))
+		return
+	}
+
+	if moved.Base != old.Base {
+		subtree, errCode, err := r.dbGetSubtreeSpaces(old.Name, false)
+		if err != nil {
+			resp.WriteError(errCode, err)
+			return
+		}
+		if err := checkMove(subtree, moved.Base); err != nil {
+			resp.WriteError(http.StatusConflict, err)
+			return
+		}
+		if moved.Base != "" {
+			if _, _, err := r.dbGetSpace(moved.Base, false); err != nil {
+				resp.WriteError(http.StatusForbidden, errors.New("the base space "+moved.Base+" does not exist"))
+				return
+			}
+		}
+	}
+	if moved.Name != old.Name {
+		if resultPtr, _, _ := r.dbGetSpace(moved.Name, false); resultPtr != nil {
+			resp.WriteError(http.StatusConflict, errors.New("the space "+moved.Name+" already exists"))
+			return
+		}
+	}
+	if errCode, err := r.checkPlacement([]Space{moved}, nil); err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+
+	reprint, errCode, err := r.dbMoveSpace(*old, moved)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	writeReprintLabels(resp, reprint)
+	resp.WriteHeaderAndEntity(http.StatusOK, moved)
+}
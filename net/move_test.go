@@ -0,0 +1,79 @@
+package net
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func Test_checkMove(t *testing.T) {
+	subtree := []Space{
+		{Name: "floor", Base: "building"},
+		{Name: "room", Base: "floor"},
+		{Name: "closet", Base: "room"},
+	}
+	tests := []struct {
+		name    string
+		base    string
+		wantErr bool
+	}{
+		{"to another building", "annex", false},
+		{"to the top", "", false},
+		{"into itself", "floor", true},
+		{"into its subspace", "closet", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkMove(subtree, tt.base); (err != nil) != tt.wantErr {
+				t.Errorf("checkMove() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_spaceReference_renameUpdate(t *testing.T) {
+	filter, update, opts := spaceReference{"asset", "base", nil}.renameUpdate("old", "new")
+	if want := (bson.M{"base": "old"}); !reflect.DeepEqual(filter, want) {
+		t.Errorf("renameUpdate() filter = %v, want %v", filter, want)
+	}
+	if want := (bson.M{"$set": bson.M{"base": "new"}}); !reflect.DeepEqual(update, want) {
+		t.Errorf("renameUpdate() update = %v, want %v", update, want)
+	}
+	if opts.ArrayFilters != nil {
+		t.Errorf("renameUpdate() arrayFilters = %v, want nil", opts.ArrayFilters)
+	}
+
+	filter, update, opts = spaceReference{"session", "misplaced.foundin", nil}.renameUpdate("old", "new")
+	if want := (bson.M{"misplaced.foundin": "old"}); !reflect.DeepEqual(filter, want) {
+		t.Errorf("renameUpdate() filter = %v, want %v", filter, want)
+	}
+	if want := (bson.M{"$set": bson.M{"misplaced.$[e].foundin": "new"}, "$inc": bson.M{"version": 1}}); !reflect.DeepEqual(update, want) {
+		t.Errorf("renameUpdate() update = %v, want %v", update, want)
+	}
+	if want := []interface{}{bson.M{"e.foundin": "old"}}; opts.ArrayFilters == nil || !reflect.DeepEqual(opts.ArrayFilters.Filters, want) {
+		t.Errorf("renameUpdate() arrayFilters = %v, want %v", opts.ArrayFilters, want)
+	}
+}
+
+func Test_spaceReference_renameUpdate_where(t *testing.T) {
+	filter, update, opts := spaceReference{"session", "route.sequence.name", bson.M{"isportal": true}}.renameUpdate("old", "new")
+	if want := (bson.M{"route.sequence": bson.M{"$elemMatch": bson.M{"name": "old", "isportal": true}}}); !reflect.DeepEqual(filter, want) {
+		t.Errorf("renameUpdate() filter = %v, want %v", filter, want)
+	}
+	if want := (bson.M{"$set": bson.M{"route.sequence.$[e].name": "new"}, "$inc": bson.M{"version": 1}}); !reflect.DeepEqual(update, want) {
+		t.Errorf("renameUpdate() update = %v, want %v", update, want)
+	}
+	if want := []interface{}{bson.M{"e.name": "old", "e.isportal": true}}; opts.ArrayFilters == nil || !reflect.DeepEqual(opts.ArrayFilters.Filters, want) {
+		t.Errorf("renameUpdate() arrayFilters = %v, want %v", opts.ArrayFilters, want)
+	}
+
+	rules := bson.M{"$in": []string{"base", "space.name"}}
+	filter, update, _ = spaceReference{"weightrule", "value", bson.M{"field": rules}}.renameUpdate("old", "new")
+	if want := (bson.M{"value": "old", "field": rules}); !reflect.DeepEqual(filter, want) {
+		t.Errorf("renameUpdate() filter = %v, want %v", filter, want)
+	}
+	if want := (bson.M{"$set": bson.M{"value": "new"}}); !reflect.DeepEqual(update, want) {
+		t.Errorf("renameUpdate() update = %v, want %v", update, want)
+	}
+}
@@ -0,0 +1,441 @@
+// JSON merge patches (RFC 7386) of the Spaces and the Assets, validated field by field
+
+package net
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MIME_MERGE_PATCH is the media type of the JSON merge patches
+const MIME_MERGE_PATCH = "application/merge-patch+json"
+
+// FieldError tells what is wrong with a field of the patch
+type FieldError struct {
+	Field   string `json:"field" description:"the JSON field, or position for lying out of the base space"`
+	Message string `json:"message" description:"what is wrong with it"`
+}
+
+// PatchErrors is the response to a patch not applied, listing every field wrong
+type PatchErrors struct {
+	Errors []FieldError `json:"errors" description:"the fields wrong, sorted by field"`
+}
+
+// assetReference is a record referring to the Assets by name and base; under an array like
+// "stops", every element of the array matching is updated
+type assetReference struct {
+	collection string
+	array      string
+}
+
+// assetReferences are all the records following the Asset moved to another base
+var assetReferences = []assetReference{
+	{"attachment", ""},
+	{"inspection", ""},
+	{"statuschange", ""},
+	{"session", "stops"},
+	{"session", "misplaced"},
+}
+
+// moveUpdate builds the filter, the update and the array filters moving the reference of the Asset
+func (ref assetReference) moveUpdate(name string, old string, new string) (filter bson.M, update bson.M, arrayFilters []interface{}) {
+	if ref.array == "" {
+		return bson.M{"name": name, "base": old}, bson.M{"$set": bson.M{"base": new}}, nil
+	}
+	filter = bson.M{ref.array: bson.M{"$elemMatch": bson.M{"name": name, "base": old}}}
+	update = bson.M{"$set": bson.M{ref.array + ".$[e].base": new}}
+	if ref.collection == "session" { // see dbReplaceSession
+		update["$inc"] = bson.M{"version": 1}
+	}
+	return filter, update, []interface{}{bson.M{"e.name": name, "e.base": old}}
+}
+
+// mergePatch applies the patch to the target as decoded from JSON: the objects are merged
+// recursively, null removes the member, and anything else replaces the target
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = make(map[string]interface{})
+	}
+	for k, v := range patchObj {
+		if v == nil {
+			delete(targetObj, k)
+		} else {
+			targetObj[k] = mergePatch(targetObj[k], v)
+		}
+	}
+	return targetObj
+}
+
+// applyPatch merges the patch into the JSON of ptr, which points to a struct, and decodes the result into
+// the struct anew; it returns the top-level fields patched, and the ones failing to decode
+func applyPatch(ptr interface{}, raw []byte) (fields []string, errs []FieldError) {
+	var patch interface{}
+	if err := json.Unmarshal(raw, &patch); err != nil {
+		return nil, []FieldError{{Field: "", Message: "the patch is not valid JSON: " + err.Error()}}
+	}
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return nil, []FieldError{{Field: "", Message: "the patch should be a JSON object"}}
+	}
+
+	var doc, merged map[string]interface{}
+	b, _ := json.Marshal(ptr)
+	json.Unmarshal(b, &doc)
+	json.Unmarshal(b, &merged)
+	merged = mergePatch(merged, patchObj).(map[string]interface{})
+
+	// decode the fields one by one to tell which are wrong
+	typ := reflect.TypeOf(ptr).Elem()
+	for field := range patchObj {
+		b, _ := json.Marshal(map[string]interface{}{field: merged[field]})
+		dec := json.NewDecoder(strings.NewReader(string(b)))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(reflect.New(typ).Interface()); err != nil {
+			msg := err.Error()
+			if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+				msg = "should be " + typeErr.Type.String() + ", not " + typeErr.Value
+			} else if strings.HasPrefix(msg, "json: unknown field") {
+				msg = "unknown field"
+			}
+			errs = append(errs, FieldError{Field: field, Message: msg})
+			if v, ok := doc[field]; ok { // kept as it was
+				merged[field] = v
+			} else {
+				delete(merged, field)
+			}
+			continue
+		}
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	fresh := reflect.New(typ)
+	b, _ = json.Marshal(merged)
+	json.Unmarshal(b, fresh.Interface())
+	reflect.ValueOf(ptr).Elem().Set(fresh.Elem())
+	return fields, errs
+}
+
+// patched tells whether the field is in the patch
+func patched(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// nonNegative checks the number is finite and not negative
+func nonNegative(field string, v float64) []FieldError {
+	if math.IsNaN(v) || math.IsInf(v, 0) || v < 0 {
+		return []FieldError{{Field: field, Message: "should be a non-negative number"}}
+	}
+	return nil
+}
+
+// validateAssetPatch checks the patched Asset field by field; the status, the name and the inspection time
+// are changed elsewhere, and the base space is checked in the DB
+func validateAssetPatch(old Asset, as Asset) (errs []FieldError) {
+	if as.Name != old.Name {
+		errs = append(errs, FieldError{"name", "cannot be changed, as the URL names the asset"})
+	}
+	if as.Base == "" {
+		errs = append(errs, FieldError{"base", "should not be empty"})
+	}
+	if as.Status != old.Status {
+		errs = append(errs, FieldError{"status", "is changed by PUT .../status, which validates the transition"})
+	}
+	if !as.LastChecked.Equal(old.LastChecked) {
+		errs = append(errs, FieldError{"lastChecked", "is set by recording the inspections"})
+	}
+	errs = append(errs, nonNegative("weight", as.Weight)...)
+	errs = append(errs, nonNegative("purchaseValue", as.PurchaseValue)...)
+	errs = append(errs, nonNegative("dwell", as.Dwell)...)
+	return errs
+}
+
+// validateSpacePatch checks the patched Space field by field, except for the base space checked in the DB
+func validateSpacePatch(old Space, sp Space, fields []string) (errs []FieldError) {
+	if sp.Name != old.Name {
+		errs = append(errs, FieldError{"name", "cannot be changed here, use POST .../move to rename the space"})
+	}
+	if sp.SpeedFactor != 0 {
+		errs = append(errs, nonNegative("speedFactor", sp.SpeedFactor)...)
+	}
+	if err := validGeometry(sp); err != nil {
+		field := "outline" // to the first geometry field patched
+		for _, f := range []string{"rotation", "scale", "width", "height", "outline"} {
+			if patched(fields, f) {
+				field = f
+				break
+			}
+		}
+		errs = append(errs, FieldError{field, err.Error()})
+	}
+	return errs
+}
+
+// toSet picks the patched fields of the struct to $set in MongoDB, where the keys are in lower case
+func toSet(v interface{}, fields []string) (bson.M, error) {
+	b, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	doc := bson.M{}
+	if err = bson.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	set := bson.M{}
+	for _, f := range fields {
+		set[strings.ToLower(f)] = doc[strings.ToLower(f)]
+	}
+	return set, nil
+}
+
+// sortFieldErrors sorts the errors by field
+func sortFieldErrors(errs []FieldError) {
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+}
+
+// writePatchErrors responds with every field wrong, sorted by field
+func writePatchErrors(resp *restful.Response, errs []FieldError) {
+	sortFieldErrors(errs)
+	resp.WriteHeaderAndEntity(http.StatusNotAcceptable, PatchErrors{Errors: errs})
+}
+
+// dbPatchSpace sets the patched fields of the Space, and makes the new cache
+func (r RestContext) dbPatchSpace(name string, set bson.M) (newSpacePtr *Space, errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+	col := r.mongoDB.Collection("space")
+
+	updateResult, err := col.UpdateOne(ctx, bson.M{"name": name}, bson.M{"$set": set})
+	if err != nil {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, err
+	}
+	if updateResult.MatchedCount == 0 {
+		return nil, http.StatusNotFound, errors.New("the original space does not exist")
+	}
+	updated := Space{}
+	if err = col.FindOne(ctx, bson.M{"name": name}).Decode(&updated); err != nil {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, err
+	}
+
+	go func() {
+		// update Redis cache
+		redisConn := r.redisConnPool.Get()
+		defer redisConn.Close()
+
+		k := "space-" + name
+		b, _ := json.Marshal(updated)
+		if _, err := redisConn.Do("SET", k, b); err != nil {
+			log.Println("unable to update cache of key " + k + " in Redis, data may be dirty")
+			log.Println(err)
+		}
+		redisConn.Do("EXPIRE", k, WEEK_SECONDS)
+	}()
+	return &updated, http.StatusOK, nil
+}
+
+// dbMoveAsset sets the patched fields of the Asset moved to another base in one transaction,
+// along with the records referring to it, then renames the cache
+func (r RestContext) dbMoveAsset(old Asset, set bson.M) (newAssetPtr *Asset, errCode int, err error) {
+	updated := Asset{}
+	errCode, err = r.dbTransaction(10*time.Second, func(ctx mongo.SessionContext) (int, error) {
+		col := r.mongoDB.Collection("asset")
+		updateResult, err := col.UpdateOne(ctx, bson.M{"name": old.Name, "base": old.Base}, bson.M{"$set": set})
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if updateResult.MatchedCount == 0 {
+			return http.StatusNotFound, errors.New("the original asset does not exist")
+		}
+		if err = col.FindOne(ctx, bson.M{"name": old.Name, "base": set["base"]}).Decode(&updated); err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		for _, ref := range assetReferences {
+			filter, update, arrayFilters := ref.moveUpdate(old.Name, old.Base, updated.Base)
+			opts := options.Update()
+			if arrayFilters != nil {
+				opts.SetArrayFilters(options.ArrayFilters{Filters: arrayFilters})
+			}
+			if _, err := r.mongoDB.Collection(ref.collection).UpdateMany(ctx, filter, update, opts); err != nil {
+				return http.StatusInternalServerError, err
+			}
+		}
+		return http.StatusOK, nil
+	})
+	if err != nil {
+		return nil, errCode, err
+	}
+
+	go func() {
+		// rename Redis cache
+		redisConn := r.redisConnPool.Get()
+		defer redisConn.Close()
+
+		redisConn.Do("DEL", old.Name+"@"+old.Base)
+		k := updated.Name + "@" + updated.Base
+		b, _ := json.Marshal(updated)
+		if _, err := redisConn.Do("SET", k, b); err != nil {
+			log.Println("unable to update cache of key " + k + " in Redis, data may be dirty")
+			log.Println(err)
+		}
+		redisConn.Do("EXPIRE", k, MONTH_SECONDS)
+	}()
+	return &updated, http.StatusOK, nil
+}
+
+// PATCH PREFIX/spaces/{space-name}
+// merge patch: {"rx": 1, "attrs": {"public": "true"}, "outline": null}
+func (r RestContext) patchSpace(req *restful.Request, resp *restful.Response) {
+	raw, err := ioutil.ReadAll(req.Request.Body)
+	if err != nil || len(raw) == 0 {
+		resp.WriteError(http.StatusNotAcceptable, errors.New("the merge patch should be in the body"))
+		return
+	}
+	old, errCode, err := r.dbGetSpace(req.PathParameter("space-name"), false)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+
+	sp := *old
+	fields, errs := applyPatch(&sp, raw)
+	errs = append(errs, validateSpacePatch(*old, sp, fields)...)
+	if sp.Base != old.Base {
+		if subtree, errCode, err := r.dbGetSubtreeSpaces(old.Name, false); err != nil {
+			resp.WriteError(errCode, err)
+			return
+		} else if err := checkMove(subtree, sp.Base); err != nil {
+			errs = append(errs, FieldError{"base", err.Error()})
+		} else if sp.Base != "" {
+			if _, _, err := r.dbGetSpace(sp.Base, false); err != nil {
+				errs = append(errs, FieldError{"base", "the base space " + sp.Base + " does not exist"})
+			}
+		}
+	}
+
+	if len(errs) == 0 { // lying inside the base space, with its subspaces and Assets inside it
+		if _, err := r.checkPlacement([]Space{sp}, nil); err != nil {
+			errs = append(errs, FieldError{"position", err.Error()})
+		}
+		children, errCode, err := r.dbGetSubtreeSpaces(sp.Name, false)
+		if err != nil {
+			resp.WriteError(errCode, err)
+			return
+		}
+		assetList, errCode, err := r.dbFindAssets(bson.M{"base": sp.Name})
+		if err != nil {
+			resp.WriteError(errCode, err)
+			return
+		}
+		inner := []Space{}
+		for _, child := range children[1:] {
+			if child.Base == sp.Name {
+				inner = append(inner, child)
+			}
+		}
+		if out := placementErrors(inner, assetList, map[string]Space{sp.Name: sp}); len(out) > 0 {
+			sort.Strings(out)
+			errs = append(errs, FieldError{"outline", strings.Join(out, "; ")})
+		}
+	}
+	if len(errs) > 0 {
+		writePatchErrors(resp, errs)
+		return
+	}
+	if len(fields) == 0 {
+		resp.WriteHeaderAndEntity(http.StatusOK, *old)
+		return
+	}
+
+	set, err := toSet(sp, fields)
+	if err != nil {
+		resp.WriteError(http.StatusInternalServerError, err)
+		return
+	}
+	newSpacePtr, errCode, err := r.dbPatchSpace(old.Name, set)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, *newSpacePtr)
+}
+
+// mergePatchAsset applies the merge patch in the body to the Asset, see updateAsset
+func (r RestContext) mergePatchAsset(req *restful.Request, resp *restful.Response, raw []byte) {
+	old, errCode, err := r.dbGetAsset(req.PathParameter("asset-name"), req.PathParameter("space-name"), false)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+
+	as := *old
+	fields, errs := applyPatch(&as, raw)
+	errs = append(errs, validateAssetPatch(*old, as)...)
+	if as.Base != old.Base && as.Base != "" {
+		if _, _, err := r.dbGetSpace(as.Base, false); err != nil {
+			errs = append(errs, FieldError{"base", "the base space " + as.Base + " does not exist"})
+		} else if resultPtr, _, _ := r.dbGetAsset(as.Name, as.Base, false); resultPtr != nil {
+			resp.WriteError(http.StatusConflict, errors.New("the asset "+as.Name+"@"+as.Base+" already exists"))
+			return
+		}
+	}
+	if len(errs) == 0 {
+		if _, err := r.checkPlacement(nil, []Asset{as}); err != nil {
+			errs = append(errs, FieldError{"position", err.Error()})
+		}
+	}
+	if len(errs) > 0 {
+		writePatchErrors(resp, errs)
+		return
+	}
+	if len(fields) == 0 {
+		resp.WriteHeaderAndEntity(http.StatusOK, *old)
+		return
+	}
+
+	set, err := toSet(as, fields)
+	if err != nil {
+		resp.WriteError(http.StatusInternalServerError, err)
+		return
+	}
+	var newAssetPtr *Asset
+	if as.Base != old.Base {
+		newAssetPtr, errCode, err = r.dbMoveAsset(*old, set)
+	} else {
+		newAssetPtr, errCode, err = r.dbUpdateAsset(old.Name, old.Base, bson.D{{"$set", set}})
+	}
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	if as.Base != old.Base { // the label carries name@base
+		writeReprintLabels(resp, []AssetKey{{Name: newAssetPtr.Name, Base: newAssetPtr.Base}})
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, *newAssetPtr)
+}
@@ -0,0 +1,160 @@
+package net
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	dataio "github.com/miosolo/readygo/io"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func Test_mergePatch(t *testing.T) {
+	// the examples of RFC 7386
+	tests := []struct {
+		target string
+		patch  string
+		want   string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.patch, func(t *testing.T) {
+			var target, patch, want interface{}
+			json.Unmarshal([]byte(tt.target), &target)
+			json.Unmarshal([]byte(tt.patch), &patch)
+			json.Unmarshal([]byte(tt.want), &want)
+			if got := mergePatch(target, patch); !reflect.DeepEqual(got, want) {
+				t.Errorf("mergePatch() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func Test_applyPatch(t *testing.T) {
+	old := Asset{Name: "A", Base: "room", Rx: 1, Ry: 2, Weight: 1, Category: "laptop",
+		Attrs: map[string]string{"color": "black", "os": "linux"}}
+
+	tests := []struct {
+		name       string
+		patch      string
+		want       Asset
+		wantFields []string
+		wantErrs   []FieldError
+	}{
+		{"position and metadata", `{"rx": 3, "owner": "it", "attrs": {"os": null, "ram": "16G"}}`,
+			Asset{Name: "A", Base: "room", Rx: 3, Ry: 2, Weight: 1, Category: "laptop", Owner: "it",
+				Attrs: map[string]string{"color": "black", "ram": "16G"}},
+			[]string{"attrs", "owner", "rx"}, nil},
+		{"removed", `{"category": null}`,
+			Asset{Name: "A", Base: "room", Rx: 1, Ry: 2, Weight: 1, Attrs: old.Attrs},
+			[]string{"category"}, nil},
+		{"wrong fields kept", `{"weight": "heavy", "size": 1, "ry": 5}`,
+			Asset{Name: "A", Base: "room", Rx: 1, Ry: 5, Weight: 1, Category: "laptop", Attrs: old.Attrs},
+			[]string{"ry"},
+			[]FieldError{{"size", "unknown field"}, {"weight", "should be float64, not string"}}},
+		{"not an object", `[1]`, old, nil, []FieldError{{"", "the patch should be a JSON object"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			as := old
+			as.Attrs = map[string]string{"color": "black", "os": "linux"}
+			fields, errs := applyPatch(&as, []byte(tt.patch))
+			sortFieldErrors(errs)
+			if !reflect.DeepEqual(as, tt.want) {
+				t.Errorf("applyPatch() = %+v, want %+v", as, tt.want)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("applyPatch() fields = %v, want %v", fields, tt.wantFields)
+			}
+			if !reflect.DeepEqual(errs, tt.wantErrs) {
+				t.Errorf("applyPatch() errs = %v, want %v", errs, tt.wantErrs)
+			}
+		})
+	}
+}
+
+func Test_validateAssetPatch(t *testing.T) {
+	old := Asset{Name: "A", Base: "room", Weight: 1}
+	as := old
+	as.Name, as.Base, as.Status, as.Weight, as.PurchaseValue = "B", "", STATUS_RETIRED, -1, 10
+
+	errs := validateAssetPatch(old, as)
+	sortFieldErrors(errs)
+	got := []string{}
+	for _, e := range errs {
+		got = append(got, e.Field)
+	}
+	if want := []string{"base", "name", "status", "weight"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("validateAssetPatch() = %v, want %v", got, want)
+	}
+	if errs := validateAssetPatch(old, old); len(errs) != 0 {
+		t.Errorf("validateAssetPatch() = %v, want none", errs)
+	}
+}
+
+func Test_validateSpacePatch(t *testing.T) {
+	old := Space{Name: "room", Base: "floor", Width: 4, Height: 3}
+	tests := []struct {
+		name   string
+		sp     Space
+		fields []string
+		want   []string
+	}{
+		{"fine", Space{Name: "room", Base: "floor", Rx: 1, Width: 5, Height: 3}, []string{"rx", "width"}, nil},
+		{"renamed, too slow", Space{Name: "hall", Base: "floor", Width: 4, Height: 3, SpeedFactor: -1},
+			[]string{"name", "speedFactor"}, []string{"name", "speedFactor"}},
+		{"outline with width", Space{Name: "room", Base: "floor", Width: 4, Height: 3,
+			Outline: []dataio.Point{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 0, Y: 1}}}, []string{"outline"}, []string{"outline"}},
+		{"negative scale", Space{Name: "room", Base: "floor", Width: 4, Height: 3, Scale: -1},
+			[]string{"rx", "scale"}, []string{"scale"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, e := range validateSpacePatch(old, tt.sp, tt.fields) {
+				got = append(got, e.Field)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateSpacePatch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_toSet(t *testing.T) {
+	as := Asset{Name: "A", Base: "room", Rx: 3, PurchaseValue: 100, Attrs: map[string]string{"os": "linux"}}
+	got, err := toSet(as, []string{"attrs", "purchaseValue", "rx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bson.M{"attrs": bson.M{"os": "linux"}, "purchasevalue": 100.0, "rx": 3.0}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("toSet() = %v, want %v", got, want)
+	}
+}
+
+func Test_assetReference_moveUpdate(t *testing.T) {
+	filter, update, arrayFilters := assetReference{"session", "stops"}.moveUpdate("A", "old", "new")
+	if want := (bson.M{"stops": bson.M{"$elemMatch": bson.M{"name": "A", "base": "old"}}}); !reflect.DeepEqual(filter, want) {
+		t.Errorf("moveUpdate() filter = %v, want %v", filter, want)
+	}
+	if want := (bson.M{"$set": bson.M{"stops.$[e].base": "new"}, "$inc": bson.M{"version": 1}}); !reflect.DeepEqual(update, want) {
+		t.Errorf("moveUpdate() update = %v, want %v", update, want)
+	}
+	if want := []interface{}{bson.M{"e.name": "A", "e.base": "old"}}; !reflect.DeepEqual(arrayFilters, want) {
+		t.Errorf("moveUpdate() arrayFilters = %v, want %v", arrayFilters, want)
+	}
+}
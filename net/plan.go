@@ -0,0 +1,377 @@
+// Recurring inspection plans and the scheduler generating their sessions
+
+package net
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+MongoDB collection structure:
+readygo(DB): {
+	InspectionPlan(Collection): {
+		id: "",
+		space: "",
+		assignee: "",
+		recurrence: "",
+		samplerate: 0,
+		initx: 0,
+		inity: 0,
+		boost: 0,
+		excludedays: 0,
+		duehours: 0,
+		nextrun: ISODate(),
+		lastrun: ISODate(),
+		lastsession: ""
+	}
+}*/
+
+// InspectionPlan generates a Session in the space on every recurrence
+type InspectionPlan struct {
+	ID          string    `json:"id" description:"unique id of the plan"`
+	Space       string    `json:"space" description:"the root space to plan the routes in"`
+	Assignee    string    `json:"assignee" description:"the inspector of the generated sessions"`
+	Recurrence  string    `json:"recurrence" description:"cron-like minute hour day-of-month month day-of-week, or @daily, @weekly, @monthly" default:"@monthly"`
+	SampleRate  float64   `json:"sampleRate" description:"the sampling rate like GET /route/space"`
+	InitX       float64   `json:"initX" description:"the initial point's relative x position"`
+	InitY       float64   `json:"initY" description:"the initial point's relative y position"`
+	Boost       float64   `json:"boost" description:"the extra weight ratio per day since an asset's last inspection"`
+	ExcludeDays float64   `json:"excludeDays" description:"exclude the assets inspected within these days"`
+	DueHours    float64   `json:"dueHours" description:"hours to finish a generated session before it is overdue, 0 for no limit"`
+	Statuses    string    `json:"statuses" description:"the comma-separated lifecycle statuses of the assets to sample" default:"active"`
+	NextRun     time.Time `json:"nextRun" description:"when the next session falls due, computed by the server"`
+	LastRun     time.Time `json:"lastRun" description:"when the last session was generated"`
+	LastSession string    `json:"lastSession" description:"the id of the last session generated"`
+}
+
+// Clock tells the current time, replaceable for testing the scheduler
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// Scheduler generates the Sessions of the plans falling due, and marks the overdue ones
+type Scheduler struct {
+	Ctx      *RestContext
+	Clock    Clock
+	Interval time.Duration // how often to check the plans
+}
+
+// validate checks the plan is well-formed
+func (p InspectionPlan) validate() error {
+	switch {
+	case p.ID == "":
+		return errors.New("plan id cannot be empty")
+	case p.Space == "":
+		return errors.New("plan space cannot be empty")
+	case p.Assignee == "":
+		return errors.New("plan assignee cannot be empty")
+	case p.SampleRate <= 0 || p.SampleRate > 1:
+		return errors.New("sampling rate out of range")
+	case p.Boost < 0 || p.ExcludeDays < 0 || p.DueHours < 0:
+		return errors.New("boost ratio, days to exclude and due hours cannot be negative")
+	}
+	if _, err := parseStatuses(p.Statuses); err != nil {
+		return err
+	}
+	sched, err := parseCron(p.Recurrence)
+	if err != nil {
+		return err
+	}
+	if sched.next(time.Now()).IsZero() {
+		return errors.New("the recurrence never falls due")
+	}
+	return nil
+}
+
+// schedule sets the next run to the first recurrence after now
+func (p *InspectionPlan) schedule(now time.Time) error {
+	sched, err := parseCron(p.Recurrence)
+	if err != nil {
+		return err
+	}
+	p.NextRun = sched.next(now)
+	return nil
+}
+
+// due tests whether the plan should generate a Session now
+func (p InspectionPlan) due(now time.Time) bool {
+	return !p.NextRun.IsZero() && !p.NextRun.After(now)
+}
+
+// overdueFilter matches the Sessions not done by their due time
+func overdueFilter(now time.Time) bson.M {
+	return bson.M{
+		"done":    false,
+		"overdue": bson.M{"$ne": true},
+		"due":     bson.M{"$gt": time.Time{}, "$lte": now}}
+}
+
+// NewScheduler creates the Scheduler checking the plans every minute by the system clock
+func NewScheduler(r *RestContext) *Scheduler {
+	return &Scheduler{Ctx: r, Clock: systemClock{}, Interval: time.Minute}
+}
+
+// Run checks the plans every interval until stopped
+func (s *Scheduler) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.tick()
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// duePlans picks the plans falling due by the clock
+func (s *Scheduler) duePlans(plans []InspectionPlan) (list []InspectionPlan) {
+	now := s.Clock.Now()
+	for _, p := range plans {
+		if p.due(now) {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
+// tick generates the Sessions of the plans falling due, once for all the missed recurrences,
+// then marks the overdue Sessions
+func (s *Scheduler) tick() {
+	plans, _, err := s.Ctx.dbGetPlans()
+	if err != nil {
+		log.Printf("failed to load the plans, %v\n", err)
+		return
+	}
+
+	for _, p := range s.duePlans(plans) {
+		now := s.Clock.Now()
+		// moves on even if the planning fails, not to retry on every tick; the next run is saved
+		// first, or another tick would generate the same Session again
+		p.schedule(now)
+		if _, err := s.Ctx.dbUpsertPlan(p); err != nil {
+			log.Printf("plan %v failed to save the next run, %v\n", p.ID, err)
+			continue
+		}
+		if _, _, err := s.Ctx.runPlan(&p, now); err != nil {
+			log.Printf("plan %v failed to generate the session, %v\n", p.ID, err)
+			continue
+		}
+		if _, err := s.Ctx.dbUpsertPlan(p); err != nil {
+			log.Printf("plan %v failed to save the last run, %v\n", p.ID, err)
+		}
+	}
+
+	if _, err := s.Ctx.dbMarkOverdue(s.Clock.Now()); err != nil {
+		log.Println(err)
+	}
+}
+
+// runPlan plans a route by the plan's settings, deferring the rooms booked now,
+// and stores it as a new Session
+func (r RestContext) runPlan(p *InspectionPlan, now time.Time) (s *Session, errCode int, err error) {
+	initPoint := Asset{Name: "Initial Point", Base: p.Space, Rx: p.InitX, Ry: p.InitY}
+	policy := samplePolicy{Now: now, BoostPerDay: p.Boost, ExcludeDays: p.ExcludeDays}
+	if policy.Statuses, err = parseStatuses(p.Statuses); err != nil {
+		return nil, http.StatusNotAcceptable, err
+	}
+	deferred, errCode, err := r.deferBookedSpaces(p.Space, now, now.Add(DEFAULT_VISIT_MINUTES*time.Minute), &policy)
+	if err != nil {
+		return nil, errCode, err
+	}
+
+	finalRoutePtr, errCode, err := r.calcRoute(initPoint, p.SampleRate, policy)
+	if err != nil {
+		return nil, errCode, err
+	}
+
+	newS := newSession(p.Space, p.Assignee, *finalRoutePtr, now)
+	newS.PlanID, newS.Deferred = p.ID, deferred
+	if p.DueHours > 0 {
+		newS.Due = now.Add(time.Duration(p.DueHours * float64(time.Hour)))
+	}
+	if errCode, err = r.dbInsertSession(newS); err != nil {
+		return nil, errCode, err
+	}
+
+	p.LastRun, p.LastSession = now, newS.ID
+	return &newS, http.StatusCreated, nil
+}
+
+// dbGetPlans finds all the plans, ordered by id
+func (r RestContext) dbGetPlans() (list []InspectionPlan, errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+
+	cur, err := r.mongoDB.Collection("plan").Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{"id", 1}}))
+	if err != nil {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, err
+	}
+	defer cur.Close(ctx)
+
+	list = []InspectionPlan{}
+	for cur.Next(ctx) {
+		var p InspectionPlan
+		if err = cur.Decode(&p); err != nil {
+			log.Println(err)
+			return nil, http.StatusInternalServerError, err
+		}
+		list = append(list, p)
+	}
+	return list, http.StatusOK, nil
+}
+
+// dbGetPlan finds the plan by id
+func (r RestContext) dbGetPlan(id string) (result *InspectionPlan, errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+
+	result = new(InspectionPlan)
+	if err = r.mongoDB.Collection("plan").FindOne(ctx, bson.M{"id": id}).Decode(result); err != nil {
+		log.Println(err)
+		return nil, http.StatusNotFound, err
+	}
+	return result, http.StatusOK, nil
+}
+
+// dbUpsertPlan creates the plan or replaces the one with the same id
+func (r RestContext) dbUpsertPlan(p InspectionPlan) (errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+
+	if _, err = r.mongoDB.Collection("plan").ReplaceOne(ctx, bson.M{"id": p.ID}, p,
+		options.Replace().SetUpsert(true)); err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// dbDeletePlan deletes the plan by id, keeping the Sessions it generated
+func (r RestContext) dbDeletePlan(id string) (errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+
+	deleteResult, err := r.mongoDB.Collection("plan").DeleteOne(ctx, bson.M{"id": id})
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, err
+	}
+	if deleteResult.DeletedCount == 0 {
+		return http.StatusNotFound, errors.New("the plan specified does not exist")
+	}
+	return http.StatusOK, nil
+}
+
+// dbMarkOverdue marks the Sessions not done by their due time
+func (r RestContext) dbMarkOverdue(now time.Time) (count int64, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cf()
+
+	updateResult, err := r.mongoDB.Collection("session").UpdateMany(ctx, overdueFilter(now),
+		bson.M{"$set": bson.M{"overdue": true}, "$inc": bson.M{"version": 1}})
+	if err != nil {
+		return 0, err
+	}
+	return updateResult.ModifiedCount, nil
+}
+
+// GET PREFIX/plans
+func (r RestContext) findPlans(req *restful.Request, resp *restful.Response) {
+	list, errCode, err := r.dbGetPlans()
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, list)
+}
+
+// GET PREFIX/plans/{plan-id}
+func (r RestContext) findPlan(req *restful.Request, resp *restful.Response) {
+	resultPtr, errCode, err := r.dbGetPlan(req.PathParameter("plan-id"))
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, *resultPtr)
+}
+
+// PUT PREFIX/plans/{plan-id}
+// InspectionPlan: {id: "floor-1", space: "base", assignee: "mio", recurrence: "0 9 1 * *", sampleRate: 0.3}
+func (r RestContext) putPlan(req *restful.Request, resp *restful.Response) {
+	var p InspectionPlan
+	if err := req.ReadEntity(&p); err != nil {
+		resp.WriteError(http.StatusNotAcceptable, err)
+		return
+	}
+	if p.ID != req.PathParameter("plan-id") {
+		resp.WriteError(http.StatusNotAcceptable, errors.New(
+			"the plan's id provided is in content conflict with the URL"))
+		return
+	}
+	if err := p.validate(); err != nil {
+		resp.WriteError(http.StatusNotAcceptable, err)
+		return
+	}
+	if _, errCode, err := r.dbGetSpace(p.Space, true); err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+
+	// the run history is kept by the server
+	p.LastRun, p.LastSession = time.Time{}, ""
+	if old, _, err := r.dbGetPlan(p.ID); err == nil {
+		p.LastRun, p.LastSession = old.LastRun, old.LastSession
+	}
+	p.schedule(time.Now())
+
+	if errCode, err := r.dbUpsertPlan(p); err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, p)
+}
+
+// DELETE PREFIX/plans/{plan-id}
+func (r RestContext) deletePlan(req *restful.Request, resp *restful.Response) {
+	if errCode, err := r.dbDeletePlan(req.PathParameter("plan-id")); err != nil {
+		resp.WriteError(errCode, err)
+	} else {
+		resp.WriteHeader(http.StatusOK)
+	}
+}
+
+// POST PREFIX/plans/{plan-id}/run
+func (r RestContext) runPlanNow(req *restful.Request, resp *restful.Response) {
+	p, errCode, err := r.dbGetPlan(req.PathParameter("plan-id"))
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+
+	s, errCode, err := r.runPlan(p, time.Now()) // out of the recurrence, the next run is kept
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	if errCode, err := r.dbUpsertPlan(*p); err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusCreated, *s)
+}
@@ -0,0 +1,85 @@
+package net
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func TestScheduler_duePlans(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2019, 7, 1, 8, 0, 0, 0, time.UTC)}
+	s := &Scheduler{Clock: clock, Interval: time.Minute}
+
+	plans := []InspectionPlan{
+		InspectionPlan{ID: "daily", Recurrence: "0 9 * * *"},
+		InspectionPlan{ID: "monthly", Recurrence: "@monthly"},
+		InspectionPlan{ID: "unscheduled"}}
+	for i := range plans[:2] {
+		if err := plans[i].schedule(clock.now); err != nil {
+			t.Fatalf("InspectionPlan.schedule() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		now     time.Time
+		wantIDs []string
+	}{
+		{"none due", time.Date(2019, 7, 1, 8, 59, 0, 0, time.UTC), []string{}},
+		{"daily due", time.Date(2019, 7, 1, 9, 0, 0, 0, time.UTC), []string{"daily"}},
+		{"both due", time.Date(2019, 8, 3, 0, 0, 0, 0, time.UTC), []string{"daily", "monthly"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.now = tt.now
+			got := s.duePlans(plans)
+			if len(got) != len(tt.wantIDs) {
+				t.Fatalf("Scheduler.duePlans() = %v, want %v", got, tt.wantIDs)
+			}
+			for i, p := range got {
+				if p.ID != tt.wantIDs[i] {
+					t.Errorf("Scheduler.duePlans() %v = %v, want %v", i, p.ID, tt.wantIDs[i])
+				}
+			}
+		})
+	}
+
+	// missed recurrences are caught up once, then it moves on
+	daily := plans[0]
+	daily.schedule(clock.now)
+	if want := time.Date(2019, 8, 3, 9, 0, 0, 0, time.UTC); !daily.NextRun.Equal(want) {
+		t.Errorf("InspectionPlan.schedule() next run = %v, want %v", daily.NextRun, want)
+	}
+}
+
+func TestInspectionPlan_validate(t *testing.T) {
+	valid := InspectionPlan{ID: "floor-1", Space: "base", Assignee: "mio", Recurrence: "0 9 1 * *", SampleRate: 0.3}
+	tests := []struct {
+		name    string
+		modify  func(p *InspectionPlan)
+		wantErr bool
+	}{
+		{"valid", func(p *InspectionPlan) {}, false},
+		{"no assignee", func(p *InspectionPlan) { p.Assignee = "" }, true},
+		{"bad rate", func(p *InspectionPlan) { p.SampleRate = 1.5 }, true},
+		{"bad recurrence", func(p *InspectionPlan) { p.Recurrence = "monthly" }, true},
+		{"never due", func(p *InspectionPlan) { p.Recurrence = "0 0 31 2 *" }, true},
+		{"negative due hours", func(p *InspectionPlan) { p.DueHours = -1 }, true},
+		{"statuses", func(p *InspectionPlan) { p.Statuses = "active,loaned-out" }, false},
+		{"unknown status", func(p *InspectionPlan) { p.Statuses = "lost" }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid
+			tt.modify(&p)
+			if err := p.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("InspectionPlan.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
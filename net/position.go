@@ -0,0 +1,219 @@
+// Absolute positions of the Assets and the Spaces, resolved through all their ancestors
+
+package net
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/emicklei/go-restful"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Position is where an Asset or a Space actually is, in the absolute coordinates
+type Position struct {
+	Name     string   `json:"name" description:"name of the asset or the space"`
+	Base     string   `json:"base" description:"the base space it lies in"`
+	IsSpace  bool     `json:"isSpace" description:"whether it is a space, positioned by its door"`
+	X        float64  `json:"x" description:"absolute x, through the offsets, rotations and scales of all the ancestors"`
+	Y        float64  `json:"y" description:"absolute y"`
+	Rotation float64  `json:"rotation" description:"absolute counter-clockwise degrees of the axes of the space, or of the asset's base"`
+	Scale    float64  `json:"scale" description:"absolute units per unit of the space, or of the asset's base"`
+	Path     []string `json:"path" description:"the ancestor spaces from the top down to its base"`
+}
+
+// Rotation is the counter-clockwise degrees the transform turns the axes
+func (t Transform) Rotation() float64 {
+	return math.Atan2(t.C, t.A) * 180 / math.Pi
+}
+
+// positionResolver resolves the positions in the tree of the spaces, remembering the frames
+type positionResolver struct {
+	spaces map[string]Space
+	frames map[string]Transform
+}
+
+func newPositionResolver(spaceList []Space) *positionResolver {
+	p := &positionResolver{
+		spaces: make(map[string]Space, len(spaceList)),
+		frames: make(map[string]Transform, len(spaceList))}
+	for _, sp := range spaceList {
+		p.spaces[sp.Name] = sp
+	}
+	return p
+}
+
+// frame maps the coordinates in the space to the absolute ones
+func (p *positionResolver) frame(name string) (Transform, error) {
+	if t, ok := p.frames[name]; ok {
+		return t, nil
+	}
+	t, err := frameOf(name, "", p.spaces)
+	if err != nil {
+		return t, err
+	}
+	p.frames[name] = t
+	return t, nil
+}
+
+// path lists the space and its ancestors from the top down
+func (p *positionResolver) path(name string) []string {
+	path := []string{}
+	for cur := name; cur != ""; cur = p.spaces[cur].Base {
+		if _, ok := p.spaces[cur]; !ok || len(path) > len(p.spaces) { // above the top, or a cycle
+			break
+		}
+		path = append([]string{cur}, path...)
+	}
+	return path
+}
+
+// position resolves the point in the base space
+func (p *positionResolver) position(name string, base string, x float64, y float64, isSpace bool) (Position, error) {
+	t, err := p.frame(base)
+	if err != nil {
+		return Position{}, err
+	}
+	pos := Position{Name: name, Base: base, IsSpace: isSpace, Path: p.path(base)}
+	pos.X, pos.Y = t.Apply(x, y)
+	if isSpace { // the axes of the space itself
+		t = localTransform(p.spaces[name]).Then(t)
+	}
+	pos.Rotation, pos.Scale = t.Rotation(), t.Scale()
+	return pos, nil
+}
+
+// spacePosition resolves the door of the Space; the top space is at its own offset
+func (p *positionResolver) spacePosition(sp Space) (Position, error) {
+	if _, ok := p.spaces[sp.Base]; !ok { // the top space
+		t := localTransform(sp)
+		return Position{Name: sp.Name, Base: sp.Base, IsSpace: true, X: sp.Rx, Y: sp.Ry,
+			Rotation: t.Rotation(), Scale: t.Scale(), Path: []string{}}, nil
+	}
+	return p.position(sp.Name, sp.Base, sp.Rx, sp.Ry, true)
+}
+
+// assetPosition resolves the Asset in its base space
+func (p *positionResolver) assetPosition(as Asset) (Position, error) {
+	return p.position(as.Name, as.Base, as.Rx, as.Ry, false)
+}
+
+// dbGetAncestors finds the Space and its ancestors, from itself up to the top
+func (r RestContext) dbGetAncestors(name string) (list []Space, errCode int, err error) {
+	visited := make(map[string]bool)
+	for cur := name; cur != ""; {
+		if visited[cur] {
+			return nil, http.StatusConflict, errors.New("the space " + cur + " lies in itself")
+		}
+		visited[cur] = true
+
+		sp, errCode, err := r.dbGetSpace(cur, true)
+		if err != nil {
+			if cur != name { // the base of the top space, like "base"
+				break
+			}
+			return nil, errCode, err
+		}
+		list = append(list, *sp)
+		cur = sp.Base
+	}
+	return list, http.StatusOK, nil
+}
+
+// GET PREFIX/spaces/{space-name}/assets/{asset-name}/position
+func (r RestContext) findAssetPosition(req *restful.Request, resp *restful.Response) {
+	as, errCode, err := r.dbGetAsset(req.PathParameter("asset-name"), req.PathParameter("space-name"), true)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	ancestors, errCode, err := r.dbGetAncestors(as.Base)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+
+	pos, err := newPositionResolver(ancestors).assetPosition(*as)
+	if err != nil {
+		resp.WriteError(http.StatusConflict, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, pos)
+}
+
+// GET PREFIX/spaces/{space-name}/position
+func (r RestContext) findSpacePosition(req *restful.Request, resp *restful.Response) {
+	ancestors, errCode, err := r.dbGetAncestors(req.PathParameter("space-name"))
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+
+	pos, err := newPositionResolver(ancestors).spacePosition(ancestors[0])
+	if err != nil {
+		resp.WriteError(http.StatusConflict, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, pos)
+}
+
+// GET PREFIX/spaces/{space-name}/positions?spaces=true&assets=true
+func (r RestContext) findSubtreePositions(req *restful.Request, resp *restful.Response) {
+	withSpaces, withAssets := true, true
+	for param, flag := range map[string]*bool{"spaces": &withSpaces, "assets": &withAssets} {
+		if v := req.QueryParameter(param); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				resp.WriteError(http.StatusNotAcceptable, errors.New(param+" should be true or false"))
+				return
+			}
+			*flag = b
+		}
+	}
+
+	ancestors, errCode, err := r.dbGetAncestors(req.PathParameter("space-name"))
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	subtree, errCode, err := r.dbGetSubtreeSpaces(ancestors[0].Name, true)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	p := newPositionResolver(append(ancestors[1:], subtree...))
+
+	list := []Position{}
+	if withSpaces {
+		for _, sp := range subtree {
+			pos, err := p.spacePosition(sp)
+			if err != nil {
+				resp.WriteError(http.StatusConflict, err)
+				return
+			}
+			list = append(list, pos)
+		}
+	}
+	if withAssets {
+		baseNames := make([]string, 0, len(subtree))
+		for _, sp := range subtree {
+			baseNames = append(baseNames, sp.Name)
+		}
+		assetList, errCode, err := r.dbFindAssets(bson.M{"base": bson.M{"$in": baseNames}})
+		if err != nil {
+			resp.WriteError(errCode, err)
+			return
+		}
+		for _, as := range assetList {
+			pos, err := p.assetPosition(as)
+			if err != nil {
+				resp.WriteError(http.StatusConflict, err)
+				return
+			}
+			list = append(list, pos)
+		}
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, list)
+}
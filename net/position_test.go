@@ -0,0 +1,52 @@
+package net
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func Test_positionResolver(t *testing.T) {
+	p := newPositionResolver([]Space{
+		{Name: "building", Base: "base", Rx: 100, Ry: 0},
+		{Name: "floor", Base: "building", Rx: 10, Ry: 10, Rotation: 90},
+		{Name: "room", Base: "floor", Rx: 5, Ry: 0, Scale: 0.01},
+	})
+	round := func(pos Position) Position {
+		pos.X, pos.Y = math.Round(pos.X*1e9)/1e9, math.Round(pos.Y*1e9)/1e9
+		pos.Rotation, pos.Scale = math.Round(pos.Rotation*1e9)/1e9, math.Round(pos.Scale*1e9)/1e9
+		return pos
+	}
+
+	tests := []struct {
+		name string
+		got  func() (Position, error)
+		want Position
+	}{
+		{"top space", func() (Position, error) { return p.spacePosition(p.spaces["building"]) },
+			Position{Name: "building", Base: "base", IsSpace: true, X: 100, Y: 0, Rotation: 0, Scale: 1, Path: []string{}}},
+		{"rotated space", func() (Position, error) { return p.spacePosition(p.spaces["room"]) },
+			// (5, 0) on the floor is (0, 5) turned, then (110, 15)
+			Position{Name: "room", Base: "floor", IsSpace: true, X: 110, Y: 15, Rotation: 90, Scale: 0.01,
+				Path: []string{"building", "floor"}}},
+		{"asset in centimetres", func() (Position, error) { return p.assetPosition(Asset{Name: "A", Base: "room", Rx: 200, Ry: 0}) },
+			// (2, 0) in the room, (7, 0) on the floor, (110, 17) absolute
+			Position{Name: "A", Base: "room", X: 110, Y: 17, Rotation: 90, Scale: 0.01,
+				Path: []string{"building", "floor", "room"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.got()
+			if err != nil {
+				t.Fatalf("positionResolver error = %v", err)
+			}
+			if got = round(got); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("positionResolver = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := p.assetPosition(Asset{Name: "B", Base: "attic"}); err == nil {
+		t.Errorf("positionResolver.assetPosition() out of the tree should fail")
+	}
+}
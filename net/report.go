@@ -0,0 +1,287 @@
+// Discrepancy reports summarising the inspection results in a space tree
+
+package net
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Tally counts the inspection results
+type Tally struct {
+	Found   int `json:"found" description:"the number of assets found"`
+	Missing int `json:"missing" description:"the number of assets missing"`
+	Damaged int `json:"damaged" description:"the number of assets damaged"`
+}
+
+// SpaceTally is the results in a Space, and in its whole sub-tree
+type SpaceTally struct {
+	Space    string `json:"space" description:"the space's name"`
+	Base     string `json:"base" description:"the parent space's name"`
+	Direct   Tally  `json:"direct" description:"results of the assets directly in the space"`
+	Subtotal Tally  `json:"subtotal" description:"results rolled up from the space and all its subspaces"`
+}
+
+// PeriodTally is the results in the whole tree in a period
+type PeriodTally struct {
+	Period string `json:"period" description:"like 2019-07-01 by day, 2019-W27 by week or 2019-07 by month"`
+	Tally  Tally  `json:"tally" description:"results in the period"`
+}
+
+// RepeatOffender is an Asset found missing or damaged repeatedly
+type RepeatOffender struct {
+	Name    string `json:"name" description:"the asset's name"`
+	Base    string `json:"base" description:"the asset's base space"`
+	Missing int    `json:"missing" description:"times found missing"`
+	Damaged int    `json:"damaged" description:"times found damaged"`
+}
+
+// DiscrepancyReport summarises the inspection results under a space
+type DiscrepancyReport struct {
+	Space           string           `json:"space" description:"the root space's name"`
+	From            time.Time        `json:"from" description:"the start of the reporting range"`
+	To              time.Time        `json:"to" description:"the end of the reporting range"`
+	Spaces          []SpaceTally     `json:"spaces" description:"results by space, in BFS order from the root"`
+	Trend           []PeriodTally    `json:"trend" description:"results by period, in time order"`
+	RepeatOffenders []RepeatOffender `json:"repeatOffenders" description:"assets missing or damaged repeatedly"`
+}
+
+// add counts the result into the tally
+func (t *Tally) add(status string) {
+	switch status {
+	case STOP_FOUND:
+		t.Found++
+	case STOP_MISSING:
+		t.Missing++
+	case STOP_DAMAGED:
+		t.Damaged++
+	}
+}
+
+// periodKey names the period of the time: day, week or month
+func periodKey(t time.Time, period string) (string, error) {
+	switch period {
+	case "day":
+		return t.Format("2006-01-02"), nil
+	case "week":
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week), nil
+	case "month":
+		return t.Format("2006-01"), nil
+	}
+	return "", errors.New("period should be one of day, week and month")
+}
+
+// buildReport tallies the inspection records over the space tree in BFS order,
+// by period, and finds the Assets missing or damaged at least repeat times
+func buildReport(spaceList []Space, records []Inspection, period string, repeat int) (report DiscrepancyReport, err error) {
+	if _, err = periodKey(time.Time{}, period); err != nil {
+		return report, err
+	}
+	report.Spaces = make([]SpaceTally, len(spaceList))
+	spaceIndex := make(map[string]int)
+	for i, sp := range spaceList {
+		report.Spaces[i] = SpaceTally{Space: sp.Name, Base: sp.Base}
+		spaceIndex[sp.Name] = i
+	}
+
+	trend := make(map[string]*Tally)
+	offenders := make(map[AssetKey]*RepeatOffender)
+	for _, record := range records {
+		i, ok := spaceIndex[record.Base]
+		if !ok {
+			continue
+		}
+		report.Spaces[i].Direct.add(record.Status)
+
+		k, _ := periodKey(record.Time, period) // the period checked above
+		if _, ok := trend[k]; !ok {
+			trend[k] = &Tally{}
+		}
+		trend[k].add(record.Status)
+
+		if record.Status == STOP_MISSING || record.Status == STOP_DAMAGED {
+			key := AssetKey{Name: record.Name, Base: record.Base}
+			if _, ok := offenders[key]; !ok {
+				offenders[key] = &RepeatOffender{Name: record.Name, Base: record.Base}
+			}
+			if record.Status == STOP_MISSING {
+				offenders[key].Missing++
+			} else {
+				offenders[key].Damaged++
+			}
+		}
+	}
+
+	// roll up the sub-totals bottom to up, the reverse of BFS order
+	for i := len(report.Spaces) - 1; i >= 0; i-- {
+		st := &report.Spaces[i]
+		st.Subtotal.Found += st.Direct.Found
+		st.Subtotal.Missing += st.Direct.Missing
+		st.Subtotal.Damaged += st.Direct.Damaged
+		if j, ok := spaceIndex[st.Base]; ok && i > 0 {
+			report.Spaces[j].Subtotal.Found += st.Subtotal.Found
+			report.Spaces[j].Subtotal.Missing += st.Subtotal.Missing
+			report.Spaces[j].Subtotal.Damaged += st.Subtotal.Damaged
+		}
+	}
+
+	report.Trend = make([]PeriodTally, 0, len(trend))
+	for k, t := range trend {
+		report.Trend = append(report.Trend, PeriodTally{Period: k, Tally: *t})
+	}
+	sort.Slice(report.Trend, func(i, j int) bool {
+		return report.Trend[i].Period < report.Trend[j].Period
+	})
+
+	report.RepeatOffenders = []RepeatOffender{}
+	for _, o := range offenders {
+		if o.Missing+o.Damaged >= repeat {
+			report.RepeatOffenders = append(report.RepeatOffenders, *o)
+		}
+	}
+	sort.Slice(report.RepeatOffenders, func(i, j int) bool {
+		oi, oj := report.RepeatOffenders[i], report.RepeatOffenders[j]
+		if oi.Missing+oi.Damaged != oj.Missing+oj.Damaged {
+			return oi.Missing+oi.Damaged > oj.Missing+oj.Damaged
+		}
+		return oi.Name+"@"+oi.Base < oj.Name+"@"+oj.Base
+	})
+
+	return report, nil
+}
+
+// dbGetResults finds the inspection results recorded in sessions of the bases in the range
+func (r RestContext) dbGetResults(baseNames []string, from time.Time, to time.Time) (list []Inspection, errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cf()
+
+	cur, err := r.mongoDB.Collection("inspection").Find(ctx, bson.M{
+		"base":   bson.M{"$in": baseNames},
+		"status": bson.M{"$in": []string{STOP_FOUND, STOP_MISSING, STOP_DAMAGED}},
+		"time":   bson.M{"$gte": from, "$lt": to}})
+	if err != nil {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, err
+	}
+	defer cur.Close(ctx)
+
+	list = []Inspection{}
+	for cur.Next(ctx) {
+		var record Inspection
+		if err = cur.Decode(&record); err != nil {
+			log.Println(err)
+			return nil, http.StatusInternalServerError, err
+		}
+		list = append(list, record)
+	}
+	return list, http.StatusOK, nil
+}
+
+// writeReportCsv writes one section of the report as CSV: spaces, trend or offenders
+func writeReportCsv(w *csv.Writer, report DiscrepancyReport, section string) error {
+	itoa := strconv.Itoa
+	switch section {
+	case "", "spaces":
+		w.Write([]string{"space", "base", "found", "missing", "damaged",
+			"subtotal found", "subtotal missing", "subtotal damaged"})
+		for _, st := range report.Spaces {
+			w.Write([]string{st.Space, st.Base,
+				itoa(st.Direct.Found), itoa(st.Direct.Missing), itoa(st.Direct.Damaged),
+				itoa(st.Subtotal.Found), itoa(st.Subtotal.Missing), itoa(st.Subtotal.Damaged)})
+		}
+	case "trend":
+		w.Write([]string{"period", "found", "missing", "damaged"})
+		for _, pt := range report.Trend {
+			w.Write([]string{pt.Period, itoa(pt.Tally.Found), itoa(pt.Tally.Missing), itoa(pt.Tally.Damaged)})
+		}
+	case "offenders":
+		w.Write([]string{"name", "base", "missing", "damaged"})
+		for _, o := range report.RepeatOffenders {
+			w.Write([]string{o.Name, o.Base, itoa(o.Missing), itoa(o.Damaged)})
+		}
+	default:
+		return errors.New("section should be one of spaces, trend and offenders")
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// GET PREFIX/reports/space/{space-name}?from=RFC3339&to=RFC3339&period=month&repeat=2&format=csv&section=spaces
+func (r RestContext) findReport(req *restful.Request, resp *restful.Response) {
+	spaceName := req.PathParameter("space-name")
+	qr := req.Request.URL.Query()
+
+	to := time.Now()
+	from := to.AddDate(0, -6, 0) // half a year by default
+	var err error
+	if qr.Get("from") != "" {
+		if from, err = time.Parse(time.RFC3339, qr.Get("from")); err != nil {
+			resp.WriteError(http.StatusNotAcceptable, errors.New("invalid start time"))
+			return
+		}
+	}
+	if qr.Get("to") != "" {
+		if to, err = time.Parse(time.RFC3339, qr.Get("to")); err != nil {
+			resp.WriteError(http.StatusNotAcceptable, errors.New("invalid end time"))
+			return
+		}
+	}
+	period := qr.Get("period")
+	if period == "" {
+		period = "month"
+	}
+	if _, err = periodKey(to, period); err != nil { // checked before querying, even if nothing is recorded
+		resp.WriteError(http.StatusNotAcceptable, err)
+		return
+	}
+	repeat := 2
+	if qr.Get("repeat") != "" {
+		if repeat, err = strconv.Atoi(qr.Get("repeat")); err != nil || repeat < 1 {
+			resp.WriteError(http.StatusNotAcceptable, errors.New("repeat should be a positive integer"))
+			return
+		}
+	}
+
+	spaceList, errCode, err := r.dbGetSubtreeSpaces(spaceName, true)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	baseNames := make([]string, 0, len(spaceList))
+	for _, sp := range spaceList {
+		baseNames = append(baseNames, sp.Name)
+	}
+	records, errCode, err := r.dbGetResults(baseNames, from, to)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+
+	report, err := buildReport(spaceList, records, period, repeat)
+	if err != nil {
+		resp.WriteError(http.StatusNotAcceptable, err)
+		return
+	}
+	report.Space, report.From, report.To = spaceName, from, to
+
+	if qr.Get("format") == "csv" {
+		resp.AddHeader("Content-Type", "text/csv")
+		resp.AddHeader("Content-Disposition", "attachment; filename=\"report-"+spaceName+".csv\"")
+		if err := writeReportCsv(csv.NewWriter(resp), report, qr.Get("section")); err != nil {
+			resp.WriteError(http.StatusNotAcceptable, err)
+		}
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, report)
+}
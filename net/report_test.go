@@ -0,0 +1,79 @@
+package net
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_periodKey(t *testing.T) {
+	day := time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		period  string
+		want    string
+		wantErr bool
+	}{
+		{"day", "2019-07-01", false},
+		{"week", "2019-W27", false},
+		{"month", "2019-07", false},
+		{"year", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.period, func(t *testing.T) {
+			got, err := periodKey(day, tt.period)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("periodKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("periodKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_buildReport(t *testing.T) {
+	spaceList := []Space{
+		Space{Name: "base"},
+		Space{Name: "Meeting Room", Base: "base"},
+		Space{Name: "Closet", Base: "Meeting Room"}}
+	july := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	august := time.Date(2019, 8, 1, 0, 0, 0, 0, time.UTC)
+	records := []Inspection{
+		Inspection{Name: "A", Base: "base", Time: july, Status: STOP_FOUND},
+		Inspection{Name: "D", Base: "Meeting Room", Time: july, Status: STOP_MISSING},
+		Inspection{Name: "E", Base: "Closet", Time: july, Status: STOP_DAMAGED},
+		Inspection{Name: "E", Base: "Closet", Time: august, Status: STOP_MISSING},
+		Inspection{Name: "D", Base: "Meeting Room", Time: august, Status: STOP_FOUND},
+		Inspection{Name: "X", Base: "elsewhere", Time: august, Status: STOP_MISSING}}
+
+	if _, err := buildReport(spaceList, nil, "year", 2); err == nil {
+		t.Errorf("buildReport() accepts the period year without records")
+	}
+
+	report, err := buildReport(spaceList, records, "month", 2)
+	if err != nil {
+		t.Fatalf("buildReport() error = %v", err)
+	}
+
+	wantSpaces := []SpaceTally{
+		SpaceTally{Space: "base", Direct: Tally{Found: 1}, Subtotal: Tally{Found: 2, Missing: 2, Damaged: 1}},
+		SpaceTally{Space: "Meeting Room", Base: "base", Direct: Tally{Found: 1, Missing: 1},
+			Subtotal: Tally{Found: 1, Missing: 2, Damaged: 1}},
+		SpaceTally{Space: "Closet", Base: "Meeting Room", Direct: Tally{Missing: 1, Damaged: 1},
+			Subtotal: Tally{Missing: 1, Damaged: 1}}}
+	if !reflect.DeepEqual(report.Spaces, wantSpaces) {
+		t.Errorf("buildReport() spaces = %v, want %v", report.Spaces, wantSpaces)
+	}
+
+	wantTrend := []PeriodTally{
+		PeriodTally{Period: "2019-07", Tally: Tally{Found: 1, Missing: 1, Damaged: 1}},
+		PeriodTally{Period: "2019-08", Tally: Tally{Found: 1, Missing: 1}}}
+	if !reflect.DeepEqual(report.Trend, wantTrend) {
+		t.Errorf("buildReport() trend = %v, want %v", report.Trend, wantTrend)
+	}
+
+	wantOffenders := []RepeatOffender{RepeatOffender{Name: "E", Base: "Closet", Missing: 1, Damaged: 1}}
+	if !reflect.DeepEqual(report.RepeatOffenders, wantOffenders) {
+		t.Errorf("buildReport() offenders = %v, want %v", report.RepeatOffenders, wantOffenders)
+	}
+}
@@ -1,10 +1,13 @@
 package net
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"net/url"
 	"runtime/debug"
 	"strconv"
 	"time"
@@ -30,10 +33,16 @@ type RestContext struct {
 	CrtPath       string // HTTPS crt and key, signed to api.readygo.miosolo.top
 	MongoURI      string // URI to connect mongoDB
 	mongoDB       *mongo.Database
+	transactions  bool // MongoDB is a replica set, see dbTransaction
 	MongoDBName   string
 	RedisURL      string // URL of Redis Server
 	RedisPass     string
 	redisConnPool *redis.Pool
+	LabelSecret   string // signs the verification tokens on the asset labels
+	SignedScans   bool   // refuses the scanned codes without a label's token, like the typed-in ones
+	BlobStore     string // where the attached files are kept, local or gridfs
+	BlobDir       string // the folder of the local blob store, default to archive/attachment
+	ImportDir     string // the folder of the local files to import, like the booking exports; none if empty
 }
 
 // InitEnv : check and try to correct the RestContext and connet to DB servers
@@ -78,6 +87,11 @@ func (r *RestContext) InitEnv() (err error) {
 		}
 	}
 
+	return r.ConnectDB()
+}
+
+// ConnectDB connects to the DB servers, falling back to the ones of BakCtx
+func (r *RestContext) ConnectDB() (err error) {
 	if r.MongoDBName == "" {
 		r.MongoDBName = BakCtx.MongoDBName
 	}
@@ -89,6 +103,9 @@ func (r *RestContext) InitEnv() (err error) {
 			return err
 		}
 	}
+	if err := r.dbEnsureIndexes(); err != nil { // the duplicates left before, fixed by fsck
+		log.Println("cannot create the unique indexes, run readygo fsck --fix: " + err.Error())
+	}
 
 	if r.RedisURL == "" || r.RedisPass == "" {
 		r.RedisURL, r.RedisPass = BakCtx.RedisURL, BakCtx.RedisPass
@@ -146,6 +163,28 @@ func (c *CheckResource) WebService(r *RestContext) *restful.WebService {
 		Returns(404, "Not Found", nil).
 		DefaultReturns("OK", Asset{}))
 
+	ws.Route(ws.GET("/assets").To(r.searchAssets).
+		//docs
+		Doc("Search the assets by their metadata; all the given conditions should match.").
+		Param(ws.QueryParameter("space", "in the space and all its subspaces").DataType("string")).
+		Param(ws.QueryParameter("category", "the asset category").DataType("string")).
+		Param(ws.QueryParameter("serial", "the serial or tag number").DataType("string")).
+		Param(ws.QueryParameter("owner", "the owner").DataType("string")).
+		Param(ws.QueryParameter("status", "the comma-separated lifecycle statuses").DataType("string")).
+		Param(ws.QueryParameter("q", "text in the name, serial, owner or category, case-insensitive").DataType("string")).
+		Param(ws.QueryParameter("attr", "a free-form attribute like color:black, repeatable").DataType("string")).
+		Param(ws.QueryParameter("min-value", "the least purchase value").DataType("number")).
+		Param(ws.QueryParameter("max-value", "the most purchase value").DataType("number")).
+		Param(ws.QueryParameter("purchased-from", "purchased on or after the date, like 2019-07-01").DataType("string")).
+		Param(ws.QueryParameter("purchased-to", "purchased on or before the date").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Assets"}).
+		Writes([]Asset{}).
+		Returns(200, "OK", []Asset{}).
+		Returns(http.StatusNotAcceptable, "Params Not Acceptable", nil).
+		Returns(404, "Space Not Found", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("OK", []Asset{}))
+
 	ws.Route(ws.GET("/spaces/{space-name}").To(r.findSpace).
 		//docs
 		Doc("Get the specified space.").
@@ -164,71 +203,747 @@ func (c *CheckResource) WebService(r *RestContext) *restful.WebService {
 			"belonging to the root space and all its subspaces")).
 		Param(ws.QueryParameter("init-x", "the initial point's relative x position").DataType("integer")).
 		Param(ws.QueryParameter("init-y", "the initial point's relative y position").DataType("integer")).
+		Param(ws.QueryParameter("boost", "the extra weight ratio per day since an asset's last inspection").
+			DataType("number").DefaultValue("0")).
+		Param(ws.QueryParameter("exclude-days", "exclude the assets inspected within these days").
+			DataType("number").DefaultValue("0")).
+		Param(ws.QueryParameter("start", "when the route starts in RFC3339; the booked rooms are deferred "+
+			"with their assets, listed in the X-Deferred-Spaces header").DataType("string")).
+		Param(ws.QueryParameter("duration", "how long the route is supposed to take, in minutes").
+			DataType("number").DefaultValue("60")).
+		Param(ws.QueryParameter("walking-speed", "the walking speed estimating the ETAs, in distance per second").
+			DataType("number").DefaultValue("1.2")).
+		Param(ws.QueryParameter("statuses", "the comma-separated lifecycle statuses of the assets to sample").
+			DataType("string").DefaultValue("active")).
+		Param(ws.QueryParameter("format", "json for the route with the ETA of every stop, otherwise its picture").
+			DataType("string").DefaultValue("png")).
+		Writes(restful.MIME_OCTET).
+		Returns(200, "OK", restful.MIME_OCTET).
+		Returns(http.StatusNotAcceptable, "Params Not Acceptable", nil).
+		Returns(500, "Internal Error", nil).
+		Returns(404, "Not Found", nil).
+		DefaultReturns("OK", restful.MIME_OCTET))
+
+	ws.Route(ws.GET("/spaces/{space-name}/assets/{asset-name}/inspections").To(r.findInspections).
+		//docs
+		Doc("Get the inspection history of the specified asset, latest first.").
+		Param(ws.PathParameter("space-name", "the base space's name").DataType("string").DefaultValue("base")).
+		Param(ws.PathParameter("asset-name", "the asset's name").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Assets"}).
+		Writes([]Inspection{}).
+		Returns(200, "OK", []Inspection{}).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("OK", []Inspection{}))
+
+	ws.Route(ws.GET("/spaces/{space-name}/assets/{asset-name}/status-history").To(r.findStatusChanges).
+		//docs
+		Doc("Get the lifecycle status changes of the specified asset, latest first.").
+		Param(ws.PathParameter("space-name", "the base space's name").DataType("string").DefaultValue("base")).
+		Param(ws.PathParameter("asset-name", "the asset's name").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Assets"}).
+		Writes([]StatusChange{}).
+		Returns(200, "OK", []StatusChange{}).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("OK", []StatusChange{}))
+
+	ws.Route(ws.GET("/spaces/{space-name}/assets/{asset-name}/position").To(r.findAssetPosition).
+		//docs
+		Doc("Get the absolute position of the specified asset, resolved through all its ancestor spaces, "+
+			"with the ancestor path.").
+		Param(ws.PathParameter("space-name", "the base space's name").DataType("string").DefaultValue("base")).
+		Param(ws.PathParameter("asset-name", "the asset's name").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Assets"}).
+		Writes(Position{}).
+		Returns(200, "OK", Position{}).
+		Returns(404, "Not Found", nil).
+		Returns(http.StatusConflict, "The spaces form a cycle", nil).
+		DefaultReturns("OK", Position{}))
+
+	ws.Route(ws.GET("/spaces/{space-name}/position").To(r.findSpacePosition).
+		//docs
+		Doc("Get the absolute position of the specified space's door, and its axes, resolved through all its ancestors, "+
+			"with the ancestor path.").
+		Param(ws.PathParameter("space-name", "the space's name").DataType("string").DefaultValue("base")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Spaces"}).
+		Writes(Position{}).
+		Returns(200, "OK", Position{}).
+		Returns(404, "Not Found", nil).
+		Returns(http.StatusConflict, "The spaces form a cycle", nil).
+		DefaultReturns("OK", Position{}))
+
+	ws.Route(ws.GET("/spaces/{space-name}/positions").To(r.findSubtreePositions).
+		//docs
+		Doc("Get the absolute positions of the space, all its subspaces and all their assets, for mapping.").
+		Param(ws.PathParameter("space-name", "the root space's name").DataType("string").DefaultValue("base")).
+		Param(ws.QueryParameter("spaces", "including the spaces").DataType("boolean").DefaultValue("true")).
+		Param(ws.QueryParameter("assets", "including the assets").DataType("boolean").DefaultValue("true")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Spaces"}).
+		Writes([]Position{}).
+		Returns(200, "OK", []Position{}).
+		Returns(http.StatusNotAcceptable, "Params Not Acceptable", nil).
+		Returns(404, "Not Found", nil).
+		Returns(http.StatusConflict, "The spaces form a cycle", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("OK", []Position{}))
+
+	ws.Route(ws.GET("/spaces/{space-name}/nearby").To(r.findNearbyAssets).
+		//docs
+		Doc("Find the assets in the space and all its subspaces within the radius of the absolute point, "+
+			"nearest first; the search conditions like category and status apply as in searching the assets.").
+		Param(ws.PathParameter("space-name", "the root space's name").DataType("string").DefaultValue("base")).
+		Param(ws.QueryParameter("x", "absolute x of the point").DataType("number").Required(true)).
+		Param(ws.QueryParameter("y", "absolute y of the point").DataType("number").Required(true)).
+		Param(ws.QueryParameter("radius", "the distance in the absolute units").DataType("number").Required(true)).
+		Param(ws.QueryParameter("category", "only the assets of the category").DataType("string")).
+		Param(ws.QueryParameter("status", "only the assets in the statuses, separated by comma").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Assets"}).
+		Writes([]NearbyAsset{}).
+		Returns(200, "OK", []NearbyAsset{}).
+		Returns(http.StatusNotAcceptable, "Params Not Acceptable", nil).
+		Returns(404, "Not Found", nil).
+		Returns(http.StatusConflict, "The spaces form a cycle", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("OK", []NearbyAsset{}))
+
+	ws.Route(ws.GET("/spaces/{space-name}/nearest").To(r.findNearestAssets).
+		//docs
+		Doc("Find the k nearest assets to the absolute point in the space and all its subspaces, nearest first; "+
+			"the search conditions like category and status apply as in searching the assets.").
+		Param(ws.PathParameter("space-name", "the root space's name").DataType("string").DefaultValue("base")).
+		Param(ws.QueryParameter("x", "absolute x of the point").DataType("number").Required(true)).
+		Param(ws.QueryParameter("y", "absolute y of the point").DataType("number").Required(true)).
+		Param(ws.QueryParameter("k", "how many assets to find").DataType("integer").DefaultValue("10")).
+		Param(ws.QueryParameter("category", "only the assets of the category").DataType("string")).
+		Param(ws.QueryParameter("status", "only the assets in the statuses, separated by comma").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Assets"}).
+		Writes([]NearbyAsset{}).
+		Returns(200, "OK", []NearbyAsset{}).
+		Returns(http.StatusNotAcceptable, "Params Not Acceptable", nil).
+		Returns(404, "Not Found", nil).
+		Returns(http.StatusConflict, "The spaces form a cycle", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("OK", []NearbyAsset{}))
+
+	ws.Route(ws.GET("/admin/fsck").To(r.fsck).
+		//docs
+		Doc("Check the consistency of the spaces, the assets and their Redis cache: duplicate names, non-finite "+
+			"coordinates, negative weights, orphans, cycles of the base spaces, and the cache stale or drifted from MongoDB. "+
+			"Nothing is changed; POST to fix. Also by the command line: readygo fsck [--fix].").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Admin"}).
+		Writes(FsckReport{}).
+		Returns(200, "OK", FsckReport{}).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("OK", FsckReport{}))
+
+	ws.Route(ws.GET("/spaces/{space-name}/assets/{asset-name}/attachments").To(r.findAssetAttachments).
+		//docs
+		Doc("List the files attached to the specified asset, latest first.").
+		Param(ws.PathParameter("space-name", "the base space's name").DataType("string").DefaultValue("base")).
+		Param(ws.PathParameter("asset-name", "the asset's name").DataType("string")).
+		Param(ws.QueryParameter("all", "including the ones attached to its check results in the sessions").
+			DataType("boolean").DefaultValue("false")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Assets"}).
+		Writes([]Attachment{}).
+		Returns(200, "OK", []Attachment{}).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("OK", []Attachment{}))
+
+	ws.Route(ws.GET("/sessions/{session-id}/stops/{space-name}/{asset-name}/attachments").To(r.findStopAttachments).
+		//docs
+		Doc("List the files attached to the check result of the asset in the session, latest first.").
+		Param(ws.PathParameter("session-id", "the session's id").DataType("string")).
+		Param(ws.PathParameter("space-name", "the asset's base space").DataType("string")).
+		Param(ws.PathParameter("asset-name", "the asset's name").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Sessions"}).
+		Writes([]Attachment{}).
+		Returns(200, "OK", []Attachment{}).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("OK", []Attachment{}))
+
+	ws.Route(ws.GET("/attachments/{attachment-id}").To(r.downloadAttachment).
+		//docs
+		Doc("Download the attached file.").
+		Param(ws.PathParameter("attachment-id", "the attachment's id").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Assets", "Sessions"}).
+		Writes(restful.MIME_OCTET).
+		Returns(200, "OK", restful.MIME_OCTET).
+		Returns(404, "Not Found", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("OK", restful.MIME_OCTET))
+
+	ws.Route(ws.GET("/attachments/{attachment-id}/thumbnail").To(r.downloadThumbnail).
+		//docs
+		Doc("Download the PNG thumbnail of the attached picture, at most 200 pixels a side.").
+		Param(ws.PathParameter("attachment-id", "the attachment's id").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Assets", "Sessions"}).
+		Writes("image/png").
+		Returns(200, "OK", "image/png").
+		Returns(404, "Not Found, or not a picture", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("OK", "image/png"))
+
+	ws.Route(ws.GET("/spaces/{space-name}/assets/{asset-name}/label").To(r.findAssetLabel).
+		//docs
+		Doc("Get the printable QR code label of the specified asset, encoding name@base#token; "+
+			"the token is verified when the label is scanned.").
+		Param(ws.PathParameter("space-name", "the base space's name").DataType("string").DefaultValue("base")).
+		Param(ws.PathParameter("asset-name", "the asset's name").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Assets"}).
+		Produces("image/png").
+		Writes(restful.MIME_OCTET).
+		Returns(200, "OK", restful.MIME_OCTET).
+		Returns(404, "Not Found", nil).
+		Returns(http.StatusServiceUnavailable, "No label secret configured", nil).
+		DefaultReturns("OK", restful.MIME_OCTET))
+
+	ws.Route(ws.GET("/spaces/{space-name}/labels").To(r.findSpaceLabels).
+		//docs
+		Doc("Get a printable A4 sheet of the QR code labels of the assets in the specified space, "+
+			"3 x 8 labels per page; the total pages are in the X-Total-Pages header.").
+		Param(ws.PathParameter("space-name", "the space's name").DataType("string").DefaultValue("base")).
+		Param(ws.QueryParameter("subtree", "include the assets in all its subspaces").
+			DataType("boolean").DefaultValue("false")).
+		Param(ws.QueryParameter("page", "the page of the sheet, from 1").DataType("integer").DefaultValue("1")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Assets", "Spaces"}).
+		Produces("image/png").
 		Writes(restful.MIME_OCTET).
 		Returns(200, "OK", restful.MIME_OCTET).
 		Returns(http.StatusNotAcceptable, "Params Not Acceptable", nil).
+		Returns(404, "Not Found", nil).
+		Returns(http.StatusServiceUnavailable, "No label secret configured", nil).
+		DefaultReturns("OK", restful.MIME_OCTET))
+
+	ws.Route(ws.GET("/campaigns/{space-name}").To(r.findCampaign).
+		//docs
+		Doc("Get the inspection campaign running on the specified space.").
+		Param(ws.PathParameter("space-name", "the root space's name").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Spaces"}).
+		Writes(Campaign{}).
+		Returns(200, "OK", Campaign{}).
+		Returns(404, "Not Found", nil).
+		DefaultReturns("OK", Campaign{}))
+
+	ws.Route(ws.GET("/weight-rules").To(r.findWeightRules).
+		//docs
+		Doc("Get all the rules computing the assets' sampling weights.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Weight Rules"}).
+		Writes([]WeightRule{}).
+		Returns(200, "OK", []WeightRule{}).
 		Returns(500, "Internal Error", nil).
+		DefaultReturns("OK", []WeightRule{}))
+
+	ws.Route(ws.GET("/weight-rules/preview/{space-name}").To(r.previewWeightRules).
+		//docs
+		Doc("Preview the effective sampling weights of the assets under the space computed by the rules.").
+		Param(ws.PathParameter("space-name", "the root space's name").DataType("string").DefaultValue("base")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Weight Rules"}).
+		Writes([]WeightPreview{}).
+		Returns(200, "OK", []WeightPreview{}).
+		Returns(404, "Space not found", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("OK", []WeightPreview{}))
+
+	ws.Route(ws.GET("/reports/space/{space-name}").To(r.findReport).
+		//docs
+		Doc("Summarise the inspection results under the space: found/ missing/ damaged counts rolled up "+
+			"the space hierarchy, the trend over time and the assets missing or damaged repeatedly.").
+		Param(ws.PathParameter("space-name", "the root space's name").DataType("string").DefaultValue("base")).
+		Param(ws.QueryParameter("from", "the start of the range in RFC3339, half a year ago by default").
+			DataType("string")).
+		Param(ws.QueryParameter("to", "the end of the range in RFC3339, now by default").DataType("string")).
+		Param(ws.QueryParameter("period", "the trend's granularity: day, week or month").
+			DataType("string").DefaultValue("month")).
+		Param(ws.QueryParameter("repeat", "the times an asset missing or damaged to be a repeat offender").
+			DataType("integer").DefaultValue("2")).
+		Param(ws.QueryParameter("format", "csv for exporting one section of the report, otherwise json").
+			DataType("string").DefaultValue("json")).
+		Param(ws.QueryParameter("section", "the section exported as csv: spaces, trend or offenders").
+			DataType("string").DefaultValue("spaces")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Reports"}).
+		Writes(DiscrepancyReport{}).
+		Returns(200, "OK", DiscrepancyReport{}).
+		Returns(http.StatusNotAcceptable, "Params Not Acceptable", nil).
+		Returns(404, "Space not found", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("OK", DiscrepancyReport{}))
+
+	ws.Route(ws.GET("/plans").To(r.findPlans).
+		//docs
+		Doc("Get all the recurring inspection plans.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Plans"}).
+		Writes([]InspectionPlan{}).
+		Returns(200, "OK", []InspectionPlan{}).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("OK", []InspectionPlan{}))
+
+	ws.Route(ws.GET("/plans/{plan-id}").To(r.findPlan).
+		//docs
+		Doc("Get the specified inspection plan and when it falls due next.").
+		Param(ws.PathParameter("plan-id", "the plan's id").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Plans"}).
+		Writes(InspectionPlan{}).
+		Returns(200, "OK", InspectionPlan{}).
 		Returns(404, "Not Found", nil).
+		DefaultReturns("OK", InspectionPlan{}))
+
+	ws.Route(ws.GET("/calendar/inspectors/{inspector}").To(r.findInspectorCalendar).
+		//docs
+		Doc("Subscribe to the inspector's sessions and upcoming planned inspections as an iCalendar feed.").
+		Param(ws.PathParameter("inspector", "the inspector's name").DataType("string")).
+		Param(ws.QueryParameter("walking-speed", "the walking speed estimating the durations, in distance per second").
+			DataType("number").DefaultValue("1.2")).
+		Produces("text/calendar").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Calendar"}).
+		Returns(200, "OK", nil).
+		Returns(http.StatusNotAcceptable, "Invalid walking speed", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("OK", nil))
+
+	ws.Route(ws.GET("/calendar/spaces/{space-name}").To(r.findSpaceCalendar).
+		//docs
+		Doc("Subscribe to the sessions and upcoming planned inspections in the space as an iCalendar feed.").
+		Param(ws.PathParameter("space-name", "the root space's name").DataType("string").DefaultValue("base")).
+		Param(ws.QueryParameter("walking-speed", "the walking speed estimating the durations, in distance per second").
+			DataType("number").DefaultValue("1.2")).
+		Produces("text/calendar").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Calendar"}).
+		Returns(200, "OK", nil).
+		Returns(http.StatusNotAcceptable, "Invalid walking speed", nil).
+		Returns(404, "Space not found", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("OK", nil))
+
+	ws.Route(ws.GET("/spaces/{space-name}/bookings").To(r.findBookings).
+		//docs
+		Doc("Get the bookings of the space imported, ordered by start time.").
+		Param(ws.PathParameter("space-name", "the space's name").DataType("string")).
+		Param(ws.QueryParameter("from", "only the bookings ending after it, in RFC3339").DataType("string")).
+		Param(ws.QueryParameter("to", "only the bookings starting before it, in RFC3339; "+
+			"the recurring ones are repeated in the window when given").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Spaces"}).
+		Writes([]Booking{}).
+		Returns(200, "OK", []Booking{}).
+		Returns(http.StatusNotAcceptable, "Invalid time", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("OK", []Booking{}))
+
+	ws.Route(ws.GET("/dwell-times").To(r.findDwellTimes).
+		//docs
+		Doc("Get the time to check an asset of every category, estimating the ETAs.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Assets"}).
+		Writes([]DwellTime{}).
+		Returns(200, "OK", []DwellTime{}).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("OK", []DwellTime{}))
+
+	ws.Route(ws.GET("/sessions").To(r.findSessions).
+		//docs
+		Doc("List the inspection sessions, latest first.").
+		Param(ws.QueryParameter("space", "only the sessions in the root space").DataType("string")).
+		Param(ws.QueryParameter("inspector", "only the sessions of the inspector").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Sessions"}).
+		Writes([]Session{}).
+		Returns(200, "OK", []Session{}).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("OK", []Session{}))
+
+	ws.Route(ws.GET("/sessions/{session-id}").To(r.findSession).
+		//docs
+		Doc("Get the specified inspection session and its progress.").
+		Param(ws.PathParameter("session-id", "the session's id").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Sessions"}).
+		Writes(Session{}).
+		Returns(200, "OK", Session{}).
+		Returns(404, "Not Found", nil).
+		DefaultReturns("OK", Session{}))
+
+	ws.Route(ws.GET("/sessions/{session-id}/route").To(r.findSessionRoute).
+		//docs
+		Doc("Get the picture of the session's current route.").
+		Param(ws.PathParameter("session-id", "the session's id").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Sessions"}).
+		Writes(restful.MIME_OCTET).
+		Returns(200, "OK", restful.MIME_OCTET).
+		Returns(404, "Not Found", nil).
+		Returns(500, "Internal Error", nil).
 		DefaultReturns("OK", restful.MIME_OCTET))
 
 	// POST
+	ws.Route(ws.POST("/sessions/{session-id}/replan").To(r.replanSession).
+		//docs
+		Doc("Re-plan the remaining stops of the session from the inspector's current position, "+
+			"skipping the unreachable ones; only the stops still pending can be skipped.").
+		Param(ws.PathParameter("session-id", "the session's id").DataType("string")).
+		Param(ws.QueryParameter("format", "png for the picture of the new route, otherwise the session").
+			DataType("string").DefaultValue("json")).
+		Reads(ReplanRequest{}).
+		Writes(Session{}).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Sessions"}).
+		Returns(200, "Session re-planned", Session{}).
+		Returns(http.StatusNotAcceptable, "Invalid request", nil).
+		Returns(404, "Session or stop not found", nil).
+		Returns(http.StatusConflict, "Some stops to skip are already recorded, or the session changed meanwhile", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("Session re-planned", Session{}))
+
+	ws.Route(ws.POST("/plans/{plan-id}/run").To(r.runPlanNow).
+		//docs
+		Doc("Generate a session of the plan right now, out of its recurrence.").
+		Param(ws.PathParameter("plan-id", "the plan's id").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Plans"}).
+		Writes(Session{}).
+		Returns(http.StatusCreated, "Session created", Session{}).
+		Returns(http.StatusNotAcceptable, "Empty set after sampling", nil).
+		Returns(404, "Not Found", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("Session created", Session{}))
+
+	ws.Route(ws.POST("/sessions/{session-id}/scans").To(r.scanStop).
+		//docs
+		Doc("Check in the scanned asset as found in the session; assets out of the sample or in another "+
+			"space are flagged misplaced, and skipping the route order is warned; the label's token is verified if "+
+			"scanned, and required only if the server is started with -signedscans.").
+		Param(ws.PathParameter("session-id", "the session's id").DataType("string")).
+		Reads(ScanRequest{}).
+		Writes(ScanResult{}).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Sessions"}).
+		Returns(200, "Scan recorded", ScanResult{}).
+		Returns(http.StatusNotAcceptable, "Invalid code, forged label, or no token while signed scans are required", nil).
+		Returns(404, "Session or asset not found", nil).
+		Returns(http.StatusServiceUnavailable, "No label secret configured", nil).
+		Returns(http.StatusConflict, "The session kept changing by others, try again", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("Scan recorded", ScanResult{}))
+
+	ws.Route(ws.POST("/admin/fsck").To(r.fsck).
+		//docs
+		Doc("Check like GET /admin/fsck, and fix the problems: the later duplicates and the stale cache are deleted, "+
+			"the invalid numbers reset, and the orphans and the cycles moved into the top space "+LOST_FOUND+".").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Admin"}).
+		Writes(FsckReport{}).
+		Returns(200, "OK", FsckReport{}).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("OK", FsckReport{}))
+
+	ws.Route(ws.POST("/spaces/{space-name}/clone").To(r.cloneSpace).
+		//docs
+		Doc("Copy the space with all its subspaces and assets under the new base space, renamed by the prefix, "+
+			"and moved or turned around its door if asked. The assets keep their names but not their serials, statuses "+
+			"or inspections. Every name taken is reported before anything is written.").
+		Param(ws.PathParameter("space-name", "the space to copy").DataType("string")).
+		Reads(CloneRequest{}).
+		Writes(CloneResult{}).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Spaces"}).
+		Returns(201, "Created", CloneResult{}).
+		Returns(http.StatusForbidden, "The new base space does not exist", nil).
+		Returns(404, "Not Found", nil).
+		Returns(http.StatusNotAcceptable, "No prefix, or out of the base space", nil).
+		Returns(http.StatusConflict, "The names of the copies are taken", nil).
+		Returns(http.StatusServiceUnavailable, "Needs MongoDB as a replica set", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("Created", CloneResult{}))
+
+	ws.Route(ws.POST("/spaces/{space-name}/transform").To(r.transformSpace).
+		//docs
+		Doc("Map the coordinates in the space after a resurvey: its direct assets and the doors of its child spaces "+
+			"are mirrored, scaled, rotated around its door, then translated, in one transaction that needs MongoDB as "+
+			"a replica set. The child spaces turn and scale along, with their outlines and contents; they cannot be mirrored "+
+			"if they have outlines. Preview it by dry-run, with what would lie out of the space.").
+		Param(ws.PathParameter("space-name", "the space's name").DataType("string")).
+		Param(ws.QueryParameter("dry-run", "only preview the new positions").DataType("boolean").DefaultValue("false")).
+		Reads(TransformRequest{}).
+		Writes(TransformResult{}).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Spaces"}).
+		Returns(200, "OK", TransformResult{}).
+		Returns(404, "Not Found", nil).
+		Returns(http.StatusNotAcceptable, "Invalid transform, or out of the space", nil).
+		Returns(http.StatusServiceUnavailable, "Needs MongoDB as a replica set", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("OK", TransformResult{}))
+
+	ws.Route(ws.POST("/spaces/{space-name}/move").To(r.moveSpace).
+		//docs
+		Doc("Rename the space, or move it to another base space, in one transaction: its subspaces, its assets "+
+			"and the other records referring to it by name follow, and the cache is renamed. Needs MongoDB as a replica set. "+
+			"Renaming voids the printed labels of the assets directly in it, listed in the X-Reprint-Labels header.").
+		Param(ws.PathParameter("space-name", "the space's name").DataType("string")).
+		Param(ws.QueryParameter("name", "the new name").DataType("string")).
+		Param(ws.QueryParameter("base", "the new base space, empty to be a top space").DataType("string")).
+		Param(ws.QueryParameter("rx", "the new relative x of its door in the base space").DataType("number")).
+		Param(ws.QueryParameter("ry", "the new relative y of its door in the base space").DataType("number")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Spaces"}).
+		Writes(Space{}).
+		Returns(200, "OK", Space{}).
+		Returns(http.StatusForbidden, "The new base space does not exist", nil).
+		Returns(404, "Not Found", nil).
+		Returns(http.StatusNotAcceptable, "Params Not Acceptable, or out of the base space", nil).
+		Returns(http.StatusConflict, "The new name is taken, or the space would lie in itself", nil).
+		Returns(http.StatusServiceUnavailable, "Needs MongoDB as a replica set", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("OK", Space{}))
+
+	ws.Route(ws.POST("/sessions/space/{space-name}").To(r.createSession).
+		//docs
+		Doc("Plan a route in the specified space like GET /route/space, and track it as an inspection session.").
+		Param(ws.PathParameter("space-name", "the root space's name").DataType("string").DefaultValue("base")).
+		Param(ws.QueryParameter("inspector", "who carries out the inspection").DataType("string")).
+		Param(ws.QueryParameter("sample-rate", "the global sampling rate of all the assets"+
+			"belonging to the root space and all its subspaces")).
+		Param(ws.QueryParameter("init-x", "the initial point's relative x position").DataType("integer")).
+		Param(ws.QueryParameter("init-y", "the initial point's relative y position").DataType("integer")).
+		Param(ws.QueryParameter("boost", "the extra weight ratio per day since an asset's last inspection").
+			DataType("number").DefaultValue("0")).
+		Param(ws.QueryParameter("exclude-days", "exclude the assets inspected within these days").
+			DataType("number").DefaultValue("0")).
+		Param(ws.QueryParameter("start", "when the route starts in RFC3339; the booked rooms are deferred "+
+			"with their assets, listed in the X-Deferred-Spaces header").DataType("string")).
+		Param(ws.QueryParameter("duration", "how long the route is supposed to take, in minutes").
+			DataType("number").DefaultValue("60")).
+		Param(ws.QueryParameter("walking-speed", "the walking speed estimating the ETAs, in distance per second").
+			DataType("number").DefaultValue("1.2")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Sessions"}).
+		Writes(Session{}).
+		Returns(http.StatusCreated, "Session created", Session{}).
+		Returns(http.StatusNotAcceptable, "Params Not Acceptable", nil).
+		Returns(500, "Internal Error", nil).
+		Returns(404, "Not Found", nil).
+		DefaultReturns("Session created", Session{}))
+
+	ws.Route(ws.POST("/spaces/{space-name}/assets/{asset-name}/inspections").To(r.createInspection).
+		//docs
+		Doc("Record an inspection of the specified asset.").
+		Param(ws.PathParameter("space-name", "the base space's name").DataType("string").DefaultValue("base")).
+		Param(ws.PathParameter("asset-name", "the asset's name").DataType("string")).
+		Param(ws.QueryParameter("time", "the inspection time in RFC3339, default to now").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Assets"}).
+		Writes(Inspection{}).
+		Returns(http.StatusCreated, "Inspection recorded", Inspection{}).
+		Returns(http.StatusNotAcceptable, "Invalid time", nil).
+		Returns(404, "Asset not found", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("Inspection recorded", Inspection{}))
+
 	ws.Route(ws.POST("/checkpoints").Consumes("multipart/form-data").To(r.uploadCsv).
 		//docs
-		Doc("Post the raw checkpoint(including space and asset) file to add spaces and/or assets.").
+		Doc("Post the raw checkpoint(including space and asset) file to add spaces and/or assets. "+
+			"The columns are name, base, rx, ry, isPortal, weight, then the optional metadata named by the header: "+
+			"category, serial, owner, purchaseValue, purchaseDate (2019-07-01), and any other free-form attributes. "+
+			"The import is atomic: every row is inserted in one transaction, or none is and the rows aborting it are listed; "+
+			"on a standalone MongoDB the rows are inserted in stages, and the written ones deleted if any fails.").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"Assets", "Spaces"}).
-		Returns(http.StatusCreated, "Objects uploaded", restful.MIME_JSON).
+		Writes(ImportResult{}).
+		Returns(http.StatusCreated, "Objects uploaded", ImportResult{}).
 		Returns(http.StatusRequestEntityTooLarge, "File too large", nil).
-		Returns(http.StatusNotAcceptable, "Not Acceptable", nil).
-		Returns(http.StatusPartialContent, "Some lines are omitted", restful.MIME_JSON).
-		Returns(http.StatusConflict, "Some objects already exists", nil).
+		Returns(http.StatusNotAcceptable, "Rows not parsed, with invalid metadata, a missing base or out of the outline; "+
+			"nothing is inserted", ImportResult{}).
+		Returns(http.StatusConflict, "Rows repeated or already existing; nothing is inserted", ImportResult{}).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("Objects uploaded", ImportResult{}))
+
+	ws.Route(ws.POST("/spaces/{space-name}/assets/{asset-name}/attachments").Consumes("multipart/form-data").
+		To(r.createAssetAttachment).
+		//docs
+		Doc("Attach the form file 'file' to the asset, like a photo or an invoice: at most 10M, "+
+			"of type JPEG, PNG, GIF, PDF or plain text detected from the content; the pictures get thumbnails.").
+		Param(ws.PathParameter("space-name", "the base space's name").DataType("string").DefaultValue("base")).
+		Param(ws.PathParameter("asset-name", "the asset's name").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Assets"}).
+		Writes(Attachment{}).
+		Returns(http.StatusCreated, "File attached", Attachment{}).
+		Returns(http.StatusNotAcceptable, "No file or empty", nil).
+		Returns(http.StatusRequestEntityTooLarge, "File too large", nil).
+		Returns(http.StatusUnsupportedMediaType, "Type not allowed", nil).
+		Returns(404, "Asset not found", nil).
 		Returns(500, "Internal Error", nil).
-		DefaultReturns("Objects uploaded", nil))
+		DefaultReturns("File attached", Attachment{}))
+
+	ws.Route(ws.POST("/sessions/{session-id}/stops/{space-name}/{asset-name}/attachments").
+		Consumes("multipart/form-data").To(r.createStopAttachment).
+		//docs
+		Doc("Attach the form file 'file' to the check result of the asset in the session, like a photo of the damage; "+
+			"the same limits as the asset's attachments.").
+		Param(ws.PathParameter("session-id", "the session's id").DataType("string")).
+		Param(ws.PathParameter("space-name", "the asset's base space").DataType("string")).
+		Param(ws.PathParameter("asset-name", "the asset's name").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Sessions"}).
+		Writes(Attachment{}).
+		Returns(http.StatusCreated, "File attached", Attachment{}).
+		Returns(http.StatusNotAcceptable, "No file or empty", nil).
+		Returns(http.StatusRequestEntityTooLarge, "File too large", nil).
+		Returns(http.StatusUnsupportedMediaType, "Type not allowed", nil).
+		Returns(404, "Session or stop not found", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("File attached", Attachment{}))
 
 	// PUT
 	ws.Route(ws.PUT("/spaces/{space-name}/assets/{asset-name}").To(r.createAsset).
 		//docs
-		Doc("Put the asset to the space that exists.").
+		Doc("Put the asset to the space that exists, inside its outline if it has.").
 		Param(ws.PathParameter("space-name", "the base space's name").DataType("string").DefaultValue("base")).
 		Param(ws.PathParameter("asset-name", "the asset's name").DataType("string")).
 		Reads(Asset{}).
 		Writes(Asset{}).
 		Metadata(restfulspec.KeyOpenAPITags, []string{"Assets"}).
 		Returns(http.StatusCreated, "Asset uploaded", Asset{}).
-		Returns(http.StatusNotAcceptable, "Invalid asset object", nil).
+		Returns(http.StatusNotAcceptable, "Invalid asset object, or out of the space's outline", nil).
 		Returns(http.StatusConflict, "Some objects already exists", nil).
 		Returns(500, "Internal Error", nil).
 		DefaultReturns("Asset uploaded", Asset{}))
 
+	ws.Route(ws.PUT("/spaces/{space-name}/assets/{asset-name}/status").To(r.changeStatus).
+		//docs
+		Doc("Change the lifecycle status of the specified asset: active, in-repair, loaned-out, retired or disposed. "+
+			"A disposed asset can never change again; only the assets in the statuses to sample are routed.").
+		Param(ws.PathParameter("space-name", "the base space's name").DataType("string").DefaultValue("base")).
+		Param(ws.PathParameter("asset-name", "the asset's name").DataType("string")).
+		Reads(StatusChange{}).
+		Writes(Asset{}).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Assets"}).
+		Returns(200, "Status changed", Asset{}).
+		Returns(http.StatusNotAcceptable, "Invalid status or transition", nil).
+		Returns(404, "Asset not found", nil).
+		Returns(http.StatusConflict, "Changed concurrently", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("Status changed", Asset{}))
+
 	ws.Route(ws.PUT("/spaces/{space-name}").To(r.createSpace).
 		//docs
-		Doc("Put the space specified.").
+		Doc("Put the space specified; with an outline, or width and height, it must lie inside its parent's, "+
+			"and so must its assets and subspaces.").
 		Param(ws.PathParameter("space-name", "the space's name").DataType("string").DefaultValue("base")).
 		Reads(Space{}).
 		Writes(Space{}).
 		Metadata(restfulspec.KeyOpenAPITags, []string{"Spaces"}).
 		Returns(http.StatusCreated, "Space uploaded", Space{}).
-		Returns(http.StatusNotAcceptable, "Invalid space object", nil).
+		Returns(http.StatusNotAcceptable, "Invalid space object, or out of the parent's outline", nil).
 		Returns(http.StatusConflict, "Some objects already exists", nil).
 		Returns(500, "Internal Error", nil).
 		DefaultReturns("Space uploaded", Space{}))
 
+	ws.Route(ws.PUT("/campaigns/{space-name}").To(r.createCampaign).
+		//docs
+		Doc("Start an inspection campaign covering every asset under the space within the given rounds, "+
+			"replacing the running one. Every session started on the space or its subspaces is a round.").
+		Param(ws.PathParameter("space-name", "the root space's name").DataType("string")).
+		Param(ws.QueryParameter("rounds", "the number of sessions to cover all the assets in").DataType("integer")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Spaces"}).
+		Writes(Campaign{}).
+		Returns(http.StatusCreated, "Campaign started", Campaign{}).
+		Returns(http.StatusNotAcceptable, "Invalid rounds", nil).
+		Returns(404, "Space not found", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("Campaign started", Campaign{}))
+
+	ws.Route(ws.PUT("/weight-rules/{rule-id}").To(r.putWeightRule).
+		//docs
+		Doc("Put the weight rule, replacing the one with the same id.").
+		Param(ws.PathParameter("rule-id", "the rule's id").DataType("string")).
+		Reads(WeightRule{}).
+		Writes(WeightRule{}).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Weight Rules"}).
+		Returns(200, "Rule saved", WeightRule{}).
+		Returns(http.StatusNotAcceptable, "Invalid rule object", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("Rule saved", WeightRule{}))
+
+	ws.Route(ws.PUT("/spaces/{space-name}/bookings").Consumes("multipart/form-data").To(r.putBookings).
+		//docs
+		Doc("Import the room booking export (.ics) of the space, replacing its bookings; "+
+			"uploaded as the form file 'ics', or from the server's import folder. "+
+			"The recurring events are repeated by their RRULE when planning and listing in a window.").
+		Param(ws.PathParameter("space-name", "the space's name").DataType("string")).
+		Param(ws.QueryParameter("file", "the path of the local .ics export, relative to the server's import folder").
+			DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Spaces"}).
+		Writes([]Booking{}).
+		Returns(200, "Bookings imported", []Booking{}).
+		Returns(http.StatusNotAcceptable, "Invalid calendar", nil).
+		Returns(http.StatusRequestEntityTooLarge, "File too large", nil).
+		Returns(http.StatusForbidden, "No import folder, or the path out of it", nil).
+		Returns(404, "Space or file not found", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("Bookings imported", []Booking{}))
+
+	ws.Route(ws.PUT("/dwell-times/{category}").To(r.putDwellTime).
+		//docs
+		Doc("Set the time to check an asset of the category, unless the asset has its own.").
+		Param(ws.PathParameter("category", "the asset category").DataType("string")).
+		Param(ws.QueryParameter("seconds", "seconds to check an asset").DataType("number")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Assets"}).
+		Writes(DwellTime{}).
+		Returns(200, "Dwell time saved", DwellTime{}).
+		Returns(http.StatusNotAcceptable, "Invalid seconds", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("Dwell time saved", DwellTime{}))
+
+	ws.Route(ws.PUT("/plans/{plan-id}").To(r.putPlan).
+		//docs
+		Doc("Put the inspection plan, replacing the one with the same id and rescheduling it.").
+		Param(ws.PathParameter("plan-id", "the plan's id").DataType("string")).
+		Reads(InspectionPlan{}).
+		Writes(InspectionPlan{}).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Plans"}).
+		Returns(200, "Plan saved", InspectionPlan{}).
+		Returns(http.StatusNotAcceptable, "Invalid plan object", nil).
+		Returns(404, "Space not found", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("Plan saved", InspectionPlan{}))
+
+	ws.Route(ws.PUT("/sessions/{session-id}/stops/{space-name}/{asset-name}").To(r.markStop).
+		//docs
+		Doc("Mark the result of checking the asset in the session.").
+		Param(ws.PathParameter("session-id", "the session's id").DataType("string")).
+		Param(ws.PathParameter("space-name", "the asset's base space").DataType("string")).
+		Param(ws.PathParameter("asset-name", "the asset's name").DataType("string")).
+		Reads(StopResult{}).
+		Writes(Session{}).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Sessions"}).
+		Returns(200, "Stop marked", Session{}).
+		Returns(http.StatusNotAcceptable, "Invalid result", nil).
+		Returns(404, "Session or stop not found", nil).
+		Returns(http.StatusConflict, "The session kept changing by others, try again", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("Stop marked", Session{}))
+
 	// PATCH
-	ws.Route(ws.PATCH("/spaces/{space-name}/assets/{asset-name}").To(r.updateAsset).
+	ws.Route(ws.PATCH("/spaces/{space-name}/assets/{asset-name}").Consumes(restful.MIME_JSON, MIME_MERGE_PATCH).
+		To(r.updateAsset).
 		//docs
-		Doc("Update the asset's infomation addressed.").
+		Doc("Update the asset's infomation addressed, by a JSON merge patch (RFC 7386) in the body covering "+
+			"the position, the base space, the weight and the metadata, or by the query parameters without a body. "+
+			"Moving it to another base space takes its history along in one transaction, which needs MongoDB as a replica set, "+
+			"and voids its printed label, listed in the X-Reprint-Labels header.").
 		Param(ws.PathParameter("space-name", "the base space's name").DataType("string").DefaultValue("base")).
 		Param(ws.PathParameter("asset-name", "the asset's name").DataType("string")).
 		Param(ws.QueryParameter("rx", "the new relative x position value").DataType("number").DefaultValue("")).
 		Param(ws.QueryParameter("ry", "the new relative y position value").DataType("number").DefaultValue("")).
 		Param(ws.QueryParameter("weight", "the new sampling weight").DataType("number").DefaultValue("")).
+		Reads(Asset{}).
 		Writes(Asset{}).
 		Metadata(restfulspec.KeyOpenAPITags, []string{"Assets"}).
 		Returns(200, "Asset updated", Asset{}).
-		Returns(http.StatusNotAcceptable, "Invalid parameters", nil).
+		Returns(http.StatusNotAcceptable, "Invalid parameters, or the fields of the patch wrong", PatchErrors{}).
+		Returns(http.StatusConflict, "The asset exists in the new base space", nil).
+		Returns(http.StatusServiceUnavailable, "Needs MongoDB as a replica set", nil).
 		Returns(500, "Internal Error", nil).
 		Returns(404, "Original asset not found", nil).
 		DefaultReturns("Asset updated", Asset{}))
 
+	ws.Route(ws.PATCH("/spaces/{space-name}").Consumes(restful.MIME_JSON, MIME_MERGE_PATCH).To(r.patchSpace).
+		//docs
+		Doc("Update the space by a JSON merge patch (RFC 7386) in the body, covering the position, the base space, "+
+			"the geometry and the attributes; it should stay inside its base space, and keep its subspaces and "+
+			"assets inside. Rename it by POST .../move.").
+		Param(ws.PathParameter("space-name", "the space's name").DataType("string")).
+		Reads(Space{}).
+		Writes(Space{}).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Spaces"}).
+		Returns(200, "Space updated", Space{}).
+		Returns(http.StatusNotAcceptable, "The fields of the patch wrong", PatchErrors{}).
+		Returns(404, "Original space not found", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("Space updated", Space{}))
+
 	// DELETE
 	ws.Route(ws.DELETE("/spaces/{space-name}/assets/{asset-name}").To(r.deleteAsset).
 		//docs
@@ -252,6 +967,65 @@ func (c *CheckResource) WebService(r *RestContext) *restful.WebService {
 		Returns(404, "Asset not found", nil).
 		DefaultReturns("Objects deleted", nil))
 
+	ws.Route(ws.DELETE("/campaigns/{space-name}").To(r.deleteCampaign).
+		//docs
+		Doc("Stop the inspection campaign running on the space.").
+		Param(ws.PathParameter("space-name", "the root space's name").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Spaces"}).
+		Returns(200, "Campaign stopped", nil).
+		Returns(500, "Internal Error", nil).
+		Returns(404, "Campaign not found", nil).
+		DefaultReturns("Campaign stopped", nil))
+
+	ws.Route(ws.DELETE("/weight-rules/{rule-id}").To(r.deleteWeightRule).
+		//docs
+		Doc("Delete the specified weight rule.").
+		Param(ws.PathParameter("rule-id", "the rule's id").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Weight Rules"}).
+		Returns(200, "Rule deleted", nil).
+		Returns(500, "Internal Error", nil).
+		Returns(404, "Rule not found", nil).
+		DefaultReturns("Rule deleted", nil))
+
+	ws.Route(ws.DELETE("/spaces/{space-name}/bookings").To(r.deleteBookings).
+		//docs
+		Doc("Clear the bookings of the space.").
+		Param(ws.PathParameter("space-name", "the space's name").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Spaces"}).
+		Returns(200, "Bookings cleared", nil).
+		Returns(500, "Internal Error", nil).
+		DefaultReturns("Bookings cleared", nil))
+
+	ws.Route(ws.DELETE("/dwell-times/{category}").To(r.deleteDwellTime).
+		//docs
+		Doc("Reset the time to check an asset of the category to the default.").
+		Param(ws.PathParameter("category", "the asset category").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Assets"}).
+		Returns(200, "Dwell time reset", nil).
+		Returns(500, "Internal Error", nil).
+		Returns(404, "Dwell time not set", nil).
+		DefaultReturns("Dwell time reset", nil))
+
+	ws.Route(ws.DELETE("/plans/{plan-id}").To(r.deletePlan).
+		//docs
+		Doc("Delete the specified inspection plan, keeping the sessions it generated.").
+		Param(ws.PathParameter("plan-id", "the plan's id").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Plans"}).
+		Returns(200, "Plan deleted", nil).
+		Returns(500, "Internal Error", nil).
+		Returns(404, "Plan not found", nil).
+		DefaultReturns("Plan deleted", nil))
+
+	ws.Route(ws.DELETE("/attachments/{attachment-id}").To(r.deleteAttachment).
+		//docs
+		Doc("Delete the attached file and its thumbnail.").
+		Param(ws.PathParameter("attachment-id", "the attachment's id").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, []string{"Assets", "Sessions"}).
+		Returns(200, "Attachment deleted", nil).
+		Returns(500, "Internal Error", nil).
+		Returns(404, "Attachment not found", nil).
+		DefaultReturns("Attachment deleted", nil))
+
 	return ws
 }
 
@@ -279,7 +1053,25 @@ func EnrichSwaggerObject(swo *spec.Swagger) {
 		spec.Tag{TagProps: spec.TagProps{
 			Name: "Spaces",
 			Description: "The layered space objects containing assets, " +
-				"having one 'door' as the base point in it."}}}
+				"having one 'door' as the base point in it."}},
+		spec.Tag{TagProps: spec.TagProps{
+			Name:        "Weight Rules",
+			Description: "Rules computing the assets' sampling weights from their attributes."}},
+		spec.Tag{TagProps: spec.TagProps{
+			Name:        "Sessions",
+			Description: "Inspections tracking the result of every asset on a planned route."}},
+		spec.Tag{TagProps: spec.TagProps{
+			Name:        "Plans",
+			Description: "Recurring inspection plans generating sessions when they fall due."}},
+		spec.Tag{TagProps: spec.TagProps{
+			Name:        "Calendar",
+			Description: "iCalendar feeds of the sessions and plans to subscribe in calendar apps."}},
+		spec.Tag{TagProps: spec.TagProps{
+			Name:        "Reports",
+			Description: "Discrepancy reports summarising the inspection results."}},
+		spec.Tag{TagProps: spec.TagProps{
+			Name:        "Admin",
+			Description: "Maintenance of the data, like checking its consistency."}}}
 	swo.SecurityDefinitions = map[string]*spec.SecurityScheme{
 		"basic": spec.BasicAuth(),
 	}
@@ -360,37 +1152,50 @@ func (r RestContext) uploadCsv(req *restful.Request, resp *restful.Response) {
 	// copy uploaded file to local disk file
 	io.Copy(cur, file)
 
-	// save the checkpoints to Redis
-	cpListPtr, errCode, err := dataio.ReadCsvByPtr(cur)
-	if err != nil {
+	// every row is applied, or none: any row not parsed or not valid aborts the import,
+	// and the rows parsed are checked all the same to list every row aborting it
+	recordListPtr, errCode, err := dataio.ReadCsvRecords(cur)
+	errs := []ImportError{}
+	if parseErr, ok := err.(dataio.ParseError); ok {
+		for _, l := range parseErr.Lines {
+			errs = append(errs, ImportError{Row: l.Line, Message: l.Err.Error()})
+		}
+	} else if err != nil {
 		log.Printf("error during parsing csv file @uploadCsv: %v\n", err)
 		resp.WriteError(errCode, err)
 		return
 	}
 
-	assetList, spaceList := unpack(*cpListPtr)
-	// insert to DB
-	errCode, err = r.dbInsertSpace(spaceList)
+	spaceList, assetList, rows, rowErrs := importRows(*recordListPtr)
+	errs = append(errs, rowErrs...)
+	dbSpaces, dbAssets, errCode, err := r.dbImportExisting(spaceList, assetList)
 	if err != nil {
-		log.Printf("error during storing space to DB @uploadCsv: %v\n", err)
 		resp.WriteError(errCode, err)
 		return
 	}
-	errCode, err = r.dbInsertAsset(assetList)
-	if err != nil {
-		log.Printf("error during storing asset to DB @uploadCsv: %v\n", err)
-		resp.WriteError(errCode, err)
+	if errs = append(errs, importErrors(spaceList, assetList, rows, dbSpaces, dbAssets)...); len(errs) > 0 {
+		sortImportErrors(errs)
+		resp.WriteHeaderAndEntity(importStatus(errs), ImportResult{Errors: errs})
 		return
 	}
 
-	resp.WriteHeaderAndEntity(http.StatusCreated, struct {
-		assetInserted int
-		spaceInserted int
-	}{len(assetList), len(spaceList)})
+	// insert to DB
+	if errs, errCode, err = r.dbImport(spaceList, assetList, rows); err != nil {
+		log.Printf("error during storing to DB @uploadCsv: %v\n", err)
+		if len(errs) == 0 {
+			resp.WriteError(errCode, err)
+			return
+		}
+		resp.WriteHeaderAndEntity(errCode, ImportResult{Errors: errs})
+		return
+	}
+
+	resp.WriteHeaderAndEntity(http.StatusCreated, ImportResult{SpacesInserted: len(spaceList), AssetsInserted: len(assetList)})
 }
 
 // PUT PREFIX/spaces/{space-name}/assets/{asset-name}
-// form: Asset: {name: "A", base: "", rx: 2, ry: 1, weight: 1}
+// form: Asset: {name: "A", base: "", rx: 2, ry: 1, weight: 1, category: "laptop", serial: "", owner: "",
+// purchaseValue: 0, purchaseDate: "2019-07-01T00:00:00Z", attrs: {}}
 func (r RestContext) createAsset(req *restful.Request, resp *restful.Response) {
 	spaceName := req.PathParameter("space-name")
 	assetName := req.PathParameter("asset-name")
@@ -414,6 +1219,10 @@ func (r RestContext) createAsset(req *restful.Request, resp *restful.Response) {
 			"the asset's name or base space provided is in content conflict with the URL"))
 		return
 	}
+	if newAsset.Status != "" && !validStatus(newAsset.Status) {
+		resp.WriteError(http.StatusNotAcceptable, errors.New("unknown status "+newAsset.Status))
+		return
+	}
 
 	if errCode, err := r.dbInsertAsset([]Asset{newAsset}); err != nil {
 		resp.WriteError(errCode, err)
@@ -424,7 +1233,7 @@ func (r RestContext) createAsset(req *restful.Request, resp *restful.Response) {
 }
 
 // PUT PREFIX/spaces/{space-name}
-// Space: {name: "A", base: "", rx: 2, ry: 1}
+// Space: {name: "A", base: "", rx: 2, ry: 1, width: 10, height: 8} or {..., outline: [{x: 0, y: 0}, ...]}
 func (r RestContext) createSpace(req *restful.Request, resp *restful.Response) {
 	spaceName := req.PathParameter("space-name")
 
@@ -480,37 +1289,86 @@ func (r RestContext) findSpace(req *restful.Request, resp *restful.Response) {
 	resp.WriteHeaderAndEntity(http.StatusOK, *resultPtr)
 }
 
-// GET PREFIX/route/spaces/{space-name}?sample-rate=0.xx&init-x=xx&init-y=xx
-func (r RestContext) findRoute(req *restful.Request, resp *restful.Response) {
-	spaceName := req.PathParameter("space-name")
-	qr := req.Request.URL.Query()
-
-	rate, err := strconv.ParseFloat(qr.Get("sample-rate"), 64)
+// parseRouteQuery reads the route planning params shared by the route and session requests
+func parseRouteQuery(spaceName string, qr url.Values) (initPoint Asset, rate float64, policy samplePolicy, err error) {
+	rate, err = strconv.ParseFloat(qr.Get("sample-rate"), 64)
 	if err != nil || rate <= 0 || rate > 1 {
 		// invalid sample rate
-		resp.WriteError(http.StatusNotAcceptable, errors.New("sampling rate out of range"))
-		return
+		return initPoint, rate, policy, errors.New("sampling rate out of range")
 	}
 
 	initx, err := strconv.ParseFloat(qr.Get("init-x"), 64)
 	if err != nil {
-		resp.WriteError(http.StatusNotAcceptable, errors.New("invalid init point's x-value"))
-		return
+		return initPoint, rate, policy, errors.New("invalid init point's x-value")
 	}
 
 	inity, err := strconv.ParseFloat(qr.Get("init-y"), 64)
 	if err != nil {
-		resp.WriteError(http.StatusNotAcceptable, errors.New("invalid init point's y-value"))
+		return initPoint, rate, policy, errors.New("invalid init point's y-value")
+	}
+	initPoint = Asset{Name: "Initial Point", Base: spaceName, Rx: initx, Ry: inity}
+
+	policy = samplePolicy{Now: time.Now()}
+	if qr.Get("boost") != "" {
+		if policy.BoostPerDay, err = strconv.ParseFloat(qr.Get("boost"), 64); err != nil || policy.BoostPerDay < 0 {
+			return initPoint, rate, policy, errors.New("invalid boost ratio")
+		}
+	}
+	if qr.Get("exclude-days") != "" {
+		if policy.ExcludeDays, err = strconv.ParseFloat(qr.Get("exclude-days"), 64); err != nil || policy.ExcludeDays < 0 {
+			return initPoint, rate, policy, errors.New("invalid days to exclude")
+		}
+	}
+
+	if policy.Statuses, err = parseStatuses(qr.Get("statuses")); err != nil {
+		return initPoint, rate, policy, err
+	}
+
+	policy.Speed = WALKING_SPEED
+	if qr.Get("walking-speed") != "" {
+		if policy.Speed, err = strconv.ParseFloat(qr.Get("walking-speed"), 64); err != nil || policy.Speed <= 0 {
+			return initPoint, rate, policy, errors.New("walking speed should be a positive number")
+		}
+	}
+
+	return initPoint, rate, policy, nil
+}
+
+// GET PREFIX/route/spaces/{space-name}?sample-rate=0.xx&init-x=xx&init-y=xx&boost=xx&exclude-days=xx&start=xx&statuses=active&format=json
+func (r RestContext) findRoute(req *restful.Request, resp *restful.Response) {
+	spaceName := req.PathParameter("space-name")
+
+	initPoint, rate, policy, err := parseRouteQuery(spaceName, req.Request.URL.Query())
+	if err != nil {
+		resp.WriteError(http.StatusNotAcceptable, err)
+		return
+	}
+	start, end, err := parseBookingQuery(req.Request.URL.Query())
+	if err != nil {
+		resp.WriteError(http.StatusNotAcceptable, err)
+		return
+	}
+	deferred, errCode, err := r.deferBookedSpaces(spaceName, start, end, &policy)
+	if err != nil {
+		resp.WriteError(errCode, err)
 		return
 	}
 
-	finalRoutePtr, errCode, err := r.calcRoute(Asset{Name: "Initial Point", Base: spaceName, Rx: initx, Ry: inity}, rate)
+	finalRoutePtr, errCode, err := r.calcRoute(initPoint, rate, policy)
 	if err != nil {
 		resp.WriteError(errCode, err)
 		return
 	}
 
-	pic, errCode, err := route.DrawRoute(finalRoutePtr.Sequence)
+	if len(deferred) > 0 { // the occupied rooms left out of the route
+		resp.AddHeader("X-Deferred-Spaces", strings.Join(bookedSpaceNames(deferred), ", "))
+	}
+	if req.QueryParameter("format") == "json" { // with the ETA of every stop
+		resp.WriteHeaderAndEntity(http.StatusOK, *finalRoutePtr)
+		return
+	}
+
+	pic, errCode, err := route.DrawRoute(finalRoutePtr.Sequence, finalRoutePtr.Outlines)
 	if err != nil {
 		resp.WriteError(errCode, err)
 		return
@@ -525,6 +1383,15 @@ func (r RestContext) updateAsset(req *restful.Request, resp *restful.Response) {
 	assetName := req.PathParameter("asset-name")
 	paramQuery := req.Request.URL.Query()
 
+	// a merge patch in the body, see patch.go
+	if raw, err := ioutil.ReadAll(req.Request.Body); err != nil {
+		resp.WriteError(http.StatusNotAcceptable, err)
+		return
+	} else if len(bytes.TrimSpace(raw)) > 0 {
+		r.mergePatchAsset(req, resp, raw)
+		return
+	}
+
 	// check if any param exists
 	params := []string{"rx", "ry", "weight"}
 	exists := []bool{false, false, false}
@@ -537,7 +1404,7 @@ func (r RestContext) updateAsset(req *restful.Request, resp *restful.Response) {
 	}
 
 	// all empty err
-	if !(exists[0] && exists[1] && exists[2]) {
+	if !(exists[0] || exists[1] || exists[2]) {
 		resp.WriteError(http.StatusNotAcceptable, errors.New("no valid query parameter"))
 		return
 	}
@@ -554,6 +1421,26 @@ func (r RestContext) updateAsset(req *restful.Request, resp *restful.Response) {
 		}
 	}
 
+	if exists[0] || exists[1] { // the new position should be inside the base space
+		as, errCode, err := r.dbGetAsset(assetName, spaceName, false)
+		if err != nil {
+			resp.WriteError(errCode, err)
+			return
+		}
+		for _, e := range setParams {
+			switch e.Key {
+			case "rx":
+				as.Rx = e.Value.(float64)
+			case "ry":
+				as.Ry = e.Value.(float64)
+			}
+		}
+		if errCode, err := r.checkPlacement(nil, []Asset{*as}); err != nil {
+			resp.WriteError(errCode, err)
+			return
+		}
+	}
+
 	toSet := bson.D{{"$set", setParams}}
 	newAssetPtr, errCode, err := r.dbUpdateAsset(assetName, spaceName, toSet)
 	if errCode == http.StatusOK {
@@ -606,6 +1493,21 @@ func (r RestContext) showHomePage(req *restful.Request, resp *restful.Response)
 				"description": "Randomly sampling and generated optimal route for checking in the given space",
 				"uri": "/route/space",
 				"operations": ["GET"]
+			}, {
+				"label": "Sessions",
+				"description": "Inspections tracking the result of every asset on a planned route",
+				"uri": "/sessions",
+				"operations": ["GET", "POST", "PUT"]
+			}, {
+				"label": "Plans",
+				"description": "Recurring inspection plans generating sessions when they fall due",
+				"uri": "/plans",
+				"operations": ["GET", "POST", "PUT", "DELETE"]
+			}, {
+				"label": "Reports",
+				"description": "Discrepancy reports summarising the inspection results in the given space",
+				"uri": "/reports/space",
+				"operations": ["GET"]
 			}
 		],
 		"detailed API doc": %s/apidocs.json
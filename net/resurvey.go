@@ -0,0 +1,198 @@
+// Transforming the coordinates in a Space after a resurvey of its floor plan
+
+package net
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// TransformRequest maps the coordinates in the Space around its door: mirrored first, then scaled,
+// rotated, and translated at last
+type TransformRequest struct {
+	Dx       float64 `json:"dx,omitempty" description:"translation along x"`
+	Dy       float64 `json:"dy,omitempty" description:"translation along y"`
+	Scale    float64 `json:"scale,omitempty" description:"the ratio of the new coordinates to the old, 0 for 1" default:"1.0"`
+	Rotation float64 `json:"rotation,omitempty" description:"counter-clockwise degrees to rotate"`
+	MirrorX  bool    `json:"mirrorX,omitempty" description:"mirror across the y axis, as x to -x"`
+	MirrorY  bool    `json:"mirrorY,omitempty" description:"mirror across the x axis, as y to -y"`
+}
+
+// TransformedPoint is an Asset, or the door of a child Space, moved by the transform
+type TransformedPoint struct {
+	Name    string  `json:"name" description:"name of the asset or the child space"`
+	IsSpace bool    `json:"isSpace" description:"whether it is the door of a child space"`
+	FromX   float64 `json:"fromX" description:"the relative x before"`
+	FromY   float64 `json:"fromY" description:"the relative y before"`
+	X       float64 `json:"x" description:"the relative x after"`
+	Y       float64 `json:"y" description:"the relative y after"`
+}
+
+// TransformResult lists the points moved, applied or previewed
+type TransformResult struct {
+	DryRun bool               `json:"dryRun" description:"whether it is only a preview, with nothing written"`
+	Points []TransformedPoint `json:"points" description:"the child spaces, then the assets"`
+	Errors []string           `json:"errors" description:"what would lie out of the space, refusing the transform"`
+}
+
+// transform builds the affine transform asked
+func (q TransformRequest) transform() (Transform, error) {
+	for _, v := range []float64{q.Dx, q.Dy, q.Scale, q.Rotation} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return Transform{}, errors.New("the transform should be in finite numbers")
+		}
+	}
+	if q.Scale < 0 {
+		return Transform{}, errors.New("the scale should be positive")
+	}
+
+	mirror := identityTransform
+	if q.MirrorX {
+		mirror.A = -1
+	}
+	if q.MirrorY {
+		mirror.D = -1
+	}
+	// scaled, rotated and translated as a Space's transform does
+	return mirror.Then(localTransform(Space{Rx: q.Dx, Ry: q.Dy, Rotation: q.Rotation, Scale: q.Scale})), nil
+}
+
+// transformContents moves the doors of the child Spaces and the Assets by the transform, and turns
+// and scales the frames of the child Spaces along, so that their outlines and contents follow; a frame
+// cannot be mirrored, so neither can a child Space with an outline
+func transformContents(children []Space, assetList []Asset, q TransformRequest) (movedSpaces []Space, movedAssets []Asset,
+	points []TransformedPoint, err error) {
+	t, err := q.transform()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	points = make([]TransformedPoint, 0, len(children)+len(assetList))
+	for _, sp := range children {
+		if (q.MirrorX || q.MirrorY) && sp.boundary() != nil {
+			return nil, nil, nil, errors.New("the child space " + sp.Name + " has an outline, which cannot be mirrored")
+		}
+		p := TransformedPoint{Name: sp.Name, IsSpace: true, FromX: sp.Rx, FromY: sp.Ry}
+		p.X, p.Y = t.Apply(sp.Rx, sp.Ry)
+		sp.Rx, sp.Ry = p.X, p.Y
+		sp.Rotation += q.Rotation
+		if q.Scale != 0 {
+			sp.Scale = sp.unitScale() * q.Scale
+		}
+		movedSpaces, points = append(movedSpaces, sp), append(points, p)
+	}
+	for _, as := range assetList {
+		p := TransformedPoint{Name: as.Name, FromX: as.Rx, FromY: as.Ry}
+		p.X, p.Y = t.Apply(as.Rx, as.Ry)
+		as.Rx, as.Ry = p.X, p.Y
+		movedAssets, points = append(movedAssets, as), append(points, p)
+	}
+	return movedSpaces, movedAssets, points, nil
+}
+
+// dbTransformContents writes the new positions in one transaction, then makes the new cache
+func (r RestContext) dbTransformContents(spaceList []Space, assetList []Asset) (errCode int, err error) {
+	errCode, err = r.dbTransaction(30*time.Second, func(ctx mongo.SessionContext) (int, error) {
+		for _, sp := range spaceList {
+			if _, err := r.mongoDB.Collection("space").UpdateOne(ctx, bson.M{"name": sp.Name},
+				bson.M{"$set": bson.M{"rx": sp.Rx, "ry": sp.Ry, "rotation": sp.Rotation, "scale": sp.Scale}}); err != nil {
+				return http.StatusInternalServerError, err
+			}
+		}
+		for _, as := range assetList {
+			if _, err := r.mongoDB.Collection("asset").UpdateOne(ctx, bson.M{"name": as.Name, "base": as.Base},
+				bson.M{"$set": bson.M{"rx": as.Rx, "ry": as.Ry}}); err != nil {
+				return http.StatusInternalServerError, err
+			}
+		}
+		return http.StatusOK, nil
+	})
+	if err != nil {
+		return errCode, err
+	}
+
+	go func() {
+		// update Redis cache
+		redisConn := r.redisConnPool.Get()
+		defer redisConn.Close()
+
+		set := func(k string, v interface{}, expire int) {
+			b, _ := json.Marshal(v)
+			redisConn.Do("SET", k, b)
+			redisConn.Do("EXPIRE", k, expire)
+		}
+		for _, sp := range spaceList {
+			set("space-"+sp.Name, sp, WEEK_SECONDS)
+		}
+		for _, as := range assetList {
+			set(as.Name+"@"+as.Base, as, MONTH_SECONDS)
+		}
+	}()
+	return http.StatusOK, nil
+}
+
+// POST PREFIX/spaces/{space-name}/transform?dry-run=true
+// TransformRequest: {dx: 1, dy: 0, scale: 1, rotation: 90, mirrorX: false, mirrorY: false}
+func (r RestContext) transformSpace(req *restful.Request, resp *restful.Response) {
+	dryRun := false
+	if v := req.QueryParameter("dry-run"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			resp.WriteError(http.StatusNotAcceptable, errors.New("dry-run should be true or false"))
+			return
+		}
+		dryRun = b
+	}
+	var q TransformRequest
+	if err := req.ReadEntity(&q); err != nil {
+		resp.WriteError(http.StatusNotAcceptable, err)
+		return
+	}
+	subtree, errCode, err := r.dbGetSubtreeSpaces(req.PathParameter("space-name"), false)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	root, children := subtree[0], []Space{}
+	for _, sp := range subtree[1:] {
+		if sp.Base == root.Name {
+			children = append(children, sp)
+		}
+	}
+	assetList, errCode, err := r.dbFindAssets(bson.M{"base": root.Name})
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+
+	movedSpaces, movedAssets, points, err := transformContents(children, assetList, q)
+	if err != nil {
+		resp.WriteError(http.StatusNotAcceptable, err)
+		return
+	}
+	result := TransformResult{DryRun: dryRun, Points: points,
+		Errors: placementErrors(movedSpaces, movedAssets, map[string]Space{root.Name: root})}
+	sort.Strings(result.Errors)
+	if dryRun {
+		resp.WriteHeaderAndEntity(http.StatusOK, result)
+		return
+	}
+	if len(result.Errors) > 0 { // should be still inside the Space
+		resp.WriteError(http.StatusNotAcceptable, errors.New(strings.Join(result.Errors, "; ")))
+		return
+	}
+	if errCode, err := r.dbTransformContents(movedSpaces, movedAssets); err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, result)
+}
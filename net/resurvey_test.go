@@ -0,0 +1,95 @@
+package net
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestTransformRequest_transform(t *testing.T) {
+	tests := []struct {
+		name    string
+		q       TransformRequest
+		x, y    float64
+		wantX   float64
+		wantY   float64
+		wantErr bool
+	}{
+		{"nothing", TransformRequest{}, 1, 2, 1, 2, false},
+		{"translate", TransformRequest{Dx: 3, Dy: -1}, 1, 2, 4, 1, false},
+		{"scale", TransformRequest{Scale: 0.01}, 100, 250, 1, 2.5, false},
+		{"rotate", TransformRequest{Rotation: 90}, 1, 2, -2, 1, false},
+		{"mirror x", TransformRequest{MirrorX: true}, 1, 2, -1, 2, false},
+		{"mirror y, then rotate and translate", TransformRequest{MirrorY: true, Rotation: 90, Dx: 10}, 1, 2, 12, 1, false},
+		{"all", TransformRequest{MirrorX: true, Scale: 2, Rotation: 180, Dx: 1, Dy: 1}, 1, 2, 3, -3, false},
+		{"negative scale", TransformRequest{Scale: -1}, 0, 0, 0, 0, true},
+		{"infinite", TransformRequest{Dx: math.Inf(1)}, 0, 0, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := tt.q.transform()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TransformRequest.transform() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if x, y := tr.Apply(tt.x, tt.y); !near(x, tt.wantX) || !near(y, tt.wantY) {
+				t.Errorf("TransformRequest.transform() maps to (%v, %v), want (%v, %v)", x, y, tt.wantX, tt.wantY)
+			}
+		})
+	}
+}
+
+func Test_transformContents(t *testing.T) {
+	children := []Space{{Name: "room", Base: "floor", Rx: 1, Ry: 0, Rotation: 30}}
+	assetList := []Asset{{Name: "A", Base: "floor", Rx: 0, Ry: 2, Weight: 1}}
+
+	spaces, assets, points, err := transformContents(children, assetList, TransformRequest{Dx: 5, Dy: 5})
+	if err != nil {
+		t.Fatalf("transformContents() error = %v", err)
+	}
+	if want := []Space{{Name: "room", Base: "floor", Rx: 6, Ry: 5, Rotation: 30}}; !reflect.DeepEqual(spaces, want) {
+		t.Errorf("transformContents() spaces = %v, want %v", spaces, want)
+	}
+	if want := []Asset{{Name: "A", Base: "floor", Rx: 5, Ry: 7, Weight: 1}}; !reflect.DeepEqual(assets, want) {
+		t.Errorf("transformContents() assets = %v, want %v", assets, want)
+	}
+	wantPoints := []TransformedPoint{
+		{Name: "room", IsSpace: true, FromX: 1, FromY: 0, X: 6, Y: 5},
+		{Name: "A", FromX: 0, FromY: 2, X: 5, Y: 7},
+	}
+	if !reflect.DeepEqual(points, wantPoints) {
+		t.Errorf("transformContents() points = %v, want %v", points, wantPoints)
+	}
+	if children[0].Rx != 1 || assetList[0].Ry != 2 {
+		t.Errorf("transformContents() changed the originals")
+	}
+}
+
+func Test_transformContents_frames(t *testing.T) {
+	room := Space{Name: "room", Base: "floor", Rx: 1, Ry: 1, Rotation: 30, Scale: 0.01, Width: 200, Height: 100}
+	q := TransformRequest{Rotation: 90, Scale: 2}
+
+	spaces, _, _, err := transformContents([]Space{room}, nil, q)
+	if err != nil {
+		t.Fatalf("transformContents() error = %v", err)
+	}
+	if spaces[0].Rotation != 120 || math.Abs(spaces[0].Scale-0.02) > 1e-12 {
+		t.Errorf("transformContents() rotation, scale = %v, %v, want 120, 0.02", spaces[0].Rotation, spaces[0].Scale)
+	}
+	// the far corner of the room follows the floor's transform
+	tr, _ := q.transform()
+	wantX, wantY := tr.Apply(localTransform(room).Apply(200, 100))
+	if x, y := localTransform(spaces[0]).Apply(200, 100); math.Abs(x-wantX) > 1e-9 || math.Abs(y-wantY) > 1e-9 {
+		t.Errorf("transformContents() corner = (%v, %v), want (%v, %v)", x, y, wantX, wantY)
+	}
+
+	if _, _, _, err := transformContents([]Space{room}, nil, TransformRequest{MirrorX: true}); err == nil {
+		t.Errorf("transformContents() mirrored a space with an outline")
+	}
+	door := Space{Name: "closet", Base: "floor", Rx: 1, Ry: 1}
+	if _, _, _, err := transformContents([]Space{door}, nil, TransformRequest{MirrorY: true}); err != nil {
+		t.Errorf("transformContents() error = %v for a space without an outline", err)
+	}
+}
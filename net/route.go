@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"sync"
 
 	"github.com/gomodule/redigo/redis"
@@ -22,14 +23,15 @@ type spaceNaviNode struct {
 	Assets      []Asset
 	route       dataio.Route
 	circuitFlag bool
+	frame       Transform // maps the coordinates in the space to the master root's
 }
 
 var (
 	wgTSP         sync.WaitGroup
 	masterRootPtr *spaceNaviNode
 	naviNodeIndex map[string]*spaceNaviNode // checkpoint type of Space -> spaceNaviNode (since the name of Space is unique)
-	allAssets     []Asset
 	initStand     Asset
+	routeMutex    sync.Mutex // the route planning states above are shared, one planning at a time
 )
 
 // post-order traversal to sample and dispatch routing task
@@ -109,109 +111,216 @@ func (r RestContext) recursiveSampleTSP(rootPtr *spaceNaviNode) bool { // T/F :
 	return true
 }
 
-func (r RestContext) calcRoute(initPoint Asset, sampleRate float64) (finalRoutePtr *dataio.Route, errCode int, err error) {
+// buildNaviTree finds the space tree under the init point's base space, indexed by naviNodeIndex
+func (r RestContext) buildNaviTree(initPoint Asset) (errCode int, err error) {
 	initStand = initPoint
 	naviNodeIndex = make(map[string]*spaceNaviNode)
-	allAssets = []Asset{}
 
-	resultPtr, errCode, err := r.dbGetSpace(initStand.Base, true)
+	spaceList, errCode, err := r.dbGetSubtreeSpaces(initStand.Base, true)
 	if err != nil {
 		log.Println(err)
-		return nil, errCode, err
+		return errCode, err
 	}
 
+	// the spaces come in BFS order, so the parent is always indexed before its subspaces
 	masterRootPtr = &spaceNaviNode{
-		root:        *resultPtr,
+		root:        spaceList[0],
 		circuitFlag: false,
+		frame:       identityTransform, // the route is in the master root's coordinates
 	}
-	bfsQueue := make([]*spaceNaviNode, 0)
-	bfsQueue = append(bfsQueue, masterRootPtr) // insert root node
 	naviNodeIndex[masterRootPtr.root.Name] = masterRootPtr
+	for _, sp := range spaceList[1:] {
+		parentNode := naviNodeIndex[sp.Base]
+		newNaviNode := spaceNaviNode{root: sp, circuitFlag: true, // circuit for subspaces, need to return
+			frame: localTransform(sp).Then(parentNode.frame)}
+		parentNode.subspaces = append(parentNode.subspaces, &newNaviNode)
+		naviNodeIndex[sp.Name] = &newNaviNode
+	}
 
-	// BFS search tree
-	for len(bfsQueue) > 0 {
-		// read from head
-		rootNode := bfsQueue[0]
-		bfsQueue = bfsQueue[1:]
+	return http.StatusOK, nil
+}
 
-		//ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
-		//defer cf()
-		ctx := context.Background()
+// calcRoute samples the Assets under the init point's base space by the rate and policy,
+// and plans the route to check them
+func (r RestContext) calcRoute(initPoint Asset, sampleRate float64, policy samplePolicy) (finalRoutePtr *dataio.Route, errCode int, err error) {
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
 
-		// find subspaces
-		cur, err := r.mongoDB.Collection("space").Find(ctx, bson.M{"base": rootNode.root.Name})
-		if err != nil {
-			log.Println(err)
-			return nil, http.StatusInternalServerError, err
+	if errCode, err = r.buildNaviTree(initPoint); err != nil {
+		return nil, errCode, err
+	}
+
+	// the spaces in the tree, looked up by the weighting rules
+	policy.Spaces = make(map[string]Space, len(naviNodeIndex))
+	for name, node := range naviNodeIndex {
+		policy.Spaces[name] = node.root
+	}
+
+	// sampling, streaming the Assets of the whole tree in the statuses to sample
+	// through the reservoir, except those deferred in the occupied spaces
+	ctx := context.Background()
+	baseNames := make([]string, 0, len(naviNodeIndex))
+	for name := range naviNodeIndex {
+		if !deferredSpace(name, masterRootPtr.root.Name, policy.Spaces, policy.Deferred) {
+			baseNames = append(baseNames, name)
 		}
-		for cur.Next(ctx) {
-			var sp Space
-			err = cur.Decode(&sp)
-			if err != nil {
-				log.Println(err)
-				return nil, http.StatusInternalServerError, err
-			}
-			newNaviNode := spaceNaviNode{root: sp, circuitFlag: true} // circuit for subspaces, need to return
-			rootNode.subspaces = append(rootNode.subspaces, &newNaviNode)
-			naviNodeIndex[sp.Name] = &newNaviNode
-			bfsQueue = append(bfsQueue, &newNaviNode)
+	}
+	assetFilter := bson.M{"$and": []bson.M{
+		{"base": bson.M{"$in": baseNames}}, statusFilter(policy.sampleStatuses())}}
+	N, err := r.mongoDB.Collection("asset").CountDocuments(ctx, assetFilter)
+	if err != nil {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, err
+	}
+
+	// weighting rules
+	if policy.Rules, errCode, err = r.dbGetWeightRules(); err != nil {
+		return nil, errCode, err
+	}
+	if len(policy.Rules) > 0 {
+		if errCode, err = r.addAncestors(policy.Spaces, masterRootPtr.root.Name); err != nil {
+			return nil, errCode, err
 		}
+	}
 
-		// find Assets of this space
-		cur, err = r.mongoDB.Collection("asset").Find(ctx, bson.M{"base": rootNode.root.Name})
+	// campaign mode: a share of the uncovered Assets must be sampled in this round
+	// counting only the ones to be sampled, not the excluded or weightless
+	if policy.Campaign, _, err = r.dbFindCampaign(masterRootPtr.root.Name); err == nil {
+		cur, err := r.mongoDB.Collection("asset").Find(ctx,
+			bson.M{"$and": []bson.M{assetFilter, uncoveredFilter(policy.Campaign.Start)}})
 		if err != nil {
 			log.Println(err)
 			return nil, http.StatusInternalServerError, err
 		}
-		for cur.Next(ctx) {
-			var as Asset
-			err = cur.Decode(&as)
-			if err != nil {
-				log.Println(err)
-				return nil, http.StatusInternalServerError, err
-			}
-			allAssets = append(allAssets, as)
+		uncovered, err := countUncovered(ctx, cur, policy)
+		cur.Close(ctx)
+		if err != nil {
+			log.Println(err)
+			return nil, http.StatusInternalServerError, err
 		}
+		policy.Quota = campaignQuota(uncovered, *policy.Campaign)
+	}
+
+	cur, err := r.mongoDB.Collection("asset").Find(ctx, assetFilter)
+	if err != nil {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, err
 	}
+	defer cur.Close(ctx)
 
-	// sampling
-	filteredIndexList := sample(allAssets, sampleRate)
-	if len(filteredIndexList) == 0 {
+	sampledList, err := sampleStream(ctx, cur, sampleSize(int(N), sampleRate), policy)
+	if err != nil {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, err
+	}
+	if len(sampledList) == 0 {
 		return nil, http.StatusNotAcceptable, errors.New("empty set after sampling")
 	}
 
-	for _, index := range filteredIndexList {
-		// distributing seleted Assets
-		baseNode, _ := naviNodeIndex[allAssets[index].Base]
-		baseNode.Assets = append(baseNode.Assets, allAssets[index])
+	return r.planRoute(sampledList, policy.Speed)
+}
+
+// calcFixedRoute plans the route to check the given Assets under the init point's base space,
+// estimating the ETAs at the walking speed
+func (r RestContext) calcFixedRoute(initPoint Asset, assetList []Asset, speed float64) (finalRoutePtr *dataio.Route, errCode int, err error) {
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+
+	if errCode, err = r.buildNaviTree(initPoint); err != nil {
+		return nil, errCode, err
+	}
+	if len(assetList) == 0 {
+		return nil, http.StatusNotAcceptable, errors.New("no asset to plan the route for")
 	}
 
-	r.recursiveSampleTSP(masterRootPtr) // TSP bottom to up
-	wgTSP.Wait()                        // until all computations compelete
+	return r.planRoute(assetList, speed)
+}
+
+// routeOutlines moves the outlines of the spaces in the tree built to the root's coordinates, like the route
+func routeOutlines() []dataio.Outline {
+	names := make([]string, 0, len(naviNodeIndex))
+	for name := range naviNodeIndex {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	outlines := []dataio.Outline{}
+	for _, name := range names {
+		node := naviNodeIndex[name]
+		if node.root.boundary() == nil {
+			continue
+		}
+		outlines = append(outlines, outlineOf(node.root, node.frame))
+	}
+	return outlines
+}
 
-	// traversal the tree & link route
-	finalDistance := masterRootPtr.route.Distance
-	finalSeq := masterRootPtr.route.Sequence // violent to the def of spaceNaviNode.route, but doesn't matter
-	rootNodeStk := []string{}                // a stack to trace the root nodes
+// linkRoutes traverses the tree, and links the route of every subspace into the master root's
+// where its portal is, mapped to the master root's coordinates
+func linkRoutes() (finalSeq []dataio.Checkpoint, finalDistance float64) {
+	finalDistance = masterRootPtr.route.Distance
+	finalSeq = masterRootPtr.route.Sequence // violent to the def of spaceNaviNode.route, but doesn't matter
+	rootNodeStk := []string{}               // a stack to trace the root nodes
 
 	for i := 0; i < len(finalSeq); i++ {
 		if finalSeq[i].IsPortal { // 0: the init point
 			if len(rootNodeStk) == 0 || rootNodeStk[len(rootNodeStk)-1] != finalSeq[i].Name { // a new subnode, insert its subsequence
 				rootNodeStk = append(rootNodeStk, finalSeq[i].Name) //push
 				subSpaceNavi, _ := naviNodeIndex[finalSeq[i].Name]
-				for j := 0; j < len(subSpaceNavi.route.Sequence); j++ {
-					subSpaceNavi.route.Sequence[j].Rx += subSpaceNavi.root.Rx
-					subSpaceNavi.route.Sequence[j].Ry += subSpaceNavi.root.Ry // violent to the def of relative position, but doesn't matter
+				for j := 0; j < len(subSpaceNavi.route.Sequence); j++ { // planned in the subspace's own coordinates
+					cp := &subSpaceNavi.route.Sequence[j]
+					cp.Rx, cp.Ry = subSpaceNavi.frame.Apply(cp.Rx, cp.Ry) // violent to the def of relative position, but doesn't matter
 				}
 				//subSpaceNavi.route[0] is the space portal itself, should be removed in case of merging
 				finalSeq = append(finalSeq[:i+1], append(subSpaceNavi.route.Sequence[1:], finalSeq[i+1:]...)...)
-				finalDistance += subSpaceNavi.route.Distance
+				finalDistance += subSpaceNavi.route.Distance * subSpaceNavi.frame.Scale()
 			} else { // meet again
 				rootNodeStk = rootNodeStk[:len(rootNodeStk)-1] //pop
 				continue
 			}
 		}
 	}
+	return finalSeq, finalDistance
+}
+
+// planRoute distributes the Assets to their base spaces in the tree built,
+// solves TSP in every space, links the routes together and estimates the ETAs
+func (r RestContext) planRoute(assetList []Asset, speed float64) (finalRoutePtr *dataio.Route, errCode int, err error) {
+	for _, as := range assetList {
+		// distributing seleted Assets
+		baseNode, ok := naviNodeIndex[as.Base]
+		if !ok {
+			return nil, http.StatusConflict, errors.New("asset " + as.Name + "@" + as.Base + " is not under the root space")
+		}
+		baseNode.Assets = append(baseNode.Assets, as)
+	}
+
+	r.recursiveSampleTSP(masterRootPtr) // TSP bottom to up
+	wgTSP.Wait()                        // until all computations compelete
+
+	finalSeq, finalDistance := linkRoutes()
+	finalRoutePtr = &dataio.Route{Sequence: finalSeq, Distance: finalDistance, Outlines: routeOutlines()}
+
+	// ETA, by the speed factors of the spaces and the dwell time of the Assets
+	dwellTimes, errCode, err := r.dbGetDwellTimes()
+	if err != nil {
+		return nil, errCode, err
+	}
+	categories := make(map[string]float64, len(dwellTimes))
+	for _, dt := range dwellTimes {
+		categories[dt.Category] = dt.Seconds
+	}
+	cfg := etaConfig{
+		Speed:   speed,
+		Factors: make(map[string]float64, len(naviNodeIndex)),
+		Dwell:   make(map[string]float64, len(assetList))}
+	for name, node := range naviNodeIndex {
+		cfg.Factors[name] = node.root.SpeedFactor
+	}
+	for _, as := range assetList {
+		cfg.Dwell[as.Name+"@"+as.Base] = dwellOf(as, categories)
+	}
+	estimateETA(finalRoutePtr, cfg)
 
-	return &dataio.Route{Sequence: finalSeq, Distance: finalDistance}, http.StatusOK, nil
+	return finalRoutePtr, http.StatusOK, nil
 }
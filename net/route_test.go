@@ -4,6 +4,7 @@ import (
 	"math"
 	"reflect"
 	"testing"
+	"time"
 
 	. "github.com/miosolo/readygo/io"
 )
@@ -18,6 +19,7 @@ func TestRestContext_calcRoute(t *testing.T) {
 		r                 RestContext
 		args              args
 		wantFinalRoutePtr *Route
+		wantDuration      float64
 		wantErrCode       int
 		wantErr           bool
 	}{{
@@ -39,7 +41,8 @@ func TestRestContext_calcRoute(t *testing.T) {
 				Checkpoint{Name: "B", Base: "base", Rx: 3, Ry: 1, IsPortal: false, Weight: 1},
 				Checkpoint{Name: "C", Base: "base", Rx: 4, Ry: 0, IsPortal: false, Weight: 1}},
 			Distance: 2 + 4*math.Sqrt(2)},
-		wantErrCode: 200,
+		wantDuration: (2+4*math.Sqrt(2))/WALKING_SPEED + 4*DEFAULT_DWELL_SECONDS,
+		wantErrCode:  200,
 		wantErr:     false}}
 
 	RCTest.InitEnv()
@@ -58,11 +61,20 @@ func TestRestContext_calcRoute(t *testing.T) {
 			if err := tt.r.InitEnv(); err != nil {
 				panic("err initializing env")
 			}
-			gotFinalRoutePtr, gotErrCode, err := tt.r.calcRoute(tt.args.initPoint, tt.args.sampleRate)
+			gotFinalRoutePtr, gotErrCode, err := tt.r.calcRoute(tt.args.initPoint, tt.args.sampleRate, samplePolicy{Now: time.Now()})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("RestContext.calcRoute() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if gotFinalRoutePtr != nil { // the ETAs are checked by the total duration
+				if math.Abs(gotFinalRoutePtr.Duration-tt.wantDuration) > 1e-9 {
+					t.Errorf("RestContext.calcRoute() duration = %v, want %v", gotFinalRoutePtr.Duration, tt.wantDuration)
+				}
+				gotFinalRoutePtr.Duration = 0
+				for i := range gotFinalRoutePtr.Sequence {
+					gotFinalRoutePtr.Sequence[i].ETA, gotFinalRoutePtr.Sequence[i].Dwell = 0, 0
+				}
+			}
 			if !reflect.DeepEqual(gotFinalRoutePtr, tt.wantFinalRoutePtr) {
 				t.Errorf("RestContext.calcRoute() gotFinalRoutePtr = %v, want %v", gotFinalRoutePtr, tt.wantFinalRoutePtr)
 			}
@@ -74,3 +86,50 @@ func TestRestContext_calcRoute(t *testing.T) {
 
 	RCTest.dbDeleteSpace("base")
 }
+
+func Test_linkRoutes(t *testing.T) {
+	base := Space{Name: "base"}
+	wing := Space{Name: "wing", Base: "base", Rx: 2, Ry: 2, Rotation: 90}
+	room := Space{Name: "room", Base: "wing", Rx: 1, Ry: 0, Scale: 0.5}
+
+	// the routes as planned by TSP, each in its own space's coordinates
+	masterRootPtr = &spaceNaviNode{root: base, frame: identityTransform, route: Route{
+		Sequence: []Checkpoint{
+			{Name: "init point", Base: "base"},
+			{Name: "A", Base: "base", Rx: 1, Ry: 1, Weight: 1},
+			{Name: "wing", Base: "base", Rx: 2, Ry: 2, IsPortal: true}},
+		Distance: 2 * math.Sqrt2}}
+	wingNode := &spaceNaviNode{root: wing, circuitFlag: true, frame: localTransform(wing), route: Route{
+		Sequence: []Checkpoint{
+			{Name: "wing", Base: "base", IsPortal: true},
+			{Name: "room", Base: "wing", Rx: 1, Ry: 0, IsPortal: true},
+			{Name: "wing", Base: "base", IsPortal: true}},
+		Distance: 2}}
+	roomNode := &spaceNaviNode{root: room, circuitFlag: true, frame: localTransform(room).Then(wingNode.frame), route: Route{
+		Sequence: []Checkpoint{
+			{Name: "room", Base: "wing", IsPortal: true},
+			{Name: "D", Base: "room", Rx: 2, Ry: 0, Weight: 1},
+			{Name: "room", Base: "wing", IsPortal: true}},
+		Distance: 4}}
+	naviNodeIndex = map[string]*spaceNaviNode{"base": masterRootPtr, "wing": wingNode, "room": roomNode}
+
+	want := []Checkpoint{
+		{Name: "init point", Base: "base"},
+		{Name: "A", Base: "base", Rx: 1, Ry: 1, Weight: 1},
+		{Name: "wing", Base: "base", Rx: 2, Ry: 2, IsPortal: true},
+		{Name: "room", Base: "wing", Rx: 2, Ry: 3, IsPortal: true},
+		{Name: "D", Base: "room", Rx: 2, Ry: 4, Weight: 1}, // 2 levels down, rotated and scaled
+		{Name: "room", Base: "wing", Rx: 2, Ry: 3, IsPortal: true},
+		{Name: "wing", Base: "base", Rx: 2, Ry: 2, IsPortal: true}}
+
+	gotSeq, gotDistance := linkRoutes()
+	for i := range gotSeq { // rounding off the errors of the rotation
+		gotSeq[i].Rx, gotSeq[i].Ry = math.Round(gotSeq[i].Rx*1e9)/1e9, math.Round(gotSeq[i].Ry*1e9)/1e9
+	}
+	if !reflect.DeepEqual(gotSeq, want) {
+		t.Errorf("linkRoutes() = %v, want %v", gotSeq, want)
+	}
+	if wantDistance := 2*math.Sqrt2 + 2 + 2; math.Abs(gotDistance-wantDistance) > 1e-9 {
+		t.Errorf("linkRoutes() distance = %v, want %v", gotDistance, wantDistance)
+	}
+}
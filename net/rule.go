@@ -0,0 +1,338 @@
+// Rule-based dynamic sampling weights computed from the attributes of Assets
+
+package net
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+MongoDB collection structure:
+readygo(DB): {
+	WeightRule(Collection): {
+		id: "",
+		field: "",
+		op: "",
+		value: "",
+		set: 0,
+		factor: 0
+	}
+}*/
+
+// WeightRule sets or scales the sampling weight of the Assets matching its condition,
+// like category = laptop -> set 3, or space.public = true -> factor 1.5
+type WeightRule struct {
+	ID     string  `json:"id" description:"unique id of the rule"`
+	Field  string  `json:"field" description:"the asset field or attribute to test; space.xxx for its base space's, or the nearest ancestor's having it"`
+	Op     string  `json:"op" description:"one of =, !=, >, >=, <, <=" default:"="`
+	Value  string  `json:"value" description:"the value to compare with, numerically if both are numbers"`
+	Set    float64 `json:"set" description:"the weight to set when matched, 0 for keeping it"`
+	Factor float64 `json:"factor" description:"the ratio to multiply when matched, 0 for keeping it"`
+}
+
+// WeightPreview shows the effective weight of an Asset under the rules
+type WeightPreview struct {
+	Name      string   `json:"name" description:"the asset's name"`
+	Base      string   `json:"base" description:"the asset's base space"`
+	Weight    float64  `json:"weight" description:"the weight typed in"`
+	Effective float64  `json:"effective" description:"the weight computed by the rules"`
+	Matched   []string `json:"matched" description:"ids of the matched rules"`
+}
+
+// validate checks the rule is well-formed
+func (rule WeightRule) validate() error {
+	switch {
+	case rule.ID == "":
+		return errors.New("rule id cannot be empty")
+	case rule.Field == "":
+		return errors.New("rule field cannot be empty")
+	case rule.Set < 0 || rule.Factor < 0:
+		return errors.New("rule weight and factor cannot be negative")
+	case rule.Set == 0 && rule.Factor == 0:
+		return errors.New("rule should either set or scale the weight")
+	}
+	switch rule.Op {
+	case "=", "!=", ">", ">=", "<", "<=":
+		return nil
+	default:
+		return errors.New("unsupported rule operator " + rule.Op)
+	}
+}
+
+// assetField looks up the field of the Asset as a string, and the attributes of
+// its base space by the "space." prefix, inherited from the ancestors with the nearest winning
+func assetField(as Asset, spaces map[string]Space, field string) (value string, ok bool) {
+	if strings.HasPrefix(field, "space.") {
+		field = strings.TrimPrefix(field, "space.")
+		if field == "name" {
+			return spaces[as.Base].Name, true
+		}
+		// at most once through all the spaces, in case of a cycle
+		name := as.Base
+		for i := 0; i < len(spaces); i++ {
+			sp, ok := spaces[name]
+			if !ok {
+				break
+			}
+			if value, ok = sp.Attrs[field]; ok {
+				return value, true
+			}
+			name = sp.Base
+		}
+		return "", false
+	}
+
+	switch field {
+	case "name":
+		return as.Name, true
+	case "base":
+		return as.Base, true
+	case "rx":
+		return strconv.FormatFloat(as.Rx, 'f', -1, 64), true
+	case "ry":
+		return strconv.FormatFloat(as.Ry, 'f', -1, 64), true
+	case "weight":
+		return strconv.FormatFloat(as.Weight, 'f', -1, 64), true
+	case "category":
+		value = as.category()
+		return value, value != ""
+	case "serial":
+		return as.Serial, as.Serial != ""
+	case "owner":
+		return as.Owner, as.Owner != ""
+	case "purchaseValue":
+		return strconv.FormatFloat(as.PurchaseValue, 'f', -1, 64), as.PurchaseValue != 0
+	}
+	value, ok = as.Attrs[field]
+	return value, ok
+}
+
+// match tests the rule's condition on the Asset, with the spaces by name for the space fields
+func (rule WeightRule) match(as Asset, spaces map[string]Space) bool {
+	value, ok := assetField(as, spaces, rule.Field)
+	if !ok {
+		return false
+	}
+
+	lhs, lErr := strconv.ParseFloat(value, 64)
+	rhs, rErr := strconv.ParseFloat(rule.Value, 64)
+	if lErr != nil || rErr != nil { // compare as strings
+		switch rule.Op {
+		case "=":
+			return value == rule.Value
+		case "!=":
+			return value != rule.Value
+		}
+		return false
+	}
+
+	switch rule.Op {
+	case "=":
+		return lhs == rhs
+	case "!=":
+		return lhs != rhs
+	case ">":
+		return lhs > rhs
+	case ">=":
+		return lhs >= rhs
+	case "<":
+		return lhs < rhs
+	case "<=":
+		return lhs <= rhs
+	}
+	return false
+}
+
+// applyRules computes the effective weight of the Asset: the matched rules setting
+// the weight go first (the latter wins), then the factors of all matched ones multiply
+func applyRules(rules []WeightRule, as Asset, spaces map[string]Space) (weight float64, matched []string) {
+	weight = as.Weight
+	matched = []string{}
+	for _, rule := range rules {
+		if rule.Set > 0 && rule.match(as, spaces) {
+			weight = rule.Set
+			matched = append(matched, rule.ID)
+		}
+	}
+	for _, rule := range rules {
+		if rule.Factor > 0 && rule.match(as, spaces) {
+			weight *= rule.Factor
+			if rule.Set == 0 {
+				matched = append(matched, rule.ID)
+			}
+		}
+	}
+	return weight, matched
+}
+
+// dbGetWeightRules finds all the weight rules, ordered by id
+func (r RestContext) dbGetWeightRules() (rules []WeightRule, errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+
+	cur, err := r.mongoDB.Collection("weightrule").Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{"id", 1}}))
+	if err != nil {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, err
+	}
+	defer cur.Close(ctx)
+
+	rules = []WeightRule{}
+	for cur.Next(ctx) {
+		var rule WeightRule
+		if err = cur.Decode(&rule); err != nil {
+			log.Println(err)
+			return nil, http.StatusInternalServerError, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, http.StatusOK, nil
+}
+
+// dbUpsertWeightRule creates the rule or replaces the one with the same id
+func (r RestContext) dbUpsertWeightRule(rule WeightRule) (errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+
+	if _, err = r.mongoDB.Collection("weightrule").ReplaceOne(ctx, bson.M{"id": rule.ID}, rule,
+		options.Replace().SetUpsert(true)); err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// dbDeleteWeightRule deletes the rule by id
+func (r RestContext) dbDeleteWeightRule(id string) (errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+
+	deleteResult, err := r.mongoDB.Collection("weightrule").DeleteOne(ctx, bson.M{"id": id})
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, err
+	}
+	if deleteResult.DeletedCount == 0 {
+		return http.StatusNotFound, errors.New("the rule specified does not exist")
+	}
+	return http.StatusOK, nil
+}
+
+// GET PREFIX/weight-rules
+func (r RestContext) findWeightRules(req *restful.Request, resp *restful.Response) {
+	rules, errCode, err := r.dbGetWeightRules()
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, rules)
+}
+
+// PUT PREFIX/weight-rules/{rule-id}
+// WeightRule: {id: "laptop", field: "category", op: "=", value: "laptop", set: 3}
+func (r RestContext) putWeightRule(req *restful.Request, resp *restful.Response) {
+	var rule WeightRule
+	if err := req.ReadEntity(&rule); err != nil {
+		resp.WriteError(http.StatusNotAcceptable, err)
+		return
+	}
+	if rule.ID != req.PathParameter("rule-id") {
+		resp.WriteError(http.StatusNotAcceptable, errors.New(
+			"the rule's id provided is in content conflict with the URL"))
+		return
+	}
+	if err := rule.validate(); err != nil {
+		resp.WriteError(http.StatusNotAcceptable, err)
+		return
+	}
+
+	if errCode, err := r.dbUpsertWeightRule(rule); err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, rule)
+}
+
+// DELETE PREFIX/weight-rules/{rule-id}
+func (r RestContext) deleteWeightRule(req *restful.Request, resp *restful.Response) {
+	if errCode, err := r.dbDeleteWeightRule(req.PathParameter("rule-id")); err != nil {
+		resp.WriteError(errCode, err)
+	} else {
+		resp.WriteHeader(http.StatusOK)
+	}
+}
+
+// addAncestors adds the ancestors above the root to the spaces, for the space fields inherited from them
+func (r RestContext) addAncestors(spaces map[string]Space, root string) (errCode int, err error) {
+	ancestors, errCode, err := r.dbGetAncestors(root)
+	if err != nil {
+		return errCode, err
+	}
+	for _, sp := range ancestors[1:] {
+		spaces[sp.Name] = sp
+	}
+	return http.StatusOK, nil
+}
+
+// GET PREFIX/weight-rules/preview/{space-name}
+func (r RestContext) previewWeightRules(req *restful.Request, resp *restful.Response) {
+	rules, errCode, err := r.dbGetWeightRules()
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+
+	spaceList, errCode, err := r.dbGetSubtreeSpaces(req.PathParameter("space-name"), true)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	spaceIndex := make(map[string]Space)
+	baseNames := make([]string, 0, len(spaceList))
+	for _, sp := range spaceList {
+		spaceIndex[sp.Name] = sp
+		baseNames = append(baseNames, sp.Name)
+	}
+	if errCode, err := r.addAncestors(spaceIndex, spaceList[0].Name); err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+
+	ctx, cf := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cf()
+	cur, err := r.mongoDB.Collection("asset").Find(ctx, bson.M{"base": bson.M{"$in": baseNames}})
+	if err != nil {
+		log.Println(err)
+		resp.WriteError(http.StatusInternalServerError, err)
+		return
+	}
+	defer cur.Close(ctx)
+
+	previewList := []WeightPreview{}
+	for cur.Next(ctx) {
+		var as Asset
+		if err = cur.Decode(&as); err != nil {
+			log.Println(err)
+			resp.WriteError(http.StatusInternalServerError, err)
+			return
+		}
+		weight, matched := applyRules(rules, as, spaceIndex)
+		previewList = append(previewList, WeightPreview{
+			Name:      as.Name,
+			Base:      as.Base,
+			Weight:    as.Weight,
+			Effective: weight,
+			Matched:   matched})
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, previewList)
+}
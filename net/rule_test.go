@@ -0,0 +1,123 @@
+package net
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWeightRule_match(t *testing.T) {
+	laptop := Asset{Name: "A", Base: "lobby", Weight: 1, Attrs: map[string]string{"category": "laptop", "value": "6000"}}
+	spaces := map[string]Space{"lobby": {Name: "lobby", Attrs: map[string]string{"public": "true"}}}
+	tests := []struct {
+		name string
+		rule WeightRule
+		want bool
+	}{
+		{"string equal", WeightRule{Field: "category", Op: "=", Value: "laptop"}, true},
+		{"string not equal", WeightRule{Field: "category", Op: "!=", Value: "laptop"}, false},
+		{"string ordering", WeightRule{Field: "category", Op: ">", Value: "a"}, false},
+		{"number greater", WeightRule{Field: "value", Op: ">", Value: "5000"}, true},
+		{"number less", WeightRule{Field: "value", Op: "<=", Value: "5000"}, false},
+		{"number equal in format", WeightRule{Field: "weight", Op: "=", Value: "1.0"}, true},
+		{"space attribute", WeightRule{Field: "space.public", Op: "=", Value: "true"}, true},
+		{"space name", WeightRule{Field: "space.name", Op: "=", Value: "lobby"}, true},
+		{"missing attribute", WeightRule{Field: "owner", Op: "!=", Value: "bob"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.match(laptop, spaces); got != tt.want {
+				t.Errorf("WeightRule.match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_applyRules(t *testing.T) {
+	rules := []WeightRule{
+		WeightRule{ID: "expensive", Field: "value", Op: ">", Value: "5000", Factor: 2},
+		WeightRule{ID: "laptop", Field: "category", Op: "=", Value: "laptop", Set: 3},
+		WeightRule{ID: "public", Field: "space.public", Op: "=", Value: "true", Factor: 1.5},
+	}
+	tests := []struct {
+		name        string
+		asset       Asset
+		spaces      map[string]Space
+		wantWeight  float64
+		wantMatched []string
+	}{{
+		name:        "no match",
+		asset:       Asset{Name: "A", Base: "office", Weight: 2},
+		spaces:      map[string]Space{"office": {Name: "office"}},
+		wantWeight:  2,
+		wantMatched: []string{},
+	}, {
+		name:        "set then scale",
+		asset:       Asset{Name: "A", Base: "office", Weight: 1, Attrs: map[string]string{"category": "laptop", "value": "6000"}},
+		spaces:      map[string]Space{"office": {Name: "office"}},
+		wantWeight:  6,
+		wantMatched: []string{"laptop", "expensive"},
+	}, {
+		name:        "scale twice",
+		asset:       Asset{Name: "A", Base: "lobby", Weight: 1, Attrs: map[string]string{"value": "6000"}},
+		spaces:      map[string]Space{"lobby": {Name: "lobby", Attrs: map[string]string{"public": "true"}}},
+		wantWeight:  3,
+		wantMatched: []string{"expensive", "public"},
+	}, {
+		name:  "inherited from the ancestors",
+		asset: Asset{Name: "A", Base: "cabinet", Weight: 1},
+		spaces: map[string]Space{
+			"cabinet":  {Name: "cabinet", Base: "lobby"},
+			"lobby":    {Name: "lobby", Base: "building", Attrs: map[string]string{"public": "true"}},
+			"building": {Name: "building", Attrs: map[string]string{"public": "false"}}},
+		wantWeight:  1.5,
+		wantMatched: []string{"public"},
+	}, {
+		name:  "the nearest wins",
+		asset: Asset{Name: "A", Base: "vault", Weight: 1},
+		spaces: map[string]Space{
+			"vault": {Name: "vault", Base: "lobby", Attrs: map[string]string{"public": "false"}},
+			"lobby": {Name: "lobby", Attrs: map[string]string{"public": "true"}}},
+		wantWeight:  1,
+		wantMatched: []string{},
+	}, {
+		name:  "bases in a cycle",
+		asset: Asset{Name: "A", Base: "a", Weight: 1},
+		spaces: map[string]Space{
+			"a": {Name: "a", Base: "b"},
+			"b": {Name: "b", Base: "a"}},
+		wantWeight:  1,
+		wantMatched: []string{},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotWeight, gotMatched := applyRules(rules, tt.asset, tt.spaces)
+			if gotWeight != tt.wantWeight {
+				t.Errorf("applyRules() gotWeight = %v, want %v", gotWeight, tt.wantWeight)
+			}
+			if !reflect.DeepEqual(gotMatched, tt.wantMatched) {
+				t.Errorf("applyRules() gotMatched = %v, want %v", gotMatched, tt.wantMatched)
+			}
+		})
+	}
+}
+
+func TestWeightRule_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    WeightRule
+		wantErr bool
+	}{
+		{"valid", WeightRule{ID: "laptop", Field: "category", Op: "=", Value: "laptop", Set: 3}, false},
+		{"empty id", WeightRule{Field: "category", Op: "=", Value: "laptop", Set: 3}, true},
+		{"bad operator", WeightRule{ID: "laptop", Field: "category", Op: "~", Value: "laptop", Set: 3}, true},
+		{"no effect", WeightRule{ID: "laptop", Field: "category", Op: "=", Value: "laptop"}, true},
+		{"negative factor", WeightRule{ID: "laptop", Field: "category", Op: "=", Value: "laptop", Factor: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("WeightRule.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package net
 
 import (
+	"container/heap"
+	"context"
 	"math"
 	"math/rand"
 	"sort"
@@ -20,7 +22,17 @@ func (rs rankSlice) Swap(i, j int) {
 	rs[i], rs[j] = rs[j], rs[i]
 }
 func (rs rankSlice) Less(i, j int) bool {
-	return rs[i].feature < rs[j].feature
+	return rs[i].feature > rs[j].feature // the largest keys win in Algorithm A
+}
+
+// sampleSize rounds the number of Assets to sample out of N under the given rate
+func sampleSize(N int, rate float64) int {
+	return int(rate * (float64(N) + 0.5)) // round
+}
+
+// sampleKey draws the Algorithm A key u^(1/w) of an Asset
+func sampleKey(weight float64) float64 {
+	return math.Pow(rand.Float64(), 1/weight)
 }
 
 /*
@@ -33,7 +45,7 @@ Powered by Algorithm A
 */
 func sample(wholeList []Asset, rate float64) (sampledIndexList []int) {
 	N := len(wholeList)
-	sampleN := int(rate * (float64(N) + 0.5)) // round
+	sampleN := sampleSize(N, rate)
 
 	if N == 0 {
 		return []int{}
@@ -43,7 +55,7 @@ func sample(wholeList []Asset, rate float64) (sampledIndexList []int) {
 	rankList := make([]rank, N, N)
 	for i := 0; i < N; i++ {
 		rankList[i].index = i
-		rankList[i].feature = math.Pow(rand.Float64(), 1/wholeList[i].Weight)
+		rankList[i].feature = sampleKey(wholeList[i].Weight)
 	}
 	sort.Sort(rankSlice(rankList))
 	rankList = rankList[:sampleN]
@@ -55,3 +67,118 @@ func sample(wholeList []Asset, rate float64) (sampledIndexList []int) {
 
 	return sampledIndexList
 }
+
+// assetStream is a one-pass iterator of Assets, like *mongo.Cursor
+type assetStream interface {
+	Next(ctx context.Context) bool
+	Decode(val interface{}) error
+	Err() error
+}
+
+// reservoirItem is an Asset held in the reservoir with its sampling key
+type reservoirItem struct {
+	asset Asset
+	key   float64
+}
+
+// reservoir is a min-heap on the key, so the root is the first one to be replaced
+type reservoir []reservoirItem
+
+func (rv reservoir) Len() int {
+	return len(rv)
+}
+func (rv reservoir) Swap(i, j int) {
+	rv[i], rv[j] = rv[j], rv[i]
+}
+func (rv reservoir) Less(i, j int) bool {
+	return rv[i].key < rv[j].key
+}
+func (rv *reservoir) Push(x interface{}) {
+	*rv = append(*rv, x.(reservoirItem))
+}
+func (rv *reservoir) Pop() interface{} {
+	old := *rv
+	item := old[len(old)-1]
+	*rv = old[:len(old)-1]
+	return item
+}
+
+// offer pushes the item into the reservoir of size k, and returns the one replaced
+// or rejected if the reservoir is full
+func (rv *reservoir) offer(item reservoirItem, k int) (out reservoirItem, full bool) {
+	if len(*rv) < k {
+		heap.Push(rv, item)
+		return reservoirItem{}, false
+	}
+	if k == 0 || item.key <= (*rv)[0].key {
+		return item, true
+	}
+	out = (*rv)[0] // replace the smallest key in the reservoir
+	(*rv)[0] = item
+	heap.Fix(rv, 0)
+	return out, true
+}
+
+/*
+sampleStream :
+Function(
+	stream: the Assets to sample from, consumed in one pass,
+	k: the size of the sample,
+	policy: the lifecycle statuses to sample, and how the inspection history adjusts
+		the weights) -> (sampledList: a slice of sampled Assets)
+
+Powered by Algorithm A-Res, the reservoir version of Algorithm A, which keeps
+the same distribution as sample() with O(k) memory.
+In campaign mode, the uncovered Assets go through another reservoir of size
+policy.Quota first, so at least Quota of them are sampled.
+*/
+func sampleStream(ctx context.Context, stream assetStream, k int, policy samplePolicy) (sampledList []Asset, err error) {
+	if policy.Quota > k {
+		k = policy.Quota
+	}
+	if k <= 0 {
+		return []Asset{}, nil
+	}
+
+	rv := make(reservoir, 0, k)
+	uncoveredRv := make(reservoir, 0, policy.Quota)
+	statuses := policy.sampleStatuses()
+	for stream.Next(ctx) {
+		var as Asset
+		if err = stream.Decode(&as); err != nil {
+			return nil, err
+		}
+
+		if !statuses[assetStatus(as)] { // out of the lifecycle statuses to sample
+			continue
+		}
+		weight := policy.weigh(as)
+		if weight <= 0 { // excluded
+			continue
+		}
+
+		item := reservoirItem{asset: as, key: sampleKey(weight)}
+		if policy.uncovered(as) {
+			var full bool
+			if item, full = uncoveredRv.offer(item, policy.Quota); !full {
+				continue
+			}
+		}
+		rv.offer(item, k-len(uncoveredRv))
+	}
+	if err = stream.Err(); err != nil {
+		return nil, err
+	}
+
+	// the reservoir may be longer than the room left by the uncovered ones
+	sort.Sort(sort.Reverse(rv))
+	if room := k - len(uncoveredRv); len(rv) > room {
+		rv = rv[:room]
+	}
+
+	sampledList = make([]Asset, 0, len(rv)+len(uncoveredRv))
+	for _, item := range append(uncoveredRv, rv...) {
+		sampledList = append(sampledList, item.asset)
+	}
+	return sampledList, nil
+}
@@ -1,7 +1,10 @@
 package net
 
 import (
+	"context"
+	"math"
 	"reflect"
+	"sort"
 	"testing"
 )
 
@@ -18,11 +21,21 @@ func Test_sample(t *testing.T) {
 		name: "Minimal",
 		args: args{
 			wholeList: []Asset{
-				Asset{"A", "base", 0.4, 0.2, 1},
+				Asset{Name: "A", Base: "base", Rx: 0.4, Ry: 0.2, Weight: 1},
 			},
 			rate: 1.0,
 		},
 		wantSampledIndexList: []int{0},
+	}, {
+		name: "Weightless never wins",
+		args: args{
+			wholeList: []Asset{
+				Asset{Name: "A", Base: "base", Weight: 0},
+				Asset{Name: "B", Base: "base", Weight: 1},
+			},
+			rate: 0.5,
+		},
+		wantSampledIndexList: []int{1},
 	}}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -32,3 +45,74 @@ func Test_sample(t *testing.T) {
 		})
 	}
 }
+
+func Test_rankSlice_order(t *testing.T) {
+	// Algorithm A keeps the largest keys u^(1/w), so they sort first
+	rankList := rankSlice{{0, 0.2}, {1, 0.9}, {2, 0.5}}
+	sort.Sort(rankList)
+	if want := (rankSlice{{1, 0.9}, {2, 0.5}, {0, 0.2}}); !reflect.DeepEqual(rankList, want) {
+		t.Errorf("sort.Sort(rankSlice) = %v, want %v", rankList, want)
+	}
+}
+
+// sliceStream replays a slice of Assets as an assetStream
+type sliceStream struct {
+	list []Asset
+	pos  int
+}
+
+func (s *sliceStream) Next(ctx context.Context) bool {
+	s.pos++
+	return s.pos <= len(s.list)
+}
+func (s *sliceStream) Decode(val interface{}) error {
+	*(val.(*Asset)) = s.list[s.pos-1]
+	return nil
+}
+func (s *sliceStream) Err() error {
+	return nil
+}
+
+func Test_sampleStream(t *testing.T) {
+	wholeList := []Asset{
+		Asset{Name: "A", Base: "base", Weight: 1},
+		Asset{Name: "B", Base: "base", Weight: 2},
+		Asset{Name: "C", Base: "base", Weight: 3},
+		Asset{Name: "D", Base: "base", Weight: 4},
+		Asset{Name: "E", Base: "base", Weight: 5},
+		Asset{Name: "F", Base: "base", Weight: 0},
+	}
+	rate := 0.5
+	rounds := 20000
+
+	// inclusion frequency of every Asset under Algorithm A and A-Res
+	freqA := make(map[string]float64)
+	freqRes := make(map[string]float64)
+	for i := 0; i < rounds; i++ {
+		for _, index := range sample(wholeList, rate) {
+			freqA[wholeList[index].Name] += 1 / float64(rounds)
+		}
+		sampledList, err := sampleStream(context.Background(), &sliceStream{list: wholeList}, sampleSize(len(wholeList), rate), samplePolicy{})
+		if err != nil {
+			t.Fatalf("sampleStream() error = %v", err)
+		}
+		if len(sampledList) != sampleSize(len(wholeList), rate) {
+			t.Fatalf("sampleStream() sampled %v Assets, want %v", len(sampledList), sampleSize(len(wholeList), rate))
+		}
+		for _, as := range sampledList {
+			freqRes[as.Name] += 1 / float64(rounds)
+		}
+	}
+
+	for _, as := range wholeList {
+		if math.Abs(freqA[as.Name]-freqRes[as.Name]) > 0.03 {
+			t.Errorf("inclusion frequency of %v: sample() = %v, sampleStream() = %v", as.Name, freqA[as.Name], freqRes[as.Name])
+		}
+	}
+	if freqRes["F"] != 0 {
+		t.Errorf("Asset with zero weight sampled in frequency %v", freqRes["F"])
+	}
+	if freqRes["A"] >= freqRes["E"] {
+		t.Errorf("lighter Asset sampled more often: A = %v, E = %v", freqRes["A"], freqRes["E"])
+	}
+}
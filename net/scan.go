@@ -0,0 +1,185 @@
+// Checking in the Assets of a session by scanning their codes
+
+package net
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/emicklei/go-restful"
+)
+
+// reasons of a misplaced Asset
+const (
+	MISPLACED_NOT_SAMPLED   = "not in the sample"
+	MISPLACED_OTHER_SPACE   = "belongs to another space"
+	MISPLACED_OUTSIDE_ROUTE = "belongs to a space outside the route"
+)
+
+// ScanRequest is what the inspector scans on an Asset
+type ScanRequest struct {
+	Code  string `json:"code" description:"the scanned label name@base#token of the asset, or name@base typed in"`
+	Space string `json:"space" description:"the space where it is scanned, if known"`
+	Notes string `json:"notes" description:"notes of the inspector"`
+}
+
+// Misplaced is an Asset scanned out of its place in the Session
+type Misplaced struct {
+	Name    string    `json:"name" description:"the asset's name"`
+	Base    string    `json:"base" description:"the asset's base space"`
+	FoundIn string    `json:"foundIn" description:"the space where it was scanned, if known"`
+	Reason  string    `json:"reason" description:"not in the sample, belongs to another space, or outside the route"`
+	Time    time.Time `json:"time" description:"the time when it was scanned"`
+}
+
+// ScanResult tells what the scan did to the Session
+type ScanResult struct {
+	Stop      *Stop      `json:"stop,omitempty" description:"the stop checked in, if the asset is one"`
+	Misplaced *Misplaced `json:"misplaced,omitempty" description:"set if the asset is out of its place"`
+	Skipped   []AssetKey `json:"skipped" description:"the pending stops before it in the route order"`
+	Warnings  []string   `json:"warnings" description:"like the route order being skipped, or scanned twice"`
+	Session   Session    `json:"session" description:"the session after the scan"`
+}
+
+// parseScanCode resolves the scanned identifier name@base, and the token after # if scanned
+// on a label; the base is after the last @
+func parseScanCode(code string) (key AssetKey, token string, err error) {
+	i := strings.LastIndex(code, "@")
+	if j := strings.LastIndex(code, "#"); j > i && i >= 0 {
+		code, token = code[:j], code[j+1:]
+	}
+	if i <= 0 || i == len(code)-1 {
+		return key, "", errors.New("the scanned code should be name@base of an asset")
+	}
+	return AssetKey{Name: code[:i], Base: code[i+1:]}, token, nil
+}
+
+// checkScanToken verifies the label's token if scanned; a bare name@base, typed in or on an
+// Asset without a printed label, is refused only if the signed scans are required
+func (r RestContext) checkScanToken(key AssetKey, token string) (errCode int, err error) {
+	if token == "" {
+		if r.SignedScans {
+			return http.StatusNotAcceptable, errors.New("the code of " + key.Name + "@" + key.Base + " has no label token")
+		}
+		return http.StatusOK, nil
+	}
+	if r.LabelSecret == "" {
+		return http.StatusServiceUnavailable, errNoLabelSecret
+	}
+	if !r.verifyLabel(key, token) {
+		return http.StatusNotAcceptable, errors.New("the label of " + key.Name + "@" + key.Base + " is not genuine")
+	}
+	return http.StatusOK, nil
+}
+
+// scan checks in the Asset as found if it is a Stop, warning on the pending Stops before it;
+// otherwise, or if found in another space, it is flagged misplaced; inRoute tells whether its
+// base is in the Session's space tree
+func (s *Session) scan(key AssetKey, foundIn string, notes string, inRoute bool, now time.Time) (result ScanResult) {
+	result.Skipped, result.Warnings = []AssetKey{}, []string{}
+
+	misplace := func(reason string) {
+		m := Misplaced{Name: key.Name, Base: key.Base, FoundIn: foundIn, Reason: reason, Time: now}
+		s.Misplaced = append(s.Misplaced, m)
+		result.Misplaced = &m
+	}
+
+	i := s.stopIndex(key.Name, key.Base)
+	if i < 0 {
+		if inRoute {
+			misplace(MISPLACED_NOT_SAMPLED)
+		} else {
+			misplace(MISPLACED_OUTSIDE_ROUTE)
+		}
+		return result
+	}
+
+	if s.Stops[i].Status != STOP_PENDING {
+		result.Warnings = append(result.Warnings, "already checked as "+s.Stops[i].Status)
+	}
+	for _, stop := range s.Stops[:i] {
+		if stop.Status == STOP_PENDING {
+			result.Skipped = append(result.Skipped, AssetKey{Name: stop.Name, Base: stop.Base})
+		}
+	}
+	if len(result.Skipped) > 0 {
+		result.Warnings = append(result.Warnings, "out of the route order, skipping "+joinStops(result.Skipped))
+	}
+
+	if foundIn != "" && foundIn != key.Base {
+		misplace(MISPLACED_OTHER_SPACE)
+		if notes == "" {
+			notes = "found in " + foundIn
+		}
+	}
+	s.mark(key.Name, key.Base, StopResult{Status: STOP_FOUND, Notes: notes}, now)
+	result.Stop = &s.Stops[i]
+	return result
+}
+
+// joinStops lists the stops like A@base, D@Meeting Room
+func joinStops(list []AssetKey) string {
+	names := make([]string, len(list))
+	for i, k := range list {
+		names[i] = k.Name + "@" + k.Base
+	}
+	return strings.Join(names, ", ")
+}
+
+// POST PREFIX/sessions/{session-id}/scans
+// ScanRequest: {code: "A@base#TOKEN", space: "base", notes: ""}
+func (r RestContext) scanStop(req *restful.Request, resp *restful.Response) {
+	var scan ScanRequest
+	if err := req.ReadEntity(&scan); err != nil {
+		resp.WriteError(http.StatusNotAcceptable, err)
+		return
+	}
+	key, token, err := parseScanCode(scan.Code)
+	if err != nil {
+		resp.WriteError(http.StatusNotAcceptable, err)
+		return
+	}
+	if errCode, err := r.checkScanToken(key, token); err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+
+	if _, errCode, err := r.dbGetAsset(key.Name, key.Base, true); err != nil {
+		resp.WriteError(errCode, errors.New("unknown asset "+key.Name+"@"+key.Base))
+		return
+	}
+
+	now := time.Now()
+	var result ScanResult
+	s, errCode, err := r.dbUpdateSession(req.PathParameter("session-id"), func(s *Session) (int, error) {
+		spaceList, errCode, err := r.dbGetSubtreeSpaces(s.Space, true)
+		if err != nil {
+			return errCode, err
+		}
+		inRoute := false
+		for _, sp := range spaceList {
+			if sp.Name == key.Base {
+				inRoute = true
+				break
+			}
+		}
+		result = s.scan(key, scan.Space, scan.Notes, inRoute, now)
+		return http.StatusOK, nil
+	})
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+
+	// the asset is seen, wherever it is
+	if _, err := r.dbInsertInspection(Inspection{
+		Name: key.Name, Base: key.Base, Time: now, Status: STOP_FOUND, Session: s.ID}); err != nil {
+		log.Println(err)
+	}
+
+	result.Session = *s
+	resp.WriteHeaderAndEntity(http.StatusOK, result)
+}
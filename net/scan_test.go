@@ -0,0 +1,98 @@
+package net
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseScanCode(t *testing.T) {
+	tests := []struct {
+		code      string
+		want      AssetKey
+		wantToken string
+		wantErr   bool
+	}{
+		{"A@base", AssetKey{Name: "A", Base: "base"}, "", false},
+		{"mio@home@Meeting Room", AssetKey{Name: "mio@home", Base: "Meeting Room"}, "", false},
+		{"A@base#ABCD2345", AssetKey{Name: "A", Base: "base"}, "ABCD2345", false},
+		{"No.#1@base", AssetKey{Name: "No.#1", Base: "base"}, "", false},
+		{"A", AssetKey{}, "", true},
+		{"@base", AssetKey{}, "", true},
+		{"A@", AssetKey{}, "", true},
+		{"A@#ABCD2345", AssetKey{}, "", true},
+	}
+	for _, tt := range tests {
+		got, token, err := parseScanCode(tt.code)
+		if (err != nil) != tt.wantErr || got != tt.want || token != tt.wantToken {
+			t.Errorf("parseScanCode(%v) = %v, %v, %v, want %v, %v", tt.code, got, token, err, tt.want, tt.wantToken)
+		}
+	}
+}
+
+func TestSession_scan(t *testing.T) {
+	now := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	s := newSession("base", "mio", sessionTestRoute, now)
+
+	// out of order: A is skipped
+	result := s.scan(AssetKey{Name: "D", Base: "Meeting Room"}, "", "", true, now)
+	if result.Stop == nil || result.Stop.Status != STOP_FOUND || result.Misplaced != nil {
+		t.Errorf("Session.scan() stop = %v, misplaced = %v", result.Stop, result.Misplaced)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0] != (AssetKey{Name: "A", Base: "base"}) || len(result.Warnings) != 1 {
+		t.Errorf("Session.scan() skipped = %v, warnings = %v", result.Skipped, result.Warnings)
+	}
+
+	// in order, but found in another space
+	result = s.scan(AssetKey{Name: "A", Base: "base"}, "Meeting Room", "", true, now)
+	if result.Misplaced == nil || result.Misplaced.Reason != MISPLACED_OTHER_SPACE || len(result.Skipped) != 0 {
+		t.Errorf("Session.scan() misplaced = %v, skipped = %v", result.Misplaced, result.Skipped)
+	}
+	if s.Stops[0].Status != STOP_FOUND || s.Stops[0].Notes != "found in Meeting Room" {
+		t.Errorf("Session.scan() stop A = %v", s.Stops[0])
+	}
+
+	// not a stop
+	result = s.scan(AssetKey{Name: "C", Base: "base"}, "", "", true, now)
+	if result.Stop != nil || result.Misplaced == nil || result.Misplaced.Reason != MISPLACED_NOT_SAMPLED {
+		t.Errorf("Session.scan() stop = %v, misplaced = %v", result.Stop, result.Misplaced)
+	}
+	result = s.scan(AssetKey{Name: "X", Base: "Lab"}, "base", "", false, now)
+	if result.Misplaced == nil || result.Misplaced.Reason != MISPLACED_OUTSIDE_ROUTE {
+		t.Errorf("Session.scan() misplaced = %v", result.Misplaced)
+	}
+
+	// twice
+	result = s.scan(AssetKey{Name: "D", Base: "Meeting Room"}, "", "", true, now)
+	if len(result.Warnings) != 1 {
+		t.Errorf("Session.scan() warnings = %v, want already checked", result.Warnings)
+	}
+
+	if len(s.Misplaced) != 3 || s.Checked != 2 || s.Done {
+		t.Errorf("Session.scan() misplaced = %v, checked = %v, done = %v", len(s.Misplaced), s.Checked, s.Done)
+	}
+}
+
+func TestRestContext_checkScanToken(t *testing.T) {
+	key := AssetKey{Name: "A", Base: "base"}
+	genuine := labelToken("secret", key.Name, key.Base)
+	tests := []struct {
+		name     string
+		r        RestContext
+		token    string
+		wantCode int
+	}{
+		{"typed in", RestContext{LabelSecret: "secret"}, "", 200},
+		{"typed in without a secret", RestContext{}, "", 200},
+		{"typed in while signed scans required", RestContext{LabelSecret: "secret", SignedScans: true}, "", 406},
+		{"genuine label", RestContext{LabelSecret: "secret"}, genuine, 200},
+		{"forged label", RestContext{LabelSecret: "secret"}, "AAAAAAAA", 406},
+		{"label without a secret", RestContext{}, genuine, 503},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := tt.r.checkScanToken(key, tt.token); got != tt.wantCode {
+				t.Errorf("RestContext.checkScanToken() = %v, want %v", got, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,514 @@
+// Inspection sessions tracking what the inspector does on a planned route
+
+package net
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	dataio "github.com/miosolo/readygo/io"
+	"github.com/miosolo/readygo/route"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+MongoDB collection structure:
+readygo(DB): {
+	Session(Collection): {
+		id: "",
+		space: "",
+		inspector: "",
+		created: ISODate(),
+		finished: ISODate(),
+		route: {sequence: [], distance: 0},
+		stops: [{name: "", base: "", status: "", time: ISODate(), notes: ""}],
+		checked: 0,
+		total: 0,
+		done: false,
+		planid: "",
+		due: ISODate(),
+		overdue: false,
+		deferred: [{space: "", uid: "", summary: "", start: ISODate(), end: ISODate()}],
+		misplaced: [{name: "", base: "", foundin: "", reason: "", time: ISODate()}],
+		version: 0 // incremented on every change
+	}
+}*/
+
+// SESSION_UPDATE_RETRIES bounds reapplying a change to a Session changed by someone else meanwhile
+const SESSION_UPDATE_RETRIES = 5
+
+var errSessionChanged = errors.New("the session was changed by someone else meanwhile, try again")
+
+// status of a Stop in the Session
+const (
+	STOP_PENDING = "pending"
+	STOP_FOUND   = "found"
+	STOP_MISSING = "missing"
+	STOP_DAMAGED = "damaged"
+	STOP_SKIPPED = "skipped"
+)
+
+// Stop is an Asset to check in the Session and its result
+type Stop struct {
+	Name   string    `json:"name" description:"the asset's name"`
+	Base   string    `json:"base" description:"the asset's base space"`
+	Status string    `json:"status" description:"one of pending, found, missing, damaged and skipped" default:"pending"`
+	Time   time.Time `json:"time" description:"the time when the result was marked"`
+	Notes  string    `json:"notes" description:"notes of the inspector"`
+}
+
+// StopResult is what the inspector marks on a Stop
+type StopResult struct {
+	Status string `json:"status" description:"one of found, missing, damaged and skipped"`
+	Notes  string `json:"notes" description:"notes of the inspector"`
+}
+
+// AssetKey addresses an Asset by its compound key
+type AssetKey struct {
+	Name string `json:"name" description:"the asset's name"`
+	Base string `json:"base" description:"the asset's base space"`
+}
+
+// ReplanRequest tells where the inspector is and which stops cannot be reached
+type ReplanRequest struct {
+	X            float64    `json:"x" description:"the inspector's current relative x position in the root space"`
+	Y            float64    `json:"y" description:"the inspector's current relative y position in the root space"`
+	Skip         []AssetKey `json:"skip" description:"the stops skipped or unreachable, like in a locked room"`
+	WalkingSpeed float64    `json:"walkingSpeed" description:"the walking speed estimating the ETAs, 0 for the default" default:"1.2"`
+}
+
+// Session turns a planned route into a tracked checklist
+type Session struct {
+	ID        string       `json:"id" description:"unique id of the session"`
+	Space     string       `json:"space" description:"the root space the route is planned in"`
+	Inspector string       `json:"inspector" description:"who carries out the inspection"`
+	Created   time.Time    `json:"created" description:"the time when the session was created"`
+	Finished  time.Time    `json:"finished" description:"the time when the last stop was marked"`
+	Route     dataio.Route `json:"route" description:"the planned route, in absolute position"`
+	Stops     []Stop       `json:"stops" description:"the assets to check in the route order"`
+	Checked   int          `json:"checked" description:"the number of stops marked"`
+	Total     int          `json:"total" description:"the number of stops"`
+	Done      bool         `json:"done" description:"whether all the stops are marked"`
+	PlanID    string       `json:"planId,omitempty" description:"the plan generating the session, if any"`
+	Due       time.Time    `json:"due" description:"the time by when the session should be done, zero for no limit"`
+	Overdue   bool         `json:"overdue" description:"whether the session was not done by the due time"`
+	Deferred  []Booking    `json:"deferred,omitempty" description:"the bookings of the rooms left out when planned"`
+	Misplaced []Misplaced  `json:"misplaced,omitempty" description:"the assets scanned out of their place"`
+	Version   int          `json:"version" description:"incremented on every change, so that concurrent changes are not lost"`
+}
+
+// newSession creates the Session from the route, every Asset on it as a pending Stop
+func newSession(space string, inspector string, rt dataio.Route, now time.Time) Session {
+	s := Session{
+		ID:        primitive.NewObjectID().Hex(),
+		Space:     space,
+		Inspector: inspector,
+		Created:   now,
+		Route:     rt,
+		Stops:     []Stop{}}
+
+	for i, cp := range rt.Sequence {
+		if i == 0 || cp.IsPortal { // the init point and the doors
+			continue
+		}
+		s.Stops = append(s.Stops, Stop{Name: cp.Name, Base: cp.Base, Status: STOP_PENDING})
+	}
+	s.Total = len(s.Stops)
+	s.Done = s.Total == 0
+	return s
+}
+
+// stopIndex finds the Stop of the Asset, -1 for not in the Session
+func (s Session) stopIndex(name string, base string) int {
+	for i, stop := range s.Stops {
+		if stop.Name == name && stop.Base == base {
+			return i
+		}
+	}
+	return -1
+}
+
+// mark records the result on the Stop and updates the progress
+func (s *Session) mark(name string, base string, result StopResult, now time.Time) (errCode int, err error) {
+	switch result.Status {
+	case STOP_FOUND, STOP_MISSING, STOP_DAMAGED, STOP_SKIPPED:
+	default:
+		return http.StatusNotAcceptable, errors.New("invalid stop status " + result.Status)
+	}
+
+	i := s.stopIndex(name, base)
+	if i < 0 {
+		return http.StatusNotFound, errors.New("the asset is not a stop of the session")
+	}
+
+	s.Stops[i].Status = result.Status
+	s.Stops[i].Time = now
+	s.Stops[i].Notes = result.Notes
+
+	s.Checked = 0
+	for _, stop := range s.Stops {
+		if stop.Status != STOP_PENDING {
+			s.Checked++
+		}
+	}
+	if s.Checked == s.Total && !s.Done {
+		s.Done = true
+		s.Finished = now
+	}
+	return http.StatusOK, nil
+}
+
+// skip marks the pending Stops as skipped in re-planning; a Stop already recorded keeps
+// its result, and nothing is skipped then
+func (s *Session) skip(keys []AssetKey, now time.Time) (errCode int, err error) {
+	recorded := []string{}
+	for _, k := range keys {
+		i := s.stopIndex(k.Name, k.Base)
+		if i < 0 {
+			return http.StatusNotFound, errors.New("the asset " + k.Name + "@" + k.Base + " is not a stop of the session")
+		}
+		if s.Stops[i].Status != STOP_PENDING {
+			recorded = append(recorded, k.Name+"@"+k.Base+" ("+s.Stops[i].Status+")")
+		}
+	}
+	if len(recorded) > 0 {
+		return http.StatusConflict, errors.New("the stops already recorded cannot be skipped: " + strings.Join(recorded, ", "))
+	}
+
+	for _, k := range keys {
+		if errCode, err := s.mark(k.Name, k.Base, StopResult{Status: STOP_SKIPPED, Notes: "skipped in re-planning"}, now); err != nil {
+			return errCode, err
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// pendingStops lists the Stops not marked yet
+func (s Session) pendingStops() (list []AssetKey) {
+	list = []AssetKey{}
+	for _, stop := range s.Stops {
+		if stop.Status == STOP_PENDING {
+			list = append(list, AssetKey{Name: stop.Name, Base: stop.Base})
+		}
+	}
+	return list
+}
+
+// reroute replaces the route, keeping the marked Stops ahead and the pending ones
+// in the order of the new route
+func (s *Session) reroute(rt dataio.Route) {
+	stops := make([]Stop, 0, len(s.Stops))
+	pending := make(map[AssetKey]Stop)
+	for _, stop := range s.Stops {
+		if stop.Status == STOP_PENDING {
+			pending[AssetKey{Name: stop.Name, Base: stop.Base}] = stop
+		} else {
+			stops = append(stops, stop)
+		}
+	}
+	for _, cp := range rt.Sequence {
+		k := AssetKey{Name: cp.Name, Base: cp.Base}
+		if stop, ok := pending[k]; ok && !cp.IsPortal {
+			stops = append(stops, stop)
+			delete(pending, k)
+		}
+	}
+	for _, stop := range s.Stops { // not on the new route, keep them at the end
+		if _, ok := pending[AssetKey{Name: stop.Name, Base: stop.Base}]; ok {
+			stops = append(stops, stop)
+		}
+	}
+
+	s.Stops = stops
+	s.Route = rt
+}
+
+// dbInsertSession stores the new Session, as the next round of the campaign covering its space
+func (r RestContext) dbInsertSession(s Session) (errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+
+	if _, err = r.mongoDB.Collection("session").InsertOne(ctx, s); err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, err
+	}
+	if c, _, err := r.dbFindCampaign(s.Space); err == nil {
+		r.dbNextCampaignRound(c.Space)
+	}
+	return http.StatusCreated, nil
+}
+
+// dbGetSession finds the Session by id
+func (r RestContext) dbGetSession(id string) (result *Session, errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+
+	result = new(Session)
+	if err = r.mongoDB.Collection("session").FindOne(ctx, bson.M{"id": id}).Decode(result); err != nil {
+		log.Println(err)
+		return nil, http.StatusNotFound, err
+	}
+	return result, http.StatusOK, nil
+}
+
+// dbFindSessions lists the Sessions matching the filter, latest first
+func (r RestContext) dbFindSessions(filter bson.M) (list []Session, errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cf()
+
+	cur, err := r.mongoDB.Collection("session").Find(ctx, filter, options.Find().SetSort(bson.D{{"created", -1}}))
+	if err != nil {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, err
+	}
+	defer cur.Close(ctx)
+
+	list = []Session{}
+	for cur.Next(ctx) {
+		var s Session
+		if err = cur.Decode(&s); err != nil {
+			log.Println(err)
+			return nil, http.StatusInternalServerError, err
+		}
+		list = append(list, s)
+	}
+	return list, http.StatusOK, nil
+}
+
+// versionFilter matches the Session only if it is still the version read, the old ones
+// without a version as 0
+func versionFilter(id string, version int) bson.M {
+	if version == 0 {
+		return bson.M{"id": id, "version": bson.M{"$in": []interface{}{0, nil}}}
+	}
+	return bson.M{"id": id, "version": version}
+}
+
+// dbReplaceSession saves the updated Session as the next version, unless it is changed by someone
+// else since read, with 409 then
+func (r RestContext) dbReplaceSession(s *Session) (errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+
+	next := *s
+	next.Version++
+	replaceResult, err := r.mongoDB.Collection("session").ReplaceOne(ctx, versionFilter(s.ID, s.Version), next)
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, err
+	}
+	if replaceResult.MatchedCount == 0 {
+		if n, err := r.mongoDB.Collection("session").CountDocuments(ctx, bson.M{"id": s.ID}); err == nil && n == 0 {
+			return http.StatusNotFound, errors.New("the session does not exist")
+		}
+		return http.StatusConflict, errSessionChanged
+	}
+	s.Version = next.Version
+	return http.StatusOK, nil
+}
+
+// dbUpdateSession applies the change to the Session and saves it, reading and applying it again
+// if someone else changed the Session meanwhile
+func (r RestContext) dbUpdateSession(id string, change func(s *Session) (errCode int, err error)) (s *Session, errCode int, err error) {
+	for i := 0; i < SESSION_UPDATE_RETRIES; i++ {
+		if s, errCode, err = r.dbGetSession(id); err != nil {
+			return nil, errCode, err
+		}
+		if errCode, err = change(s); err != nil {
+			return nil, errCode, err
+		}
+		if errCode, err = r.dbReplaceSession(s); err != errSessionChanged {
+			break
+		}
+	}
+	if err != nil {
+		return nil, errCode, err
+	}
+	return s, http.StatusOK, nil
+}
+
+// POST PREFIX/sessions/space/{space-name}?inspector=xx&sample-rate=0.xx&init-x=xx&init-y=xx&start=xx
+func (r RestContext) createSession(req *restful.Request, resp *restful.Response) {
+	spaceName := req.PathParameter("space-name")
+	inspector := req.QueryParameter("inspector")
+	if inspector == "" {
+		resp.WriteError(http.StatusNotAcceptable, errors.New("the inspector should be specified"))
+		return
+	}
+
+	initPoint, rate, policy, err := parseRouteQuery(spaceName, req.Request.URL.Query())
+	if err != nil {
+		resp.WriteError(http.StatusNotAcceptable, err)
+		return
+	}
+	start, end, err := parseBookingQuery(req.Request.URL.Query())
+	if err != nil {
+		resp.WriteError(http.StatusNotAcceptable, err)
+		return
+	}
+	deferred, errCode, err := r.deferBookedSpaces(spaceName, start, end, &policy)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+
+	finalRoutePtr, errCode, err := r.calcRoute(initPoint, rate, policy)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+
+	s := newSession(spaceName, inspector, *finalRoutePtr, time.Now())
+	s.Deferred = deferred
+	if errCode, err := r.dbInsertSession(s); err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusCreated, s)
+}
+
+// GET PREFIX/sessions?space=xx&inspector=xx
+func (r RestContext) findSessions(req *restful.Request, resp *restful.Response) {
+	filter := bson.M{}
+	if space := req.QueryParameter("space"); space != "" {
+		filter["space"] = space
+	}
+	if inspector := req.QueryParameter("inspector"); inspector != "" {
+		filter["inspector"] = inspector
+	}
+
+	list, errCode, err := r.dbFindSessions(filter)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, list)
+}
+
+// GET PREFIX/sessions/{session-id}
+func (r RestContext) findSession(req *restful.Request, resp *restful.Response) {
+	resultPtr, errCode, err := r.dbGetSession(req.PathParameter("session-id"))
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, *resultPtr)
+}
+
+// PUT PREFIX/sessions/{session-id}/stops/{space-name}/{asset-name}
+// StopResult: {status: "found", notes: ""}
+func (r RestContext) markStop(req *restful.Request, resp *restful.Response) {
+	spaceName := req.PathParameter("space-name")
+	assetName := req.PathParameter("asset-name")
+
+	var result StopResult
+	if err := req.ReadEntity(&result); err != nil {
+		resp.WriteError(http.StatusNotAcceptable, err)
+		return
+	}
+
+	now := time.Now()
+	s, errCode, err := r.dbUpdateSession(req.PathParameter("session-id"), func(s *Session) (int, error) {
+		return s.mark(assetName, spaceName, result, now)
+	})
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+
+	if result.Status != STOP_SKIPPED { // the asset is inspected, even if missing
+		if _, err := r.dbInsertInspection(Inspection{
+			Name: assetName, Base: spaceName, Time: now, Status: result.Status, Session: s.ID}); err != nil {
+			log.Println(err)
+		}
+	} else if _, err := r.dbDeleteSessionInspection(assetName, spaceName, s.ID); err != nil {
+		log.Println(err)
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, *s)
+}
+
+// POST PREFIX/sessions/{session-id}/replan?format=png
+// ReplanRequest: {x: 1, y: 2, skip: [{name: "D", base: "Meeting Room"}]}
+func (r RestContext) replanSession(req *restful.Request, resp *restful.Response) {
+	var replan ReplanRequest
+	if err := req.ReadEntity(&replan); err != nil {
+		resp.WriteError(http.StatusNotAcceptable, err)
+		return
+	}
+
+	s, errCode, err := r.dbGetSession(req.PathParameter("session-id"))
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+
+	if errCode, err := s.skip(replan.Skip, time.Now()); err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+
+	// re-solve only the remaining stops, from where the inspector is
+	remaining := []Asset{}
+	for _, k := range s.pendingStops() {
+		asPtr, errCode, err := r.dbGetAsset(k.Name, k.Base, true)
+		if err != nil {
+			resp.WriteError(errCode, err)
+			return
+		}
+		remaining = append(remaining, *asPtr)
+	}
+	if len(remaining) > 0 {
+		finalRoutePtr, errCode, err := r.calcFixedRoute(
+			Asset{Name: "Current Position", Base: s.Space, Rx: replan.X, Ry: replan.Y}, remaining, replan.WalkingSpeed)
+		if err != nil {
+			resp.WriteError(errCode, err)
+			return
+		}
+		s.reroute(*finalRoutePtr)
+	} else {
+		s.reroute(dataio.Route{Sequence: []dataio.Checkpoint{}})
+	}
+
+	if errCode, err := r.dbReplaceSession(s); err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+
+	if req.QueryParameter("format") == "png" {
+		r.writeSessionRoute(*s, req, resp)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, *s)
+}
+
+// GET PREFIX/sessions/{session-id}/route
+func (r RestContext) findSessionRoute(req *restful.Request, resp *restful.Response) {
+	s, errCode, err := r.dbGetSession(req.PathParameter("session-id"))
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	r.writeSessionRoute(*s, req, resp)
+}
+
+// writeSessionRoute draws the current route of the Session as the response
+func (r RestContext) writeSessionRoute(s Session, req *restful.Request, resp *restful.Response) {
+	if len(s.Route.Sequence) == 0 {
+		resp.WriteError(http.StatusNotFound, errors.New("no stop left in the session"))
+		return
+	}
+
+	pic, errCode, err := route.DrawRoute(s.Route.Sequence, s.Route.Outlines)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	http.ServeFile(resp.ResponseWriter, req.Request, pic)
+}
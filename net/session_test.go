@@ -0,0 +1,143 @@
+package net
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/miosolo/readygo/io"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var sessionTestRoute = Route{
+	Sequence: []Checkpoint{
+		Checkpoint{Name: "init point", Base: "base", Rx: 0, Ry: 0, IsPortal: false},
+		Checkpoint{Name: "A", Base: "base", Rx: 1, Ry: 1, IsPortal: false, Weight: 1},
+		Checkpoint{Name: "Meeting Room", Base: "base", Rx: 2, Ry: 2, IsPortal: true},
+		Checkpoint{Name: "D", Base: "Meeting Room", Rx: 2, Ry: 3, IsPortal: false, Weight: 1},
+		Checkpoint{Name: "Meeting Room", Base: "base", Rx: 2, Ry: 2, IsPortal: true},
+		Checkpoint{Name: "B", Base: "base", Rx: 3, Ry: 1, IsPortal: false, Weight: 1}},
+	Distance: 5}
+
+func Test_newSession(t *testing.T) {
+	now := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	s := newSession("base", "mio", sessionTestRoute, now)
+
+	wantStops := []string{"A@base", "D@Meeting Room", "B@base"}
+	if len(s.Stops) != len(wantStops) || s.Total != len(wantStops) {
+		t.Fatalf("newSession() got %v stops, want %v", len(s.Stops), len(wantStops))
+	}
+	for i, stop := range s.Stops {
+		if stop.Name+"@"+stop.Base != wantStops[i] || stop.Status != STOP_PENDING {
+			t.Errorf("newSession() stop %v = %v, want pending %v", i, stop, wantStops[i])
+		}
+	}
+	if s.ID == "" || s.Done {
+		t.Errorf("newSession() id = %v, done = %v", s.ID, s.Done)
+	}
+}
+
+func TestSession_mark(t *testing.T) {
+	now := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	s := newSession("base", "mio", sessionTestRoute, now)
+
+	tests := []struct {
+		name        string
+		asset       string
+		base        string
+		result      StopResult
+		wantErrCode int
+		wantChecked int
+		wantDone    bool
+	}{
+		{"invalid status", "A", "base", StopResult{Status: "lost"}, http.StatusNotAcceptable, 0, false},
+		{"not a stop", "C", "base", StopResult{Status: STOP_FOUND}, http.StatusNotFound, 0, false},
+		{"found", "A", "base", StopResult{Status: STOP_FOUND}, http.StatusOK, 1, false},
+		{"mark again", "A", "base", StopResult{Status: STOP_DAMAGED, Notes: "cracked"}, http.StatusOK, 1, false},
+		{"missing", "D", "Meeting Room", StopResult{Status: STOP_MISSING}, http.StatusOK, 2, false},
+		{"skipped", "B", "base", StopResult{Status: STOP_SKIPPED}, http.StatusOK, 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotErrCode, _ := s.mark(tt.asset, tt.base, tt.result, now)
+			if gotErrCode != tt.wantErrCode {
+				t.Errorf("Session.mark() gotErrCode = %v, want %v", gotErrCode, tt.wantErrCode)
+			}
+			if s.Checked != tt.wantChecked || s.Done != tt.wantDone {
+				t.Errorf("Session.mark() checked = %v, done = %v, want %v, %v", s.Checked, s.Done, tt.wantChecked, tt.wantDone)
+			}
+		})
+	}
+	if s.Stops[0].Status != STOP_DAMAGED || s.Stops[0].Notes != "cracked" {
+		t.Errorf("Session.mark() stop A = %v, want damaged", s.Stops[0])
+	}
+	if !s.Finished.Equal(now) {
+		t.Errorf("Session.mark() finished = %v, want %v", s.Finished, now)
+	}
+}
+
+func TestSession_skip(t *testing.T) {
+	now := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	s := newSession("base", "mio", sessionTestRoute, now)
+	s.mark("A", "base", StopResult{Status: STOP_FOUND, Notes: "on the desk"}, now)
+
+	later := now.Add(time.Hour)
+	keys := []AssetKey{{Name: "A", Base: "base"}, {Name: "B", Base: "base"}}
+	if gotErrCode, _ := s.skip(keys, later); gotErrCode != http.StatusConflict {
+		t.Errorf("Session.skip() gotErrCode = %v, want %v", gotErrCode, http.StatusConflict)
+	}
+	a, b := s.stopIndex("A", "base"), s.stopIndex("B", "base")
+	if s.Stops[a].Status != STOP_FOUND || s.Stops[a].Notes != "on the desk" || s.Stops[b].Status != STOP_PENDING {
+		t.Errorf("Session.skip() stops = %v, want A found and B pending", s.Stops)
+	}
+	if s.Checked != 1 || s.Done {
+		t.Errorf("Session.skip() checked = %v, done = %v, want 1, false", s.Checked, s.Done)
+	}
+
+	if gotErrCode, _ := s.skip(keys[1:], later); gotErrCode != http.StatusOK || s.Stops[b].Status != STOP_SKIPPED {
+		t.Errorf("Session.skip() = %v, stop B = %v, want skipped", gotErrCode, s.Stops[b])
+	}
+	if gotErrCode, _ := s.skip([]AssetKey{{Name: "C", Base: "base"}}, later); gotErrCode != http.StatusNotFound {
+		t.Errorf("Session.skip() gotErrCode = %v, want %v", gotErrCode, http.StatusNotFound)
+	}
+}
+
+func TestSession_reroute(t *testing.T) {
+	now := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	s := newSession("base", "mio", sessionTestRoute, now)
+	s.mark("A", "base", StopResult{Status: STOP_FOUND}, now)
+	s.mark("D", "Meeting Room", StopResult{Status: STOP_SKIPPED}, now)
+
+	pending := s.pendingStops()
+	if len(pending) != 1 || pending[0] != (AssetKey{Name: "B", Base: "base"}) {
+		t.Fatalf("Session.pendingStops() = %v, want [B@base]", pending)
+	}
+
+	newRoute := Route{
+		Sequence: []Checkpoint{
+			Checkpoint{Name: "Current Position", Base: "base", Rx: 3, Ry: 0, IsPortal: false},
+			Checkpoint{Name: "B", Base: "base", Rx: 3, Ry: 1, IsPortal: false, Weight: 1}},
+		Distance: 1}
+	s.reroute(newRoute)
+
+	wantOrder := []string{"A", "D", "B"}
+	for i, stop := range s.Stops {
+		if stop.Name != wantOrder[i] {
+			t.Errorf("Session.reroute() stop %v = %v, want %v", i, stop.Name, wantOrder[i])
+		}
+	}
+	if s.Route.Distance != 1 || s.Total != 3 || s.Checked != 2 {
+		t.Errorf("Session.reroute() distance = %v, total = %v, checked = %v", s.Route.Distance, s.Total, s.Checked)
+	}
+}
+
+func Test_versionFilter(t *testing.T) {
+	if got, want := versionFilter("s1", 3), (bson.M{"id": "s1", "version": 3}); !reflect.DeepEqual(got, want) {
+		t.Errorf("versionFilter() = %v, want %v", got, want)
+	}
+	// the Sessions stored before the versions have none
+	if got, want := versionFilter("s1", 0), (bson.M{"id": "s1", "version": bson.M{"$in": []interface{}{0, nil}}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("versionFilter() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,283 @@
+// Spatial queries in the absolute coordinates: the Assets within a radius, and the nearest ones
+
+package net
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/emicklei/go-restful"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// DEFAULT_NEAREST is how many Assets the nearest query returns, unless asked
+const DEFAULT_NEAREST = 10
+
+// NearbyAsset is an Asset found by the spatial queries, at its absolute position
+type NearbyAsset struct {
+	Asset    Asset   `json:"asset" description:"the asset found"`
+	X        float64 `json:"x" description:"absolute x of the asset"`
+	Y        float64 `json:"y" description:"absolute y of the asset"`
+	Distance float64 `json:"distance" description:"distance from the point queried, in the absolute units"`
+}
+
+// gridCell addresses a cell of the grid
+type gridCell struct {
+	col, row int
+}
+
+// gridIndex buckets the Assets into the square cells of the grid by their absolute positions
+type gridIndex struct {
+	size  float64 // side of a cell
+	items []NearbyAsset
+	cells map[gridCell][]int // indexes of the items in the cell
+	// the range of the cells occupied
+	minCol, maxCol, minRow, maxRow int
+}
+
+// newGridIndex sizes the cells for about one item each over their bounding box
+func newGridIndex(items []NearbyAsset) *gridIndex {
+	g := &gridIndex{size: 1, items: items, cells: make(map[gridCell][]int)}
+	if len(items) == 0 {
+		return g
+	}
+
+	minX, minY, maxX, maxY := math.Inf(+1), math.Inf(+1), math.Inf(-1), math.Inf(-1)
+	for _, it := range items {
+		minX, maxX = math.Min(minX, it.X), math.Max(maxX, it.X)
+		minY, maxY = math.Min(minY, it.Y), math.Max(maxY, it.Y)
+	}
+	if side := math.Max(maxX-minX, maxY-minY) / math.Sqrt(float64(len(items))); side > GEOMETRY_EPSILON {
+		g.size = side
+	}
+
+	for i, it := range items {
+		c := g.cellOf(it.X, it.Y)
+		if i == 0 {
+			g.minCol, g.maxCol, g.minRow, g.maxRow = c.col, c.col, c.row, c.row
+		}
+		g.minCol, g.maxCol = minInt(g.minCol, c.col), maxInt(g.maxCol, c.col)
+		g.minRow, g.maxRow = minInt(g.minRow, c.row), maxInt(g.maxRow, c.row)
+		g.cells[c] = append(g.cells[c], i)
+	}
+	return g
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func (g *gridIndex) cellOf(x float64, y float64) gridCell {
+	return gridCell{col: int(math.Floor(x / g.size)), row: int(math.Floor(y / g.size))}
+}
+
+// clampCell is the column or row of v in the cells, limited to [lo, hi] before converting,
+// so that the far coordinates never overflow
+func (g *gridIndex) clampCell(v float64, lo int, hi int) int {
+	return int(math.Max(float64(lo), math.Min(float64(hi), math.Floor(v/g.size))))
+}
+
+// occupies tells whether (x, y) is in a cell of the range occupied
+func (g *gridIndex) occupies(x float64, y float64) bool {
+	col, row := math.Floor(x/g.size), math.Floor(y/g.size)
+	return col >= float64(g.minCol) && col <= float64(g.maxCol) && row >= float64(g.minRow) && row <= float64(g.maxRow)
+}
+
+// sortByDistance orders the found Assets, the nearest first, then by base and name
+func sortByDistance(list []NearbyAsset) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Distance != list[j].Distance {
+			return list[i].Distance < list[j].Distance
+		}
+		if list[i].Asset.Base != list[j].Asset.Base {
+			return list[i].Asset.Base < list[j].Asset.Base
+		}
+		return list[i].Asset.Name < list[j].Asset.Name
+	})
+}
+
+// within finds the Assets within the radius of (x, y), looking only in the cells the circle overlaps
+func (g *gridIndex) within(x float64, y float64, radius float64) []NearbyAsset {
+	list := []NearbyAsset{}
+	if len(g.items) == 0 {
+		return list
+	}
+	fromCol, toCol := g.clampCell(x-radius, g.minCol, g.maxCol), g.clampCell(x+radius, g.minCol, g.maxCol)
+	fromRow, toRow := g.clampCell(y-radius, g.minRow, g.maxRow), g.clampCell(y+radius, g.minRow, g.maxRow)
+	for col := fromCol; col <= toCol; col++ {
+		for row := fromRow; row <= toRow; row++ {
+			for _, i := range g.cells[gridCell{col, row}] {
+				it := g.items[i]
+				if it.Distance = math.Hypot(it.X-x, it.Y-y); it.Distance <= radius {
+					list = append(list, it)
+				}
+			}
+		}
+	}
+	sortByDistance(list)
+	return list
+}
+
+// nearest finds the k nearest Assets to (x, y), searching the rings of cells outwards
+// until no cell left can be nearer than the k-th found; from a point outside the cells
+// occupied, the rings would mostly be empty, so every Asset is measured instead
+func (g *gridIndex) nearest(x float64, y float64, k int) []NearbyAsset {
+	list := []NearbyAsset{}
+	if len(g.items) == 0 || k <= 0 {
+		return list
+	}
+	if !g.occupies(x, y) {
+		for _, it := range g.items {
+			it.Distance = math.Hypot(it.X-x, it.Y-y)
+			list = append(list, it)
+		}
+		sortByDistance(list)
+		if len(list) > k {
+			list = list[:k]
+		}
+		return list
+	}
+	center := g.cellOf(x, y)
+	// the rings reaching every occupied cell
+	maxRing := maxInt(maxInt(center.col-g.minCol, g.maxCol-center.col), maxInt(center.row-g.minRow, g.maxRow-center.row))
+
+	visit := func(col int, row int) {
+		for _, i := range g.cells[gridCell{col, row}] {
+			it := g.items[i]
+			it.Distance = math.Hypot(it.X-x, it.Y-y)
+			list = append(list, it)
+		}
+	}
+	for ring := 0; ring <= maxRing; ring++ {
+		if ring == 0 {
+			visit(center.col, center.row)
+		} else {
+			for d := -ring; d <= ring; d++ {
+				visit(center.col+d, center.row-ring)
+				visit(center.col+d, center.row+ring)
+				if d != -ring && d != ring {
+					visit(center.col-ring, center.row+d)
+					visit(center.col+ring, center.row+d)
+				}
+			}
+		}
+
+		// any point beyond this ring is at least ring cells away
+		if len(list) >= k {
+			sortByDistance(list)
+			if list[k-1].Distance <= float64(ring)*g.size {
+				break
+			}
+		}
+	}
+	sortByDistance(list)
+	if len(list) > k {
+		list = list[:k]
+	}
+	return list
+}
+
+// parsePoint reads the absolute point queried
+func parsePoint(req *restful.Request) (x float64, y float64, err error) {
+	if x, err = strconv.ParseFloat(req.QueryParameter("x"), 64); err != nil || !finite(x) {
+		return 0, 0, errors.New("x should be a finite number")
+	}
+	if y, err = strconv.ParseFloat(req.QueryParameter("y"), 64); err != nil || !finite(y) {
+		return 0, 0, errors.New("y should be a finite number")
+	}
+	return x, y, nil
+}
+
+// spatialIndex finds the Assets in the space tree matching the search conditions like
+// category and status, and indexes them by their absolute positions
+func (r RestContext) spatialIndex(req *restful.Request) (g *gridIndex, errCode int, err error) {
+	filter, err := parseAssetSearch(req.Request.URL.Query())
+	if err != nil {
+		return nil, http.StatusNotAcceptable, err
+	}
+
+	ancestors, errCode, err := r.dbGetAncestors(req.PathParameter("space-name"))
+	if err != nil {
+		return nil, errCode, err
+	}
+	subtree, errCode, err := r.dbGetSubtreeSpaces(ancestors[0].Name, true)
+	if err != nil {
+		return nil, errCode, err
+	}
+	baseNames := make([]string, 0, len(subtree))
+	for _, sp := range subtree {
+		baseNames = append(baseNames, sp.Name)
+	}
+	assetList, errCode, err := r.dbFindAssets(bson.M{"$and": []bson.M{filter, {"base": bson.M{"$in": baseNames}}}})
+	if err != nil {
+		return nil, errCode, err
+	}
+
+	p := newPositionResolver(append(ancestors[1:], subtree...))
+	items := make([]NearbyAsset, 0, len(assetList))
+	for _, as := range assetList {
+		pos, err := p.assetPosition(as)
+		if err != nil {
+			return nil, http.StatusConflict, err
+		}
+		items = append(items, NearbyAsset{Asset: as, X: pos.X, Y: pos.Y})
+	}
+	return newGridIndex(items), http.StatusOK, nil
+}
+
+// GET PREFIX/spaces/{space-name}/nearby?x=1&y=2&radius=3&category=laptop&status=active
+func (r RestContext) findNearbyAssets(req *restful.Request, resp *restful.Response) {
+	x, y, err := parsePoint(req)
+	if err != nil {
+		resp.WriteError(http.StatusNotAcceptable, err)
+		return
+	}
+	radius, err := strconv.ParseFloat(req.QueryParameter("radius"), 64)
+	if err != nil || !(radius >= 0) { // NaN either
+		resp.WriteError(http.StatusNotAcceptable, errors.New("radius should be a non-negative number"))
+		return
+	}
+
+	g, errCode, err := r.spatialIndex(req)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, g.within(x, y, radius))
+}
+
+// GET PREFIX/spaces/{space-name}/nearest?x=1&y=2&k=10&category=laptop&status=active
+func (r RestContext) findNearestAssets(req *restful.Request, resp *restful.Response) {
+	x, y, err := parsePoint(req)
+	if err != nil {
+		resp.WriteError(http.StatusNotAcceptable, err)
+		return
+	}
+	k := DEFAULT_NEAREST
+	if v := req.QueryParameter("k"); v != "" {
+		if k, err = strconv.Atoi(v); err != nil || k < 1 {
+			resp.WriteError(http.StatusNotAcceptable, errors.New("k should be a positive integer"))
+			return
+		}
+	}
+
+	g, errCode, err := r.spatialIndex(req)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, g.nearest(x, y, k))
+}
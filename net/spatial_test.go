@@ -0,0 +1,109 @@
+package net
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func names(list []NearbyAsset) []string {
+	res := []string{}
+	for _, it := range list {
+		res = append(res, it.Asset.Name)
+	}
+	return res
+}
+
+func Test_gridIndex(t *testing.T) {
+	g := newGridIndex([]NearbyAsset{
+		{Asset: Asset{Name: "A"}, X: 0, Y: 0},
+		{Asset: Asset{Name: "B"}, X: 3, Y: 4},
+		{Asset: Asset{Name: "C"}, X: -1, Y: 0},
+		{Asset: Asset{Name: "D"}, X: 100, Y: 100},
+		{Asset: Asset{Name: "E"}, X: 0, Y: 1},
+	})
+
+	tests := []struct {
+		name string
+		got  []NearbyAsset
+		want []string
+	}{
+		{"within, ties by name", g.within(0, 0, 1), []string{"A", "C", "E"}},
+		{"within, on the circle", g.within(0, 0, 5), []string{"A", "C", "E", "B"}},
+		{"within, none", g.within(50, 50, 1), []string{}},
+		{"nearest", g.nearest(3, 3, 2), []string{"B", "E"}},
+		{"nearest, far away", g.nearest(1000, 1000, 1), []string{"D"}},
+		{"nearest, more than all", g.nearest(0, 0, 10), []string{"A", "C", "E", "B", "D"}},
+		{"empty", newGridIndex(nil).nearest(0, 0, 3), []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := names(tt.got); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("gridIndex = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if got := g.within(0, 0, 5)[3].Distance; got != 5 {
+		t.Errorf("gridIndex.within() distance = %v, want %v", got, 5)
+	}
+}
+
+func Test_gridIndex_bruteForce(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	items := []NearbyAsset{}
+	for i := 0; i < 300; i++ { // clustered, so the cells are uneven
+		items = append(items, NearbyAsset{Asset: Asset{Name: strconv.Itoa(i)},
+			X: rnd.NormFloat64() * 20, Y: rnd.ExpFloat64() * 5})
+	}
+	g := newGridIndex(items)
+
+	for q := 0; q < 50; q++ {
+		x, y := rnd.Float64()*100-50, rnd.Float64()*40-10
+		all := make([]NearbyAsset, len(items))
+		copy(all, items)
+		for i := range all {
+			all[i].Distance = math.Hypot(all[i].X-x, all[i].Y-y)
+		}
+		sortByDistance(all)
+
+		k := 1 + rnd.Intn(20)
+		if got, want := names(g.nearest(x, y, k)), names(all[:k]); !reflect.DeepEqual(got, want) {
+			t.Errorf("gridIndex.nearest(%v, %v, %v) = %v, want %v", x, y, k, got, want)
+		}
+		radius := rnd.Float64() * 15
+		want := []string{}
+		for _, it := range all {
+			if it.Distance <= radius {
+				want = append(want, it.Asset.Name)
+			}
+		}
+		if got := names(g.within(x, y, radius)); !reflect.DeepEqual(got, want) {
+			t.Errorf("gridIndex.within(%v, %v, %v) = %v, want %v", x, y, radius, got, want)
+		}
+	}
+}
+
+func Test_gridIndex_farQuery(t *testing.T) {
+	g := newGridIndex([]NearbyAsset{
+		{Asset: Asset{Name: "A"}, X: 0, Y: 0},
+		{Asset: Asset{Name: "B"}, X: 2, Y: 0},
+		{Asset: Asset{Name: "C"}, X: 0, Y: 2},
+		{Asset: Asset{Name: "D"}, X: 2, Y: 2},
+	})
+
+	done := make(chan []string)
+	go func() {
+		done <- append(names(g.nearest(1e5, 1e5, 1)), names(g.within(-1e300, 1, math.Inf(1)))...)
+	}()
+	select {
+	case got := <-done:
+		if want := []string{"D", "A", "B", "C", "D"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("gridIndex far away = %v, want %v", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("gridIndex.nearest() from far away does not return")
+	}
+}
@@ -0,0 +1,243 @@
+// Lifecycle status of the Assets, the validated transitions and their history
+
+package net
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+MongoDB collection structure:
+readygo(DB): {
+	StatusChange(Collection): {
+		name: "",
+		base: "",
+		from: "",
+		status: "",
+		reason: "",
+		time: ISODate()
+	}
+}*/
+
+// lifecycle status of an Asset; an Asset without one is active
+const (
+	STATUS_ACTIVE     = "active"
+	STATUS_IN_REPAIR  = "in-repair"
+	STATUS_LOANED_OUT = "loaned-out"
+	STATUS_RETIRED    = "retired"
+	STATUS_DISPOSED   = "disposed"
+)
+
+// statusTransitions lists the statuses an Asset can change to from each status;
+// a disposed Asset is gone for good
+var statusTransitions = map[string][]string{
+	STATUS_ACTIVE:     {STATUS_IN_REPAIR, STATUS_LOANED_OUT, STATUS_RETIRED, STATUS_DISPOSED},
+	STATUS_IN_REPAIR:  {STATUS_ACTIVE, STATUS_RETIRED, STATUS_DISPOSED},
+	STATUS_LOANED_OUT: {STATUS_ACTIVE, STATUS_IN_REPAIR, STATUS_RETIRED, STATUS_DISPOSED},
+	STATUS_RETIRED:    {STATUS_ACTIVE, STATUS_DISPOSED},
+	STATUS_DISPOSED:   {},
+}
+
+// DEFAULT_SAMPLE_STATUSES are the statuses of the Assets to sample, unless configured
+var DEFAULT_SAMPLE_STATUSES = []string{STATUS_ACTIVE}
+
+// StatusChange records a change of an Asset's lifecycle status
+type StatusChange struct {
+	Name   string    `json:"name" description:"name of the asset"`
+	Base   string    `json:"base" description:"base space of the asset"`
+	From   string    `json:"from" description:"the status before, set by the server"`
+	Status string    `json:"status" description:"active, in-repair, loaned-out, retired or disposed"`
+	Reason string    `json:"reason" description:"why the status changes, like sent to the vendor"`
+	Time   time.Time `json:"time" description:"when the status changed, set by the server"`
+}
+
+// assetStatus is the Asset's status, active if not set
+func assetStatus(as Asset) string {
+	if as.Status == "" {
+		return STATUS_ACTIVE
+	}
+	return as.Status
+}
+
+// validStatus tells whether the status is one of the lifecycle
+func validStatus(status string) bool {
+	_, ok := statusTransitions[status]
+	return ok
+}
+
+// checkTransition validates the change of the status
+func checkTransition(from string, to string) error {
+	if !validStatus(to) {
+		return errors.New("unknown status " + to)
+	}
+	if from == to {
+		return errors.New("the asset is already " + to)
+	}
+	for _, next := range statusTransitions[from] {
+		if next == to {
+			return nil
+		}
+	}
+	return errors.New("the asset cannot change from " + from + " to " + to)
+}
+
+// parseStatuses parses the comma-separated statuses to sample, or the default if empty
+func parseStatuses(raw string) (statuses map[string]bool, err error) {
+	list := DEFAULT_SAMPLE_STATUSES
+	if raw != "" {
+		list = strings.Split(raw, ",")
+	}
+	statuses = make(map[string]bool, len(list))
+	for _, status := range list {
+		status = strings.TrimSpace(status)
+		if !validStatus(status) {
+			return nil, errors.New("unknown status " + status)
+		}
+		statuses[status] = true
+	}
+	return statuses, nil
+}
+
+// sampleStatuses are the statuses of the Assets to sample, the default if not configured
+func (p samplePolicy) sampleStatuses() map[string]bool {
+	if len(p.Statuses) == 0 {
+		p.Statuses, _ = parseStatuses("")
+	}
+	return p.Statuses
+}
+
+// statusFilter matches the Assets in the statuses, including the ones without a status if active
+func statusFilter(statuses map[string]bool) bson.M {
+	names := make([]string, 0, len(statuses))
+	for status := range statuses {
+		names = append(names, status)
+	}
+	sort.Strings(names)
+
+	list := []interface{}{}
+	for _, status := range names {
+		list = append(list, status)
+	}
+	if statuses[STATUS_ACTIVE] {
+		list = append(list, "", nil) // nil matches the missing field
+	}
+	return bson.M{"status": bson.M{"$in": list}}
+}
+
+// dbChangeStatus changes the Asset's status if it is still the same as validated,
+// records the change, and makes the new cache
+func (r RestContext) dbChangeStatus(change StatusChange) (newAssetPtr *Asset, errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+
+	from := bson.M{"status": change.From}
+	if change.From == STATUS_ACTIVE {
+		from = statusFilter(map[string]bool{STATUS_ACTIVE: true})
+	}
+	updated := Asset{}
+	err = r.mongoDB.Collection("asset").FindOneAndUpdate(ctx,
+		bson.M{"$and": []bson.M{{"name": change.Name, "base": change.Base}, from}},
+		bson.M{"$set": bson.M{"status": change.Status}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return nil, http.StatusConflict, errors.New("the asset's status has been changed by others, try again")
+	} else if err != nil {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if _, err = r.mongoDB.Collection("statuschange").InsertOne(ctx, change); err != nil {
+		log.Println(err) // the status is changed anyway
+	}
+
+	go func() {
+		// update Redis cache
+		redisConn := r.redisConnPool.Get()
+		defer redisConn.Close()
+
+		k := change.Name + "@" + change.Base
+		b, _ := json.Marshal(updated)
+		if _, err := redisConn.Do("SET", k, b); err != nil {
+			log.Println("unable to update cache of key " + k + " in Redis, data may be dirty")
+			log.Println(err)
+		}
+		redisConn.Do("EXPIRE", k, MONTH_SECONDS)
+	}()
+
+	return &updated, http.StatusOK, nil
+}
+
+// dbGetStatusChanges finds the status history of the Asset, latest first
+func (r RestContext) dbGetStatusChanges(name string, base string) (list []StatusChange, errCode int, err error) {
+	ctx, cf := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cf()
+
+	cur, err := r.mongoDB.Collection("statuschange").Find(ctx, bson.M{"name": name, "base": base},
+		options.Find().SetSort(bson.D{{"time", -1}}))
+	if err != nil {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, err
+	}
+	defer cur.Close(ctx)
+
+	list = []StatusChange{}
+	for cur.Next(ctx) {
+		var change StatusChange
+		if err = cur.Decode(&change); err != nil {
+			log.Println(err)
+			return nil, http.StatusInternalServerError, err
+		}
+		list = append(list, change)
+	}
+	return list, http.StatusOK, nil
+}
+
+// PUT PREFIX/spaces/{space-name}/assets/{asset-name}/status
+// StatusChange: {status: "in-repair", reason: ""}
+func (r RestContext) changeStatus(req *restful.Request, resp *restful.Response) {
+	var change StatusChange
+	if err := req.ReadEntity(&change); err != nil {
+		resp.WriteError(http.StatusNotAcceptable, err)
+		return
+	}
+
+	as, errCode, err := r.dbGetAsset(req.PathParameter("asset-name"), req.PathParameter("space-name"), false)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	change.Name, change.Base, change.From, change.Time = as.Name, as.Base, assetStatus(*as), time.Now()
+	if err := checkTransition(change.From, change.Status); err != nil {
+		resp.WriteError(http.StatusNotAcceptable, err)
+		return
+	}
+
+	newAssetPtr, errCode, err := r.dbChangeStatus(change)
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, *newAssetPtr)
+}
+
+// GET PREFIX/spaces/{space-name}/assets/{asset-name}/status-history
+func (r RestContext) findStatusChanges(req *restful.Request, resp *restful.Response) {
+	list, errCode, err := r.dbGetStatusChanges(req.PathParameter("asset-name"), req.PathParameter("space-name"))
+	if err != nil {
+		resp.WriteError(errCode, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, list)
+}
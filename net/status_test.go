@@ -0,0 +1,94 @@
+package net
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func Test_checkTransition(t *testing.T) {
+	tests := []struct {
+		from    string
+		to      string
+		wantErr bool
+	}{
+		{STATUS_ACTIVE, STATUS_IN_REPAIR, false},
+		{STATUS_IN_REPAIR, STATUS_ACTIVE, false},
+		{STATUS_LOANED_OUT, STATUS_ACTIVE, false},
+		{STATUS_RETIRED, STATUS_DISPOSED, false},
+		{STATUS_RETIRED, STATUS_LOANED_OUT, true},
+		{STATUS_DISPOSED, STATUS_ACTIVE, true},
+		{STATUS_DISPOSED, STATUS_RETIRED, true},
+		{STATUS_ACTIVE, STATUS_ACTIVE, true},
+		{STATUS_ACTIVE, "lost", true},
+	}
+	for _, tt := range tests {
+		if err := checkTransition(tt.from, tt.to); (err != nil) != tt.wantErr {
+			t.Errorf("checkTransition(%v, %v) error = %v, wantErr %v", tt.from, tt.to, err, tt.wantErr)
+		}
+	}
+}
+
+func Test_parseStatuses(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    map[string]bool
+		wantErr bool
+	}{
+		{"", map[string]bool{STATUS_ACTIVE: true}, false},
+		{"active, loaned-out", map[string]bool{STATUS_ACTIVE: true, STATUS_LOANED_OUT: true}, false},
+		{"active,lost", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseStatuses(tt.raw)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseStatuses(%v) = %v, %v, want %v", tt.raw, got, err, tt.want)
+		}
+	}
+}
+
+func Test_statusFilter(t *testing.T) {
+	tests := []struct {
+		statuses map[string]bool
+		want     bson.M
+	}{
+		{map[string]bool{STATUS_LOANED_OUT: true, STATUS_ACTIVE: true},
+			bson.M{"status": bson.M{"$in": []interface{}{STATUS_ACTIVE, STATUS_LOANED_OUT, "", nil}}}},
+		{map[string]bool{STATUS_RETIRED: true},
+			bson.M{"status": bson.M{"$in": []interface{}{STATUS_RETIRED}}}},
+	}
+	for _, tt := range tests {
+		if got := statusFilter(tt.statuses); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("statusFilter(%v) = %v, want %v", tt.statuses, got, tt.want)
+		}
+	}
+}
+
+func Test_sampleStream_statuses(t *testing.T) {
+	wholeList := []Asset{
+		Asset{Name: "A", Base: "base", Weight: 1},
+		Asset{Name: "B", Base: "base", Weight: 1, Status: STATUS_ACTIVE},
+		Asset{Name: "C", Base: "base", Weight: 1, Status: STATUS_IN_REPAIR},
+		Asset{Name: "D", Base: "base", Weight: 1, Status: STATUS_DISPOSED},
+	}
+	tests := []struct {
+		statuses map[string]bool
+		want     map[string]bool
+	}{
+		{nil, map[string]bool{"A": true, "B": true}},
+		{map[string]bool{STATUS_IN_REPAIR: true, STATUS_DISPOSED: true}, map[string]bool{"C": true, "D": true}},
+	}
+	for _, tt := range tests {
+		sampledList, err := sampleStream(context.Background(), &sliceStream{list: wholeList}, len(wholeList),
+			samplePolicy{Statuses: tt.statuses})
+		got := map[string]bool{}
+		for _, as := range sampledList {
+			got[as.Name] = true
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sampleStream() in %v = %v, %v, want %v", tt.statuses, got, err, tt.want)
+		}
+	}
+}
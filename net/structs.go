@@ -3,30 +3,53 @@ package net
 import (
 	"os"
 	"strings"
+	"time"
+
+	dataio "github.com/miosolo/readygo/io"
 )
 
 // Space defines the space as a Go struct
 type Space struct { // specified checkpoint, upper-layer
-	Name string  `json:"name" description:"global unique name of the space"`
-	Base string  `json:"base" description:" the parent space it lies in" default:"base"`
-	Rx   float64 `json:"rx" description:"relative x axis value of the parent space"`
-	Ry   float64 `json:"ry" description:"relative y axis value of the parent space"`
+	Name        string            `json:"name" description:"global unique name of the space"`
+	Base        string            `json:"base" description:" the parent space it lies in" default:"base"`
+	Rx          float64           `json:"rx" description:"relative x axis value of the parent space"`
+	Ry          float64           `json:"ry" description:"relative y axis value of the parent space"`
+	Attrs       map[string]string `json:"attrs,omitempty" description:"free-form attributes, like public: true, for weighting rules"`
+	SpeedFactor float64           `json:"speedFactor,omitempty" description:"the ratio of the walking speed in it, like 0.5 for stairs or crowded areas" default:"1.0"`
+	Width       float64           `json:"width,omitempty" description:"the extent along its own x axis; the outline is the rectangle from its door (0, 0) to (width, height)"`
+	Height      float64           `json:"height,omitempty" description:"the extent along its own y axis"`
+	Outline     []dataio.Point    `json:"outline,omitempty" description:"vertices of the polygon outline in its own coordinates, instead of width and height"`
+	Rotation    float64           `json:"rotation,omitempty" description:"counter-clockwise degrees its own axes turn from the parent's"`
+	Scale       float64           `json:"scale,omitempty" description:"the parent's units per unit of its own, like 0.01 for a room drawn in centimetres on a floor in metres; 0 for 1" default:"1.0"`
 }
 
 // Asset defines the asset belonging to a space as a Go struct
 type Asset struct { // specified checkpoint, upper-layer
-	Name   string  `json:"name" description:"unique name in its base space"`
-	Base   string  `json:"base" description:"the base space it lies in" default:"base"`
-	Rx     float64 `json:"rx" description:"relative x axis value of the parent space"`
-	Ry     float64 `json:"ry" description:"relative y axis value of the parent space"`
-	Weight float64 `json:"weight" description:"global weight in sampling" default:"1.0"`
+	Name          string            `json:"name" description:"unique name in its base space"`
+	Base          string            `json:"base" description:"the base space it lies in" default:"base"`
+	Rx            float64           `json:"rx" description:"relative x axis value of the parent space"`
+	Ry            float64           `json:"ry" description:"relative y axis value of the parent space"`
+	Weight        float64           `json:"weight" description:"global weight in sampling" default:"1.0"`
+	LastChecked   time.Time         `json:"lastChecked" description:"the last time it was inspected, set by recording inspections"`
+	Category      string            `json:"category,omitempty" description:"the kind of the asset, like laptop, for weighting rules and dwell times"`
+	Serial        string            `json:"serial,omitempty" description:"the serial or tag number"`
+	Owner         string            `json:"owner,omitempty" description:"the person or team responsible for it"`
+	PurchaseValue float64           `json:"purchaseValue,omitempty" description:"the purchase value, in the register's currency"`
+	PurchaseDate  time.Time         `json:"purchaseDate" description:"when it was purchased, zero if unknown"`
+	Attrs         map[string]string `json:"attrs,omitempty" description:"free-form attributes, like color: black, for weighting rules"`
+	Status        string            `json:"status,omitempty" description:"lifecycle status: active, in-repair, loaned-out, retired or disposed; changed by PUT .../status" default:"active"`
+	Dwell         float64           `json:"dwell,omitempty" description:"seconds to check it, 0 for the default of its category"`
 }
 
 const (
+	//DAY_SECONDS means the seconds of a day
+	DAY_SECONDS = 86400
 	//WEEK_SECONDS meas the seconds of a week
 	WEEK_SECONDS = 604800 // 7 * 24 * 3600
 	//MONTH_SECONDS meas the seconds of a month
-	MONTH_SECONDS = 259200 // 30 * 24 * 3600
+	MONTH_SECONDS = 2592000 // 30 * 24 * 3600
+	//WALKING_SPEED means the default walking speed of the inspectors, in meters (distance units) per second
+	WALKING_SPEED = 1.2
 )
 
 //BakCtx is the default config in production env
@@ -0,0 +1,90 @@
+// Coordinate frames of the Spaces: each one rotated and scaled from its parent's, moved to its door
+
+package net
+
+import (
+	"errors"
+	"math"
+)
+
+// Transform maps the coordinates affinely: x' = A*x + B*y + E, y' = C*x + D*y + F
+type Transform struct {
+	A, B, C, D, E, F float64
+}
+
+// identityTransform keeps the coordinates as they are
+var identityTransform = Transform{A: 1, D: 1}
+
+// unitScale is the parent's units per unit of the Space, 1 if not set
+func (sp Space) unitScale() float64 {
+	if sp.Scale == 0 {
+		return 1
+	}
+	return sp.Scale
+}
+
+// localTransform maps the coordinates in the Space to its parent's: scaled, rotated, then moved to its door
+func localTransform(sp Space) Transform {
+	rad := sp.Rotation * math.Pi / 180
+	cos, sin := math.Cos(rad)*sp.unitScale(), math.Sin(rad)*sp.unitScale()
+	return Transform{A: cos, B: -sin, C: sin, D: cos, E: sp.Rx, F: sp.Ry}
+}
+
+// Then maps by t first, then by u
+func (t Transform) Then(u Transform) Transform {
+	return Transform{
+		A: u.A*t.A + u.B*t.C,
+		B: u.A*t.B + u.B*t.D,
+		C: u.C*t.A + u.D*t.C,
+		D: u.C*t.B + u.D*t.D,
+		E: u.A*t.E + u.B*t.F + u.E,
+		F: u.C*t.E + u.D*t.F + u.F}
+}
+
+// Apply maps the point
+func (t Transform) Apply(x float64, y float64) (float64, float64) {
+	return t.A*x + t.B*y + t.E, t.C*x + t.D*y + t.F
+}
+
+// Scale is how much the distances are stretched, exact for the rotations and the uniform scales
+func (t Transform) Scale() float64 {
+	return math.Sqrt(math.Abs(t.A*t.D - t.B*t.C))
+}
+
+// Inverse maps the points back, like from the absolute coordinates to a Space's
+func (t Transform) Inverse() (Transform, error) {
+	det := t.A*t.D - t.B*t.C
+	if math.Abs(det) < GEOMETRY_EPSILON {
+		return Transform{}, errors.New("the transform cannot be inverted")
+	}
+	inv := Transform{A: t.D / det, B: -t.B / det, C: -t.C / det, D: t.A / det}
+	inv.E = -(inv.A*t.E + inv.B*t.F)
+	inv.F = -(inv.C*t.E + inv.D*t.F)
+	return inv, nil
+}
+
+// frameOf composes the transforms from the Space up to the ancestor's coordinates, or up to the
+// absolute ones through the top space if the ancestor is ""; spaces holds the tree by name
+func frameOf(name string, ancestor string, spaces map[string]Space) (Transform, error) {
+	t := identityTransform
+	visited := make(map[string]bool)
+	for cur := name; cur != ancestor; {
+		sp, ok := spaces[cur]
+		if !ok {
+			if cur == name {
+				return t, errors.New("the space " + name + " does not exist")
+			}
+			if ancestor == "" { // above the top space
+				break
+			}
+			return t, errors.New("the space " + name + " is not under " + ancestor)
+		}
+		if visited[cur] {
+			return t, errors.New("the space " + cur + " lies in itself")
+		}
+		visited[cur] = true
+		t = t.Then(localTransform(sp))
+		cur = sp.Base
+	}
+	return t, nil
+}
@@ -0,0 +1,81 @@
+package net
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func Test_localTransform(t *testing.T) {
+	tests := []struct {
+		name         string
+		sp           Space
+		x, y         float64
+		wantX, wantY float64
+	}{
+		{"moved", Space{Rx: 2, Ry: 3}, 1, 1, 3, 4},
+		{"rotated", Space{Rx: 2, Ry: 3, Rotation: 90}, 1, 0, 2, 4},
+		{"centimetres", Space{Rx: 2, Ry: 3, Scale: 0.01}, 100, 200, 3, 5},
+		{"both", Space{Rotation: 180, Scale: 2}, 1, 1, -2, -2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, y := localTransform(tt.sp).Apply(tt.x, tt.y)
+			if !near(x, tt.wantX) || !near(y, tt.wantY) {
+				t.Errorf("localTransform().Apply() = %v, %v, want %v, %v", x, y, tt.wantX, tt.wantY)
+			}
+		})
+	}
+}
+
+func Test_frameOf(t *testing.T) {
+	spaces := map[string]Space{
+		"floor": {Name: "floor", Rx: 10, Ry: 0},
+		"wing":  {Name: "wing", Base: "floor", Rx: 5, Ry: 5, Rotation: 90},
+		"room":  {Name: "room", Base: "wing", Rx: 2, Ry: 0, Scale: 0.01},
+		"loop":  {Name: "loop", Base: "loop"},
+	}
+	tests := []struct {
+		name         string
+		space        string
+		ancestor     string
+		wantX, wantY float64
+		wantScale    float64
+		wantErr      bool
+	}{
+		// (100, 0) cm in the room is (1, 0) in the room, (3, 0) in the wing, (5, 8) on the floor
+		{"to the floor", "room", "floor", 5, 8, 0.01, false},
+		{"absolute", "room", "", 15, 8, 0.01, false},
+		{"itself", "room", "room", 100, 0, 1, false},
+		{"not under", "floor", "room", 0, 0, 0, true},
+		{"not exist", "attic", "", 0, 0, 0, true},
+		{"cycle", "loop", "", 0, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame, err := frameOf(tt.space, tt.ancestor, spaces)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("frameOf() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			x, y := frame.Apply(100, 0)
+			if !near(x, tt.wantX) || !near(y, tt.wantY) || !near(frame.Scale(), tt.wantScale) {
+				t.Errorf("frameOf().Apply() = %v, %v, scale %v, want %v, %v, scale %v",
+					x, y, frame.Scale(), tt.wantX, tt.wantY, tt.wantScale)
+			}
+
+			inv, err := frame.Inverse()
+			if err != nil {
+				t.Fatalf("Transform.Inverse() error = %v", err)
+			}
+			if bx, by := inv.Apply(x, y); !near(bx, 100) || !near(by, 0) {
+				t.Errorf("Transform.Inverse().Apply() = %v, %v, want 100, 0", bx, by)
+			}
+		})
+	}
+}
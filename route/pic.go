@@ -14,8 +14,9 @@ import (
 	"golang.org/x/image/font/basicfont"
 )
 
-//DrawRoute see the input checkpoints' position as absolute (x,y), draw route, and export
-func DrawRoute(cpList []dataio.Checkpoint) (filePath string, errCode int, err error) {
+//DrawRoute see the input checkpoints' position as absolute (x,y), draw route over the outlines
+//of the spaces, and export; the ETAs and the total duration are shown if estimated
+func DrawRoute(cpList []dataio.Checkpoint, outlines []dataio.Outline) (filePath string, errCode int, err error) {
 	fontPath := strings.Join([]string{os.Getenv("GOPATH"), "src", "github.com",
 		"miosolo", "readygo", "route", "ARIALBI.TTF"}, string(os.PathSeparator))
 	folderPath := strings.Join([]string{os.Getenv("GOPATH"), "src", "github.com",
@@ -26,18 +27,16 @@ func DrawRoute(cpList []dataio.Checkpoint) (filePath string, errCode int, err er
 	picFilePath := strings.Join([]string{folderPath, ("routepic-" + time.Now().Format("02-Jan-2006-15-04-05") + ".png")}, string(os.PathSeparator))
 
 	minx, miny, maxx, maxy := math.Inf(+1), math.Inf(+1), math.Inf(-1), math.Inf(-1)
+	extend := func(x, y float64) {
+		minx, maxx = math.Min(minx, x), math.Max(maxx, x)
+		miny, maxy = math.Min(miny, y), math.Max(maxy, y)
+	}
 	for _, dot := range cpList {
-		if dot.Rx < minx {
-			minx = dot.Rx
-		}
-		if dot.Rx > maxx {
-			maxx = dot.Rx
-		}
-		if dot.Ry < miny {
-			miny = dot.Ry
-		}
-		if dot.Ry > maxy {
-			maxy = dot.Ry
+		extend(dot.Rx, dot.Ry)
+	}
+	for _, outline := range outlines { // the whole rooms are in the picture
+		for _, v := range outline.Points {
+			extend(v.X, v.Y)
 		}
 	}
 	maxx = maxx*1.1 + 1
@@ -78,24 +77,27 @@ func DrawRoute(cpList []dataio.Checkpoint) (filePath string, errCode int, err er
 		dc.Stroke()
 	}
 
-	getX := func(c dataio.Checkpoint) (x float64) {
-		if c.Rx > 0 {
-			x = x0 + (float64(lx)-x0)*c.Rx/maxx
+	mapX := func(rx float64) (x float64) {
+		if rx > 0 {
+			x = x0 + (float64(lx)-x0)*rx/maxx
 		} else {
-			x = x0 - x0*c.Rx/maxx
+			x = x0 - x0*rx/minx
 		}
 		return
 	}
 
-	getY := func(c dataio.Checkpoint) (y float64) {
-		if c.Ry > 0 {
-			y = y0 - c.Ry/maxy*y0
+	mapY := func(ry float64) (y float64) {
+		if ry > 0 {
+			y = y0 - ry/maxy*y0
 		} else {
-			y = y0 + (float64(ly)-y0)*c.Ry/miny
+			y = y0 + (float64(ly)-y0)*ry/miny
 		}
 		return
 	}
 
+	getX := func(c dataio.Checkpoint) float64 { return mapX(c.Rx) }
+	getY := func(c dataio.Checkpoint) float64 { return mapY(c.Ry) }
+
 	if err := dc.LoadFontFace(fontPath, 25); err != nil {
 		log.Println(err)
 		dc.SetFontFace(basicfont.Face7x13)
@@ -104,12 +106,41 @@ func DrawRoute(cpList []dataio.Checkpoint) (filePath string, errCode int, err er
 	dc.DrawRectangle(0, 0, float64(lx), float64(ly))
 	dc.Fill()
 
+	// the outlines under the route, named at their top left corners
+	dc.SetColor(color.Gray{Y: 0xA0})
+	for _, outline := range outlines {
+		if len(outline.Points) == 0 {
+			continue
+		}
+		left, top := math.Inf(+1), math.Inf(-1)
+		for _, v := range outline.Points {
+			dc.LineTo(mapX(v.X), mapY(v.Y))
+			left, top = math.Min(left, v.X), math.Max(top, v.Y)
+		}
+		dc.ClosePath()
+		dc.SetLineWidth(2)
+		dc.Stroke()
+		dc.DrawString(outline.Name, mapX(left)+10, mapY(top)+30)
+	}
+
 	dc.SetColor(color.Black)
 	arrowFromTo(x0, float64(ly), x0, 0, 5) // Y axis
 	arrowFromTo(0, y0, float64(lx), y0, 5) // X axis
 	dc.DrawString("Y", x0+50, 50)
 	dc.DrawString("X", float64(lx)-50, y0-50)
 
+	// total duration: arriving at the last checkpoint and checking it
+	etaText := func(seconds float64) string {
+		return time.Duration(seconds * float64(time.Second)).Round(time.Second).String()
+	}
+	estimated := false
+	if len(cpList) > 0 {
+		last := cpList[len(cpList)-1]
+		if estimated = last.ETA+last.Dwell > 0; estimated {
+			dc.DrawString("Estimated duration: "+etaText(last.ETA+last.Dwell), 20, 40)
+		}
+	}
+
 	var old, new dataio.Checkpoint
 	for i := -1; i < len(cpList)-1; i++ { // i start from -1: let the init point be the first new point
 		if i >= 0 {
@@ -128,7 +159,11 @@ func DrawRoute(cpList []dataio.Checkpoint) (filePath string, errCode int, err er
 			dc.DrawCircle(getX(new), getY(new), 10)
 			dc.Fill()
 		}
-		dc.DrawString(new.Name+"@"+new.Base, getX(new)+10, getY(new)-5)
+		label := new.Name + "@" + new.Base
+		if estimated && i >= 0 && !new.IsPortal {
+			label += " (" + etaText(new.ETA) + ")"
+		}
+		dc.DrawString(label, getX(new)+10, getY(new)-5)
 	}
 
 	err = dc.SavePNG(picFilePath)
@@ -8,7 +8,8 @@ import (
 
 func TestDrawRoute(t *testing.T) {
 	type args struct {
-		cpList []Checkpoint
+		cpList   []Checkpoint
+		outlines []Outline
 	}
 	tests := []struct {
 		name        string
@@ -26,11 +27,29 @@ func TestDrawRoute(t *testing.T) {
 			Checkpoint{Name: "B", Base: "base", Rx: 3, Ry: 1, IsPortal: false, Weight: 1},
 			Checkpoint{Name: "C", Base: "base", Rx: 4, Ry: 0, IsPortal: false, Weight: 1}}},
 		wantErrCode: 200,
+		wantErr:     false}, {
+		name: "with ETA",
+		args: args{cpList: []Checkpoint{
+			Checkpoint{Name: "init point", Base: "base", Rx: 0, Ry: 0, IsPortal: false},
+			Checkpoint{Name: "A", Base: "base", Rx: 1, Ry: 1, IsPortal: false, Weight: 1, ETA: 1.2, Dwell: 30},
+			Checkpoint{Name: "B", Base: "base", Rx: 3, Ry: 1, IsPortal: false, Weight: 1, ETA: 32.9, Dwell: 30}}},
+		wantErrCode: 200,
+		wantErr:     false}, {
+		name: "with outlines",
+		args: args{cpList: []Checkpoint{
+			Checkpoint{Name: "init point", Base: "base", Rx: 0, Ry: 0, IsPortal: false},
+			Checkpoint{Name: "Meeting Room", Base: "base", Rx: 2, Ry: 2, IsPortal: true},
+			Checkpoint{Name: "D", Base: "Meeting Room", Rx: 2, Ry: 3, IsPortal: false, Weight: 1},
+			Checkpoint{Name: "Meeting Room", Base: "base", Rx: 2, Ry: 2, IsPortal: true}},
+			outlines: []Outline{
+				{Name: "base", Points: []Point{{X: -1, Y: -1}, {X: 6, Y: -1}, {X: 6, Y: 5}, {X: -1, Y: 5}}},
+				{Name: "Meeting Room", Points: []Point{{X: 2, Y: 2}, {X: 4, Y: 2}, {X: 4, Y: 4}, {X: 2, Y: 4}}}}},
+		wantErrCode: 200,
 		wantErr:     false}}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, gotErrCode, err := DrawRoute(tt.args.cpList)
+			_, gotErrCode, err := DrawRoute(tt.args.cpList, tt.args.outlines)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("DrawRoute() error = %v, wantErr %v", err, tt.wantErr)
 				return
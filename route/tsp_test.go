@@ -24,53 +24,53 @@ func TestTSP(t *testing.T) {
 		name: "Stright line",
 		args: args{
 			cpList: []Checkpoint{
-				Checkpoint{"A", "base", 0, 1, false, 1},
-				Checkpoint{"B", "base", 0, 2, false, 1},
-				Checkpoint{"C", "base", 0, 3, false, 1},
-				Checkpoint{"D", "base", 0, 4, false, 1},
+				Checkpoint{Name: "A", Base: "base", Rx: 0, Ry: 1, IsPortal: false, Weight: 1},
+				Checkpoint{Name: "B", Base: "base", Rx: 0, Ry: 2, IsPortal: false, Weight: 1},
+				Checkpoint{Name: "C", Base: "base", Rx: 0, Ry: 3, IsPortal: false, Weight: 1},
+				Checkpoint{Name: "D", Base: "base", Rx: 0, Ry: 4, IsPortal: false, Weight: 1},
 			},
-			Portal:      Checkpoint{"init", "base", 0, 0, false, 1},
+			Portal:      Checkpoint{Name: "init", Base: "base", Rx: 0, Ry: 0, IsPortal: false, Weight: 1},
 			circuitFlag: false,
 			result:      &Route{}},
 		wantRoutes: []Route{
 			Route{
 				Sequence: []Checkpoint{
-					Checkpoint{"init", "base", 0, 0, false, 1},
-					Checkpoint{"A", "base", 0, 1, false, 1},
-					Checkpoint{"B", "base", 0, 2, false, 1},
-					Checkpoint{"C", "base", 0, 3, false, 1},
-					Checkpoint{"D", "base", 0, 4, false, 1}},
+					Checkpoint{Name: "init", Base: "base", Rx: 0, Ry: 0, IsPortal: false, Weight: 1},
+					Checkpoint{Name: "A", Base: "base", Rx: 0, Ry: 1, IsPortal: false, Weight: 1},
+					Checkpoint{Name: "B", Base: "base", Rx: 0, Ry: 2, IsPortal: false, Weight: 1},
+					Checkpoint{Name: "C", Base: "base", Rx: 0, Ry: 3, IsPortal: false, Weight: 1},
+					Checkpoint{Name: "D", Base: "base", Rx: 0, Ry: 4, IsPortal: false, Weight: 1}},
 				Distance: 4}},
 	}, {
 		name: "Square",
 		args: args{
 			cpList: []Checkpoint{
-				Checkpoint{"D", "base", 0, 0, false, 1},
-				Checkpoint{"C", "base", 1, 0, false, 1},
-				Checkpoint{"B", "base", 1, 1, false, 1},
-				Checkpoint{"A", "base", 0, 1, false, 1},
+				Checkpoint{Name: "D", Base: "base", Rx: 0, Ry: 0, IsPortal: false, Weight: 1},
+				Checkpoint{Name: "C", Base: "base", Rx: 1, Ry: 0, IsPortal: false, Weight: 1},
+				Checkpoint{Name: "B", Base: "base", Rx: 1, Ry: 1, IsPortal: false, Weight: 1},
+				Checkpoint{Name: "A", Base: "base", Rx: 0, Ry: 1, IsPortal: false, Weight: 1},
 			},
-			Portal:      Checkpoint{"init", "base", 0, 0, false, 1},
+			Portal:      Checkpoint{Name: "init", Base: "base", Rx: 0, Ry: 0, IsPortal: false, Weight: 1},
 			circuitFlag: true,
 			result:      &Route{}},
 		wantRoutes: []Route{
 			Route{
 				Sequence: []Checkpoint{
-					Checkpoint{"init", "base", 0, 0, false, 1},
-					Checkpoint{"D", "base", 0, 0, false, 1},
-					Checkpoint{"C", "base", 1, 0, false, 1},
-					Checkpoint{"B", "base", 1, 1, false, 1},
-					Checkpoint{"A", "base", 0, 1, false, 1},
-					Checkpoint{"init", "base", 0, 0, false, 1}},
+					Checkpoint{Name: "init", Base: "base", Rx: 0, Ry: 0, IsPortal: false, Weight: 1},
+					Checkpoint{Name: "D", Base: "base", Rx: 0, Ry: 0, IsPortal: false, Weight: 1},
+					Checkpoint{Name: "C", Base: "base", Rx: 1, Ry: 0, IsPortal: false, Weight: 1},
+					Checkpoint{Name: "B", Base: "base", Rx: 1, Ry: 1, IsPortal: false, Weight: 1},
+					Checkpoint{Name: "A", Base: "base", Rx: 0, Ry: 1, IsPortal: false, Weight: 1},
+					Checkpoint{Name: "init", Base: "base", Rx: 0, Ry: 0, IsPortal: false, Weight: 1}},
 				Distance: 4},
 			Route{
 				Sequence: []Checkpoint{
-					Checkpoint{"init", "base", 0, 0, false, 1},
-					Checkpoint{"A", "base", 0, 1, false, 1},
-					Checkpoint{"B", "base", 1, 1, false, 1},
-					Checkpoint{"C", "base", 1, 0, false, 1},
-					Checkpoint{"D", "base", 0, 0, false, 1},
-					Checkpoint{"init", "base", 0, 0, false, 1}},
+					Checkpoint{Name: "init", Base: "base", Rx: 0, Ry: 0, IsPortal: false, Weight: 1},
+					Checkpoint{Name: "A", Base: "base", Rx: 0, Ry: 1, IsPortal: false, Weight: 1},
+					Checkpoint{Name: "B", Base: "base", Rx: 1, Ry: 1, IsPortal: false, Weight: 1},
+					Checkpoint{Name: "C", Base: "base", Rx: 1, Ry: 0, IsPortal: false, Weight: 1},
+					Checkpoint{Name: "D", Base: "base", Rx: 0, Ry: 0, IsPortal: false, Weight: 1},
+					Checkpoint{Name: "init", Base: "base", Rx: 0, Ry: 0, IsPortal: false, Weight: 1}},
 				Distance: 4}}}}
 
 	for _, tt := range tests {